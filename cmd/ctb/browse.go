@@ -0,0 +1,853 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runBrowse 全屏浏览文档
+func runBrowse(args []string) int {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	trueColor := fs.Bool("truecolor", isTrueColorTerminal(), "use 24-bit colours instead of 256 colours")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb browse [flags] doc.ctb [node-id]")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\npress ? inside the browser for the list of keys")
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	var start int64
+	if fs.NArg() == 2 {
+		var err error
+		if start, err = strconv.ParseInt(fs.Arg(1), 10, 32); err != nil {
+			fs.Usage()
+			return 2
+		}
+	}
+	if _, _, ok := terminalSize(os.Stdout); !ok {
+		return fail(errors.New("browse needs a terminal"))
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	b, err := newBrowser(h, *trueColor)
+	if err != nil {
+		return fail(err)
+	}
+	if start != 0 {
+		if err := b.open(int32(start), ""); err != nil {
+			return fail(err)
+		}
+	}
+	if err := b.run(); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// browserNode 树中的一个节点
+type browserNode struct {
+	node     *ctb.CtNode
+	depth    int
+	parent   *browserNode
+	children []*browserNode
+	expanded bool
+}
+
+const (
+	focusTree = iota
+	focusContent
+	focusSearch
+	focusPrompt
+)
+
+// browserLocation 浏览历史中的一个位置
+type browserLocation struct {
+	id     int32
+	scroll int
+}
+
+// browser 全屏浏览界面：左侧为节点树，右侧为节点内容，顶部为路径，底部为状态栏
+type browser struct {
+	h         *ctb.Handle
+	trueColor bool
+	out       *bufio.Writer
+	rows      int
+	cols      int
+
+	roots   []*browserNode
+	byId    map[int32]*browserNode
+	visible []*browserNode // 树中当前可见的节点
+	cursor  int            // 树中光标所在的行
+	treeTop int
+	focus   int
+
+	current  *browserNode
+	content  *ctb.CtNodeContent
+	page     *ctb.TerminalPage
+	pageKey  [2]int // 渲染 page 时的宽度与选中项
+	scroll   int
+	selected int // 选中的链接或附件，page.Items 的下标加 1
+	history  []browserLocation
+
+	query   string
+	results []*browserNode
+	result  int
+
+	prompt  string
+	input   []rune
+	onInput func(string)
+	status  string
+	quit    bool
+}
+
+func newBrowser(h *ctb.Handle, trueColor bool) (*browser, error) {
+	b := &browser{h: h, trueColor: trueColor, byId: map[int32]*browserNode{}}
+	b.rows, b.cols, _ = terminalSize(os.Stdout)
+	var load func(fatherId int32, parent *browserNode, depth int) ([]*browserNode, error)
+	load = func(fatherId int32, parent *browserNode, depth int) ([]*browserNode, error) {
+		list, err := h.GetSubNodesById(fatherId)
+		if err != nil {
+			return nil, err
+		}
+		var ret []*browserNode
+		for _, n := range list {
+			bn := &browserNode{node: n, depth: depth, parent: parent}
+			b.byId[n.Id] = bn
+			if n.HasChildren {
+				if bn.children, err = load(n.Id, bn, depth+1); err != nil {
+					return nil, err
+				}
+			}
+			ret = append(ret, bn)
+		}
+		return ret, nil
+	}
+	var err error
+	if b.roots, err = load(0, nil, 0); err != nil {
+		return nil, err
+	}
+	b.refreshTree()
+	if len(b.roots) > 0 {
+		if err := b.open(b.roots[0].node.Id, ""); err != nil {
+			return nil, err
+		}
+	}
+	b.status = "? for help, q to quit"
+	return b, nil
+}
+
+// refreshTree 按展开状态重新计算可见的节点
+func (b *browser) refreshTree() {
+	b.visible = b.visible[:0]
+	var add func(list []*browserNode)
+	add = func(list []*browserNode) {
+		for _, n := range list {
+			b.visible = append(b.visible, n)
+			if n.expanded {
+				add(n.children)
+			}
+		}
+	}
+	add(b.roots)
+	if b.cursor >= len(b.visible) {
+		b.cursor = len(b.visible) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+}
+
+// reveal 展开节点的所有上级节点并把树的光标移到该节点
+func (b *browser) reveal(n *browserNode) {
+	for p := n.parent; p != nil; p = p.parent {
+		p.expanded = true
+	}
+	b.refreshTree()
+	for i, v := range b.visible {
+		if v == n {
+			b.cursor = i
+		}
+	}
+}
+
+// open 在内容面板中显示节点，anchor 不为空时滚动到该锚
+func (b *browser) open(id int32, anchor string) error {
+	n, ok := b.byId[id]
+	if !ok {
+		return fmt.Errorf("node %d not found", id)
+	}
+	c, err := b.h.GetNodeContentById(id, nil)
+	if err != nil {
+		return err
+	}
+	if b.current != nil {
+		b.history = append(b.history, browserLocation{b.current.node.Id, b.scroll})
+	}
+	b.show(n, c, 0)
+	if anchor != "" {
+		if line, ok := b.page.Anchors[anchor]; ok {
+			b.scroll = line
+		} else {
+			b.status = fmt.Sprintf("anchor %q not found", anchor)
+		}
+	}
+	return nil
+}
+
+func (b *browser) show(n *browserNode, c *ctb.CtNodeContent, scroll int) {
+	b.current, b.content = n, c
+	b.page, b.selected, b.scroll = nil, 0, scroll
+	b.reveal(n)
+	b.render()
+}
+
+// back 回到浏览历史中的上一个节点
+func (b *browser) back() {
+	if len(b.history) == 0 {
+		b.status = "no history"
+		return
+	}
+	loc := b.history[len(b.history)-1]
+	b.history = b.history[:len(b.history)-1]
+	n, ok := b.byId[loc.id]
+	if !ok {
+		return
+	}
+	c, err := b.h.GetNodeContentById(loc.id, nil)
+	if err != nil {
+		b.status = err.Error()
+		return
+	}
+	b.show(n, c, loc.scroll)
+}
+
+// layout 树与内容面板的宽度
+func (b *browser) layout() (treeWidth, contentWidth int) {
+	treeWidth = b.cols / 3
+	if treeWidth > 40 {
+		treeWidth = 40
+	}
+	if treeWidth < 12 {
+		treeWidth = 12
+	}
+	contentWidth = b.cols - treeWidth - 3
+	if contentWidth < 10 {
+		contentWidth = 10
+	}
+	return
+}
+
+// bodyHeight 树与内容面板的行数
+func (b *browser) bodyHeight() int {
+	if b.rows < 3 {
+		return 1
+	}
+	return b.rows - 2
+}
+
+// render 按当前宽度与选中项渲染节点内容
+func (b *browser) render() {
+	if b.content == nil {
+		return
+	}
+	_, width := b.layout()
+	key := [2]int{width, b.selected}
+	if b.page != nil && b.pageKey == key {
+		return
+	}
+	page, err := ctb.RenderTerminalPage(b.content, ctb.TerminalOptions{Width: width, TrueColor: b.trueColor, Selected: b.selected})
+	if err != nil {
+		b.status = err.Error()
+		page = &ctb.TerminalPage{}
+	}
+	b.page, b.pageKey = page, key
+}
+
+func (b *browser) run() error {
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	b.out = bufio.NewWriter(os.Stdout)
+	// 备用屏幕、隐藏光标、关闭自动换行
+	b.out.WriteString("\x1b[?1049h\x1b[?25l\x1b[?7l")
+	defer func() {
+		b.out.WriteString("\x1b[?7h\x1b[?25h\x1b[?1049l")
+		_ = b.out.Flush()
+	}()
+
+	keys := make(chan []string)
+	go readKeys(os.Stdin, keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	for !b.quit {
+		b.rows, b.cols, _ = terminalSize(os.Stdout)
+		b.render()
+		b.draw()
+		if err := b.out.Flush(); err != nil {
+			return err
+		}
+		select {
+		case list, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range list {
+				b.key(k)
+			}
+		case <-resize:
+		}
+	}
+	return nil
+}
+
+// 特殊按键的名称；普通字符以其本身表示
+const (
+	keyUp        = "<up>"
+	keyDown      = "<down>"
+	keyLeft      = "<left>"
+	keyRight     = "<right>"
+	keyPageUp    = "<pgup>"
+	keyPageDown  = "<pgdn>"
+	keyHome      = "<home>"
+	keyEnd       = "<end>"
+	keyEnter     = "<enter>"
+	keyTab       = "<tab>"
+	keyBackTab   = "<backtab>"
+	keyBackspace = "<backspace>"
+	keyEscape    = "<esc>"
+	keyCtrlC     = "<ctrl-c>"
+	keyCtrlU     = "<ctrl-u>"
+)
+
+var csiKeys = map[string]string{
+	"A": keyUp, "B": keyDown, "C": keyRight, "D": keyLeft,
+	"H": keyHome, "F": keyEnd, "1~": keyHome, "7~": keyHome, "4~": keyEnd, "8~": keyEnd,
+	"5~": keyPageUp, "6~": keyPageDown, "Z": keyBackTab,
+}
+
+// readKeys 从终端读取输入并解析为按键；一次读到的内容（如粘贴的文本）作为一组发送
+func readKeys(f *os.File, ch chan<- []string) {
+	defer close(ch)
+	buf := make([]byte, 1024)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return
+		}
+		ch <- parseKeys(buf[:n])
+	}
+}
+
+func parseKeys(p []byte) []string {
+	var keys []string
+	for len(p) > 0 {
+		switch c := p[0]; {
+		case c == 0x1b && len(p) > 2 && (p[1] == '[' || p[1] == 'O'):
+			i := 2
+			for i < len(p) && (p[i] < 0x40 || p[i] > 0x7e) {
+				i++
+			}
+			if i == len(p) {
+				return keys
+			}
+			if k, ok := csiKeys[string(p[2:i+1])]; ok {
+				keys = append(keys, k)
+			}
+			p = p[i+1:]
+		case c == 0x1b && len(p) > 1:
+			// Alt 加按键，忽略 Alt
+			p = p[1:]
+		case c == 0x1b:
+			keys = append(keys, keyEscape)
+			p = p[1:]
+		case c == '\r' || c == '\n':
+			keys = append(keys, keyEnter)
+			p = p[1:]
+		case c == '\t':
+			keys = append(keys, keyTab)
+			p = p[1:]
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, keyBackspace)
+			p = p[1:]
+		case c == 0x03:
+			keys = append(keys, keyCtrlC)
+			p = p[1:]
+		case c == 0x15:
+			keys = append(keys, keyCtrlU)
+			p = p[1:]
+		case c < 0x20:
+			p = p[1:]
+		default:
+			r, size := utf8.DecodeRune(p)
+			keys = append(keys, string(r))
+			p = p[size:]
+		}
+	}
+	return keys
+}
+
+const browserHelp = "tab switch pane · / search · enter open/follow · ←→ collapse/expand · n/p next/prev link · s save · backspace back · u parent · q quit"
+
+func (b *browser) key(k string) {
+	if k == keyCtrlC {
+		b.quit = true
+		return
+	}
+	switch b.focus {
+	case focusSearch:
+		b.searchKey(k)
+		return
+	case focusPrompt:
+		b.promptKey(k)
+		return
+	}
+	b.status = ""
+	switch k {
+	case "q":
+		b.quit = true
+	case "?":
+		b.status = browserHelp
+	case keyTab:
+		if b.focus == focusTree {
+			b.focus = focusContent
+		} else {
+			b.focus = focusTree
+		}
+	case "/":
+		b.focus, b.query, b.result = focusSearch, "", 0
+		b.search()
+	case "u":
+		if b.current != nil && b.current.parent != nil {
+			b.openOrReport(b.current.parent.node.Id, "")
+		}
+	case keyBackspace:
+		b.back()
+	default:
+		if b.focus == focusTree {
+			b.treeKey(k)
+		} else {
+			b.contentKey(k)
+		}
+	}
+}
+
+func (b *browser) openOrReport(id int32, anchor string) {
+	if err := b.open(id, anchor); err != nil {
+		b.status = err.Error()
+	}
+}
+
+func (b *browser) treeKey(k string) {
+	if len(b.visible) == 0 {
+		return
+	}
+	n := b.visible[b.cursor]
+	switch k {
+	case keyUp, "k":
+		b.cursor--
+	case keyDown, "j":
+		b.cursor++
+	case keyPageUp:
+		b.cursor -= b.bodyHeight()
+	case keyPageDown:
+		b.cursor += b.bodyHeight()
+	case keyHome, "g":
+		b.cursor = 0
+	case keyEnd, "G":
+		b.cursor = len(b.visible) - 1
+	case keyLeft, "h":
+		if n.expanded {
+			n.expanded = false
+			b.refreshTree()
+		} else if n.parent != nil {
+			b.reveal(n.parent)
+		}
+	case keyRight, "l":
+		if len(n.children) > 0 && !n.expanded {
+			n.expanded = true
+			b.refreshTree()
+		} else if len(n.children) > 0 {
+			b.cursor++
+		}
+	case " ":
+		if len(n.children) > 0 {
+			n.expanded = !n.expanded
+			b.refreshTree()
+		}
+	case keyEnter:
+		b.openOrReport(n.node.Id, "")
+		b.focus = focusContent
+	}
+	if b.cursor >= len(b.visible) {
+		b.cursor = len(b.visible) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+}
+
+func (b *browser) contentKey(k string) {
+	if b.page == nil {
+		return
+	}
+	height := b.bodyHeight()
+	switch k {
+	case keyUp, "k":
+		b.scroll--
+	case keyDown, "j":
+		b.scroll++
+	case keyPageUp:
+		b.scroll -= height - 1
+	case keyPageDown, " ":
+		b.scroll += height - 1
+	case keyHome, "g":
+		b.scroll = 0
+	case keyEnd, "G":
+		b.scroll = len(b.page.Lines) - height
+	case "n", keyRight:
+		b.selectItem(1)
+	case "p", keyLeft, keyBackTab:
+		b.selectItem(-1)
+	case keyEnter:
+		b.activate()
+	case "s":
+		b.saveSelected()
+	}
+	b.clampScroll()
+}
+
+func (b *browser) clampScroll() {
+	if last := len(b.page.Lines) - b.bodyHeight(); b.scroll > last {
+		b.scroll = last
+	}
+	if b.scroll < 0 {
+		b.scroll = 0
+	}
+}
+
+// selectItem 选中下一个（或上一个）链接或附件，并滚动到该处
+func (b *browser) selectItem(step int) {
+	count := len(b.page.Items)
+	if count == 0 {
+		b.status = "no links or attachments in this node"
+		return
+	}
+	switch {
+	case b.selected > 0:
+		b.selected = (b.selected-1+step+count)%count + 1
+	case step > 0:
+		b.selected = 1
+	default:
+		b.selected = count
+	}
+	item := b.page.Items[b.selected-1]
+	if height := b.bodyHeight(); item.Line < b.scroll || item.Line >= b.scroll+height {
+		b.scroll = item.Line - height/3
+	}
+	b.status = describeItem(item)
+	b.render()
+}
+
+func describeItem(item ctb.TerminalItem) string {
+	if item.Widget != nil {
+		return ctb.DefaultPlaceholder(item.Widget) + " — enter or s to save"
+	}
+	if l, ok := ctb.ParseLink(item.Link); ok {
+		return "link: " + l.String()
+	}
+	return item.Link
+}
+
+// activate 打开选中的内部链接，或者保存选中的附件；外部链接只显示其目标
+func (b *browser) activate() {
+	if b.selected == 0 {
+		b.status = "press n to select a link or attachment"
+		return
+	}
+	item := b.page.Items[b.selected-1]
+	if item.Widget != nil {
+		b.saveSelected()
+		return
+	}
+	l, ok := ctb.ParseLink(item.Link)
+	switch {
+	case !ok:
+		b.status = "unsupported link: " + item.Link
+	case l.Kind == ctb.CtLinkNode:
+		b.openOrReport(l.NodeId, l.Anchor)
+	default:
+		b.status = "external link: " + l.String()
+	}
+}
+
+// saveSelected 询问文件名并保存选中的图片或附件
+func (b *browser) saveSelected() {
+	if b.selected == 0 || b.page.Items[b.selected-1].Widget == nil {
+		b.status = "select an image or attachment first (n/p)"
+		return
+	}
+	var data []byte
+	name := ""
+	switch w := b.page.Items[b.selected-1].Widget.(type) {
+	case *ctb.CtEmbFile:
+		data, name = w.Data, filepath.Base(w.Filename)
+	case *ctb.CtPng:
+		data, name = w.Data, fmt.Sprintf("node%d_%d.png", b.current.node.Id, w.Offset)
+	}
+	b.ask("save to: ", name, func(path string) {
+		if path == "" {
+			return
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			b.status = err.Error()
+			return
+		}
+		b.status = fmt.Sprintf("saved %d bytes to %s", len(data), path)
+	})
+}
+
+// ask 在状态栏中输入一行文本
+func (b *browser) ask(prompt, initial string, done func(string)) {
+	b.prompt, b.input, b.onInput = prompt, []rune(initial), done
+	b.focus = focusPrompt
+}
+
+func (b *browser) promptKey(k string) {
+	switch k {
+	case keyEscape:
+		b.focus, b.status = focusContent, "cancelled"
+	case keyEnter:
+		b.focus, b.status = focusContent, ""
+		b.onInput(string(b.input))
+	case keyBackspace:
+		if len(b.input) > 0 {
+			b.input = b.input[:len(b.input)-1]
+		}
+	case keyCtrlU:
+		b.input = nil
+	default:
+		if !strings.HasPrefix(k, "<") || len(k) == 1 {
+			b.input = append(b.input, []rune(k)...)
+		}
+	}
+}
+
+// search 按名称查找节点（不区分大小写），结果按树的顺序排列
+func (b *browser) search() {
+	b.results = b.results[:0]
+	q := strings.ToLower(b.query)
+	var walk func(list []*browserNode)
+	walk = func(list []*browserNode) {
+		for _, n := range list {
+			if strings.Contains(strings.ToLower(n.node.Name), q) {
+				b.results = append(b.results, n)
+			}
+			walk(n.children)
+		}
+	}
+	walk(b.roots)
+	if b.result >= len(b.results) {
+		b.result = len(b.results) - 1
+	}
+	if b.result < 0 {
+		b.result = 0
+	}
+}
+
+func (b *browser) searchKey(k string) {
+	switch k {
+	case keyEscape:
+		b.focus = focusTree
+		return
+	case keyEnter:
+		b.focus = focusTree
+		if len(b.results) > 0 {
+			b.openOrReport(b.results[b.result].node.Id, "")
+			b.focus = focusContent
+		}
+		return
+	case keyUp:
+		if b.result > 0 {
+			b.result--
+		}
+		return
+	case keyDown, keyTab:
+		if b.result < len(b.results)-1 {
+			b.result++
+		}
+		return
+	case keyBackspace:
+		if q := []rune(b.query); len(q) > 0 {
+			b.query = string(q[:len(q)-1])
+		}
+	case keyCtrlU:
+		b.query = ""
+	default:
+		if strings.HasPrefix(k, "<") && len(k) > 1 {
+			return
+		}
+		b.query += k
+	}
+	b.result = 0
+	b.search()
+}
+
+// breadcrumbs 当前节点的路径
+func (b *browser) breadcrumbs() string {
+	var names []string
+	for n := b.current; n != nil; n = n.parent {
+		names = append([]string{ctb.TerminalSafeText(n.node.Name)}, names...)
+	}
+	return strings.Join(names, " › ")
+}
+
+const (
+	sgrReset   = "\x1b[0m"
+	sgrReverse = "\x1b[7m"
+	sgrBold    = "\x1b[1m"
+	sgrDim     = "\x1b[2m"
+)
+
+// draw 重绘整个屏幕
+func (b *browser) draw() {
+	treeWidth, _ := b.layout()
+	height := b.bodyHeight()
+	w := b.out
+	w.WriteString("\x1b[H")
+
+	// 路径
+	w.WriteString(sgrReverse + fitWidth(" "+b.breadcrumbs(), b.cols) + sgrReset)
+
+	// 树或者搜索结果
+	list, cursor := b.visible, b.cursor
+	if b.focus == focusSearch {
+		list, cursor = b.results, b.result
+	}
+	if cursor < b.treeTop {
+		b.treeTop = cursor
+	}
+	if cursor >= b.treeTop+height {
+		b.treeTop = cursor - height + 1
+	}
+	if b.treeTop > 0 && b.treeTop > len(list)-height {
+		b.treeTop = len(list) - height
+		if b.treeTop < 0 {
+			b.treeTop = 0
+		}
+	}
+	if b.page != nil {
+		b.clampScroll()
+	}
+	for row := 0; row < height; row++ {
+		fmt.Fprintf(w, "\x1b[%d;1H", row+2)
+		i := b.treeTop + row
+		if i < len(list) {
+			n := list[i]
+			var label string
+			if b.focus == focusSearch {
+				label = " " + ctb.TerminalSafeText(n.node.Name)
+				if n.parent != nil {
+					label += sgrDim + "  " + ctb.TerminalSafeText(n.parent.node.Name)
+				}
+			} else {
+				marker := "  "
+				if len(n.children) > 0 && n.expanded {
+					marker = "▾ "
+				} else if len(n.children) > 0 {
+					marker = "▸ "
+				}
+				label = " " + strings.Repeat("  ", n.depth) + marker + ctb.TerminalSafeText(n.node.Name)
+			}
+			style := ""
+			if n == b.current || n.node.IsBold {
+				style = sgrBold
+			}
+			if i == cursor && (b.focus == focusTree || b.focus == focusSearch) {
+				style += sgrReverse
+			}
+			w.WriteString(style + fitWidth(label, treeWidth) + sgrReset)
+		} else {
+			w.WriteString(strings.Repeat(" ", treeWidth))
+		}
+		w.WriteString(sgrDim + " │ " + sgrReset)
+		if b.page != nil && b.scroll+row < len(b.page.Lines) {
+			w.WriteString(b.page.Lines[b.scroll+row])
+		}
+		w.WriteString(sgrReset + "\x1b[K")
+	}
+
+	// 状态栏
+	fmt.Fprintf(w, "\x1b[%d;1H", b.rows)
+	switch b.focus {
+	case focusSearch:
+		w.WriteString(fitWidth(fmt.Sprintf("/%s  (%d found, enter to open, esc to cancel)", ctb.TerminalSafeText(b.query), len(b.results)), b.cols))
+	case focusPrompt:
+		w.WriteString(fitWidth(ctb.TerminalSafeText(b.prompt+string(b.input))+"▏", b.cols))
+	default:
+		pos := ""
+		if b.page != nil && len(b.page.Lines) > height {
+			pos = fmt.Sprintf("%d%%", 100*(b.scroll+height)/len(b.page.Lines))
+		}
+		// 状态中可能有链接、文件名等来自文档的内容
+		status := fitWidth(" "+ctb.TerminalSafeText(b.status), b.cols-len(pos)-1)
+		w.WriteString(sgrDim + status + " " + pos + sgrReset)
+	}
+	w.WriteString("\x1b[K")
+}
+
+// fitWidth 截断或者用空格补齐到指定的列数，可以包含浏览器自己添加的 SGR 序列；
+// 节点名称等来自文档的文本必须先经过 ctb.TerminalSafeText，否则其中的转义序列会原样输出
+func fitWidth(s string, width int) string {
+	var sb strings.Builder
+	used := 0
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			j := strings.IndexByte(s[i:], 'm')
+			if j < 0 {
+				break
+			}
+			sb.WriteString(s[i : i+j+1])
+			i += j + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		rw := ctb.TerminalTextWidth(string(r))
+		if used+rw > width {
+			if used < width {
+				sb.WriteString("…")
+				used++
+			}
+			break
+		}
+		sb.WriteRune(r)
+		used += rw
+		i += size
+	}
+	if used < width {
+		sb.WriteString(strings.Repeat(" ", width-used))
+	}
+	return sb.String()
+}
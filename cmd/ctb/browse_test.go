@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// browserSequences 浏览器自己输出的转义序列：SGR、光标定位与清除到行尾
+var browserSequences = regexp.MustCompile(`\x1b\[[0-9;]*[mHK]`)
+
+func TestBrowserDrawNodeNames(t *testing.T) {
+	const evil = "x\x1b]52;c;aGk=\x07\x1b[2J"
+	parent := &browserNode{node: &ctb.CtNode{Id: 1, Name: "top" + evil}, expanded: true}
+	child := &browserNode{node: &ctb.CtNode{Id: 2, Name: "child" + evil}, depth: 1, parent: parent}
+	parent.children = []*browserNode{child}
+	var buf bytes.Buffer
+	b := &browser{
+		out:     bufio.NewWriter(&buf),
+		rows:    10,
+		cols:    100,
+		roots:   []*browserNode{parent},
+		visible: []*browserNode{parent, child},
+		current: child,
+		status:  "link: " + evil,
+	}
+	for _, focus := range []int{focusTree, focusSearch} {
+		b.focus = focus
+		b.results = []*browserNode{child}
+		b.query = evil
+		buf.Reset()
+		b.draw()
+		b.out.Flush()
+		out := buf.String()
+		for _, c := range browserSequences.ReplaceAllString(out, "") {
+			if unicode.IsControl(c) {
+				t.Fatalf("focus %d: output contains control character %U:\n%q", focus, c, out)
+			}
+		}
+		if !strings.Contains(out, "childx\ufffd]52;c;") {
+			t.Errorf("focus %d: node name is not shown with the control characters replaced:\n%q", focus, out)
+		}
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abcd"},
+		{"ab中", 3, "ab…"},
+		{sgrBold + "ab" + sgrReset, 3, sgrBold + "ab" + sgrReset + " "},
+		{"中文字", 5, "中文…"},
+	}
+	for _, tt := range tests {
+		if got := fitWidth(tt.s, tt.width); got != tt.want {
+			t.Errorf("fitWidth(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
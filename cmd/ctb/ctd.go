@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runExportCTD 将整个文档写为 CherryTree 的 XML 格式
+func runExportCTD(args []string) int {
+	fs := flag.NewFlagSet("export-ctd", flag.ExitOnError)
+	out := fs.String("o", "", "write the XML to this file instead of standard output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb export-ctd [-o out.ctd] doc.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := h.ExportCTD(w); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// runConvert 在 ctb 与 ctd 格式之间转换文档
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb convert in.ctb out.ctd")
+		fmt.Fprintln(os.Stderr, "       ctb convert in.ctd out.ctb")
+		fmt.Fprintln(os.Stderr, "The output is read back and compared with the input; it is removed if they differ.")
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	if err := ctb.Convert(fs.Arg(0), fs.Arg(1)); err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runDiff 比较两个文档；与 diff(1) 一致，无差异时退出码为 0，有差异时为 1，出错时为 2
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the difference as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb diff [-json] old.ctb new.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	oldDoc, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	newDoc, ok := openHandle(fs.Arg(1))
+	if !ok {
+		return 2
+	}
+	d, err := ctb.DiffDocuments(oldDoc, newDoc)
+	if err != nil {
+		fail(err)
+		return 2
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	} else {
+		err = d.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fail(err)
+		return 2
+	}
+	if d.IsEmpty() {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runEPUB 将节点或整个文档导出为 EPUB 电子书
+func runEPUB(args []string) int {
+	fs := flag.NewFlagSet("epub", flag.ExitOnError)
+	out := fs.String("o", "", "write the book to this file (required)")
+	node := fs.Int("node", 0, "export this node instead of the whole document")
+	children := fs.Bool("children", false, "with -node, also export all nodes below it")
+	title := fs.String("title", "", "book title (default: name of the first node)")
+	author := fs.String("author", "", "book author")
+	lang := fs.String("lang", "en", "book language, e.g. en or zh-CN")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb epub [flags] -o out.epub doc.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return fail(err)
+	}
+	err = h.ExportEPUB(f, int32(*node), ctb.EPUBOptions{
+		WithChildren: *node == 0 || *children,
+		Title:        *title,
+		Author:       *author,
+		Language:     *lang,
+	})
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(*out)
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	return 0
+}
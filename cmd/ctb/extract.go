@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runExtractCode 将所有代码节点与代码框提取为源文件
+func runExtractCode(args []string) int {
+	fs := flag.NewFlagSet("extract-code", flag.ExitOnError)
+	out := fs.String("o", "", "output directory (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb extract-code -o dir doc.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	snippets, err := h.ExtractCode(*out)
+	if err != nil {
+		return fail(err)
+	}
+	for _, s := range snippets {
+		fmt.Println(filepath.Join(*out, s.File))
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+const gitUsage = `To use ctb with git, add to .gitattributes:
+
+    *.ctb diff=ctb merge=ctb
+
+and to .git/config (or ~/.gitconfig):
+
+    [diff "ctb"]
+        textconv = ctb textconv
+    [merge "ctb"]
+        name = CherryTree node-level merge
+        driver = ctb merge-driver %O %A %B %P
+`
+
+// runTextconv 以稳定的文本形式输出文档，供 git diff / git log -p 使用
+func runTextconv(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: ctb textconv file.ctb")
+		fmt.Fprint(os.Stderr, "\n"+gitUsage)
+		return 2
+	}
+	h, ok := openHandle(args[0])
+	if !ok {
+		return 2
+	}
+	if err := h.WriteTextDump(os.Stdout); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// runMergeDriver git 合并驱动：合并结果写回 ours（%A），内容冲突的节点保留 theirs 版本的副本；
+// 存在冲突时退出码非 0，git 会将文件标记为冲突
+func runMergeDriver(args []string) int {
+	if len(args) < 3 || len(args) > 4 {
+		fmt.Fprintln(os.Stderr, "usage: ctb merge-driver base ours theirs [path]")
+		fmt.Fprint(os.Stderr, "\n"+gitUsage)
+		return 2
+	}
+	name := args[1]
+	if len(args) == 4 {
+		name = args[3]
+	}
+	var handles []*ctb.Handle
+	for _, f := range args[:3] {
+		h, ok := openHandle(f)
+		if !ok {
+			return 2
+		}
+		handles = append(handles, h)
+	}
+	result, err := ctb.MergeDocuments(handles[0], handles[1], handles[2], args[1], ctb.MergeOptions{DuplicateConflicts: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ctb: merging %v: %v\n", name, err)
+		return 2
+	}
+	printMergeResult(result, false)
+	if len(result.Conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "ctb: %d conflict(s) in %v\n", len(result.Conflicts), name)
+		return 1
+	}
+	return 0
+}
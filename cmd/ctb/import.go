@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runImportMarkdown 将 Markdown 文件或目录导入为新的 ctb 文档
+func runImportMarkdown(args []string) int {
+	fs := flag.NewFlagSet("import-md", flag.ExitOnError)
+	out := fs.String("o", "", "write the imported document to this file (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb import-md -o out.ctb <file.md|dir>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	if err := ctb.ImportMarkdown(fs.Arg(0), *out); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// runImportDirectory 将目录树导入为新的 ctb 文档
+func runImportDirectory(args []string) int {
+	fs := flag.NewFlagSet("import-dir", flag.ExitOnError)
+	out := fs.String("o", "", "write the imported document to this file (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb import-dir -o out.ctb <dir>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	if err := ctb.ImportDirectory(fs.Arg(0), *out); err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+// ctb 是 cherrytree-api 的命令行工具
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"browse":       {"interactive terminal browser for a document", runBrowse},
+	"convert":      {"convert between .ctb and .ctd documents", runConvert},
+	"decrypt":      {"decrypt a password-protected .ctz/.ctx document", runDecrypt},
+	"diff":         {"compare two documents node by node", runDiff},
+	"epub":         {"export a node, a subtree or the whole document as EPUB", runEPUB},
+	"export-ctd":   {"export a whole document as CherryTree XML (.ctd)", runExportCTD},
+	"export-json":  {"export a whole document as JSON", runExportJSON},
+	"extract-code": {"write every code node and code box to a source file", runExtractCode},
+	"import-dir":   {"import a directory of files into a new document", runImportDirectory},
+	"import-md":    {"import Markdown files into a new document", runImportMarkdown},
+	"import-json":  {"create a document from exported JSON", runImportJSON},
+	"merge":        {"three-way merge of documents", runMerge},
+	"merge-driver": {"git merge driver for .ctb files", runMergeDriver},
+	"pdf":          {"export a node, a subtree or the whole document as PDF", runPDF},
+	"show":         {"render a node in the terminal", runShow},
+	"tables":       {"export every table as CSV files or one XLSX workbook", runTables},
+	"textconv":     {"print a stable text dump for git diff", runTextconv},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ctb: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ctb <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+}
+
+// openHandle 只读打开文档，失败时输出错误。"-" 表示从标准输入读取，.ctd 与 .ctz/.ctx 文档在内存中打开
+func openHandle(filepath string) (*ctb.Handle, bool) {
+	var h *ctb.Handle
+	var err error
+	opts := ctb.OpenOptions{ReadOnly: true}
+	switch {
+	case filepath == "-":
+		var data []byte
+		if data, err = io.ReadAll(os.Stdin); err == nil {
+			h, err = ctb.OpenBytes(data, opts)
+		}
+	case ctb.IsArchive(filepath):
+		return openArchive(filepath)
+	case strings.EqualFold(path.Ext(filepath), ".ctd"):
+		var data []byte
+		if data, err = os.ReadFile(filepath); err == nil {
+			h, err = ctb.OpenBytes(data, opts)
+		}
+	default:
+		if _, err = os.Stat(filepath); err == nil {
+			h, err = ctb.OpenFile(filepath, opts)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ctb: %v\n", err)
+		return nil, false
+	}
+	return h, true
+}
+
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "ctb: %v\n", err)
+	return 1
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runMerge 三方合并；存在冲突时退出码为 1
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("o", "", "write the merged document to this file (required)")
+	duplicate := fs.Bool("duplicate", false, "keep theirs version of conflicting nodes in duplicate nodes with conflict markers")
+	asJSON := fs.Bool("json", false, "print the merge report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb merge [-duplicate] [-json] -o merged.ctb base.ctb ours.ctb theirs.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 3 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	var handles []*ctb.Handle
+	for _, f := range fs.Args() {
+		h, ok := openHandle(f)
+		if !ok {
+			return 2
+		}
+		handles = append(handles, h)
+	}
+	result, err := ctb.MergeDocuments(handles[0], handles[1], handles[2], *out, ctb.MergeOptions{DuplicateConflicts: *duplicate})
+	if err != nil {
+		fail(err)
+		return 2
+	}
+	printMergeResult(result, *asJSON)
+	if len(result.Conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printMergeResult(result *ctb.MergeResult, asJSON bool) {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(result)
+		return
+	}
+	olds := make([]int32, 0, len(result.Renumbered))
+	for old := range result.Renumbered {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		return olds[i] < olds[j]
+	})
+	for _, old := range olds {
+		fmt.Fprintf(os.Stderr, "renumbered: node %d added in theirs is now node %d\n", old, result.Renumbered[old])
+	}
+	for _, c := range result.Conflicts {
+		fmt.Fprintf(os.Stderr, "CONFLICT (%s): node %d: %s", c.Kind, c.NodeId, c.Message)
+		if c.DuplicateId != 0 {
+			fmt.Fprintf(os.Stderr, " (theirs version in node %d)", c.DuplicateId)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+}
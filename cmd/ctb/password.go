@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// passwordEnv 加密文档的密码可以通过这个环境变量给出，否则在终端上询问
+const passwordEnv = "CTB_PASSWORD"
+
+// archivePassword 打开加密文档所需的密码
+func archivePassword(filepath string) (string, error) {
+	if pw, ok := os.LookupEnv(passwordEnv); ok {
+		return pw, nil
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("%v is encrypted; set %s to its password", filepath, passwordEnv)
+	}
+	defer tty.Close()
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return "", fmt.Errorf("%v is encrypted; set %s to its password", filepath, passwordEnv)
+	}
+	defer restore()
+	fmt.Fprintf(tty, "Password for %s: ", filepath)
+	defer fmt.Fprint(tty, "\r\n")
+	var pw []rune
+	buf := make([]byte, 1)
+	var pending []byte
+	for {
+		if _, err := tty.Read(buf); err != nil {
+			return "", err
+		}
+		switch buf[0] {
+		case '\r', '\n':
+			return string(pw), nil
+		case 3, 4: // Ctrl-C、Ctrl-D
+			return "", errors.New("cancelled")
+		case 127, 8:
+			if len(pw) > 0 {
+				pw = pw[:len(pw)-1]
+			}
+		default:
+			// 多字节的 UTF-8 字符逐字节到达
+			pending = append(pending, buf[0])
+			if utf8.FullRune(pending) {
+				pw = append(pw, []rune(string(pending))...)
+				pending = pending[:0]
+			}
+		}
+	}
+}
+
+// openArchive 打开加密文档，密码见 archivePassword
+func openArchive(filepath string) (*ctb.Handle, bool) {
+	pw, err := archivePassword(filepath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ctb: %v\n", err)
+		return nil, false
+	}
+	h, err := ctb.OpenArchive(filepath, pw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ctb: %v\n", err)
+		return nil, false
+	}
+	return h, true
+}
+
+// runDecrypt 解密 .ctz/.ctx 文档并写为 .ctd 或 .ctb 文件
+func runDecrypt(args []string) int {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	out := fs.String("o", "", "write the decrypted document to this .ctb or .ctd file (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb decrypt -o out.ctb|out.ctd doc.ctz|doc.ctx")
+		fmt.Fprintf(os.Stderr, "The password is read from $%s or asked on the terminal.\n", passwordEnv)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	if _, err := ctb.DocumentFormat(*out); err != nil {
+		return fail(err)
+	}
+	pw, err := archivePassword(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	if err := ctb.ExtractArchive(fs.Arg(0), pw, *out); err != nil {
+		return fail(err)
+	}
+	return 0
+}
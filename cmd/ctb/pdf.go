@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runPDF 将节点或整个文档导出为 PDF
+func runPDF(args []string) int {
+	fs := flag.NewFlagSet("pdf", flag.ExitOnError)
+	out := fs.String("o", "", "write the PDF to this file (required)")
+	node := fs.Int("node", 0, "export this node instead of the whole document")
+	children := fs.Bool("children", false, "with -node, also export all nodes below it")
+	title := fs.String("title", "", "title on the contents page (default: name of the first node)")
+	pageSize := fs.String("page", "A4", "page size: A3, A4, A5, Letter or Legal")
+	noTOC := fs.Bool("no-toc", false, "do not add a contents page")
+	var fonts ctb.PDFFonts
+	fs.StringVar(&fonts.Regular, "font", "", "TrueType font for text; needed for characters outside Western European scripts")
+	fs.StringVar(&fonts.Bold, "font-bold", "", "TrueType font for bold text (default: -font)")
+	fs.StringVar(&fonts.Italic, "font-italic", "", "TrueType font for italic text (default: -font)")
+	fs.StringVar(&fonts.BoldItalic, "font-bold-italic", "", "TrueType font for bold italic text (default: -font)")
+	fs.StringVar(&fonts.Mono, "font-mono", "", "TrueType font for code (default: -font)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb pdf [flags] -o out.pdf doc.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		return 2
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return fail(err)
+	}
+	err = h.ExportPDF(f, int32(*node), ctb.PDFOptions{
+		WithChildren: *node == 0 || *children,
+		PageSize:     *pageSize,
+		Title:        *title,
+		NoTOC:        *noTOC,
+		Fonts:        fonts,
+	})
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(*out)
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// runShow 在终端中显示节点内容
+func runShow(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	width := fs.Int("width", 0, "wrap width (default: terminal width or $COLUMNS)")
+	noColor := fs.Bool("no-color", os.Getenv("NO_COLOR") != "", "disable ANSI styles")
+	trueColor := fs.Bool("truecolor", isTrueColorTerminal(), "use 24-bit colours instead of 256 colours")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb show [flags] doc.ctb node-id")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	id, err := strconv.ParseInt(fs.Arg(1), 10, 32)
+	if err != nil {
+		fs.Usage()
+		return 2
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	c, err := h.GetNodeContentById(int32(id), nil)
+	if err != nil {
+		return fail(err)
+	}
+	if *width <= 0 {
+		*width = terminalColumns()
+	}
+	w := bufio.NewWriter(os.Stdout)
+	err = ctb.RenderTerminal(w, c, ctb.TerminalOptions{Width: *width, TrueColor: *trueColor, NoColor: *noColor})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// terminalColumns 标准输出所在终端的宽度，无法获取时使用 COLUMNS 环境变量，默认 80
+func terminalColumns() int {
+	if _, cols, ok := terminalSize(os.Stdout); ok {
+		return cols
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return 80
+}
+
+func isTrueColorTerminal() bool {
+	v := strings.ToLower(os.Getenv("COLORTERM"))
+	return v == "truecolor" || v == "24bit"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runTables 导出文档中所有的表格
+func runTables(args []string) int {
+	fs := flag.NewFlagSet("tables", flag.ExitOnError)
+	format := fs.String("format", "csv", "output format: csv (one file per table) or xlsx (one workbook)")
+	out := fs.String("o", "", "output directory for csv, or output file for xlsx (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ctb tables [-format csv|xlsx] -o <dir|file.xlsx> doc.ctb")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" || (*format != "csv" && *format != "xlsx") {
+		fs.Usage()
+		return 2
+	}
+	h, ok := openHandle(fs.Arg(0))
+	if !ok {
+		return 2
+	}
+	if *format == "xlsx" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fail(err)
+		}
+		if err := h.ExportTablesXLSX(f); err != nil {
+			_ = f.Close()
+			return fail(err)
+		}
+		if err := f.Close(); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+	files, err := h.ExportTablesCSV(*out)
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// terminalSize 只在 Linux 上支持，其他平台依赖 COLUMNS/LINES 环境变量
+func terminalSize(f *os.File) (rows, cols int, ok bool) {
+	return 0, 0, false
+}
+
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode is only supported on linux")
+}
+
+func notifyResize(ch chan<- os.Signal) {}
@@ -18,28 +18,16 @@ import (
 	"unicode/utf8"
 )
 
-// Handle CTB查询句柄
+// Handle CTB查询句柄。Handle 只读取文档，可以长期持有并在多个协程中同时使用；不再需要时调用 Close
 type Handle struct {
 	db          *gorm.DB
 	CtbFilepath string
 }
 
+// NewHandle 以默认方式（读写、默认的锁与日志模式）打开 ctb 文件，失败时返回 nil；
+// 需要只读打开或其他选项时使用 OpenFile
 func NewHandle(filepath string) *Handle {
-	// 不打印sql
-	newLogger := logger.New(
-		log.StandardLogger(), // io writer
-		logger.Config{
-			SlowThreshold:             time.Second,   // Slow SQL threshold
-			LogLevel:                  logger.Silent, // Log level
-			IgnoreRecordNotFoundError: true,          // Ignore ErrRecordNotFound error for logger
-			Colorful:                  true,          // Disable color
-		},
-	)
-	// create sqlite handle
-	db, err := gorm.Open(sqlite.Open(filepath), &gorm.Config{
-		PrepareStmt: true,
-		Logger:      newLogger,
-	})
+	db, err := openDB(filepath)
 	if err != nil {
 		log.Errorf("An error occurred while creating the sqlite database handle for %v: %v", filepath, err)
 		return nil
@@ -51,6 +39,33 @@ func NewHandle(filepath string) *Handle {
 	return handle
 }
 
+// openDB 打开 sqlite 数据库
+func openDB(dsn string) (*gorm.DB, error) {
+	// create sqlite handle
+	return gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		PrepareStmt: true,
+		Logger:      dbLogger(),
+	})
+}
+
+// dbLogger 不打印sql
+func dbLogger() logger.Interface {
+	return logger.New(
+		log.StandardLogger(), // io writer
+		logger.Config{
+			SlowThreshold:             time.Second,   // Slow SQL threshold
+			LogLevel:                  logger.Silent, // Log level
+			IgnoreRecordNotFoundError: true,          // Ignore ErrRecordNotFound error for logger
+			Colorful:                  true,          // Disable color
+		},
+	)
+}
+
+// Close 关闭底层数据库连接。关闭后再查询会返回错误；重复关闭没有影响
+func (r Handle) Close() error {
+	return closeDB(r.db)
+}
+
 // GetTotalNodesCount 获取节点数量
 func (r Handle) GetTotalNodesCount() (int64, error) {
 	var a []tNode
@@ -147,7 +162,14 @@ func (r Handle) GetNodeContentById(id int32, pathToSaveBinary *string) (*CtNodeC
 		var tables []tGrid
 		r.db.Where("node_id = ?", id).Find(&tables)
 		for _, grid := range tables {
-			anchoredWidgets = append(anchoredWidgets, NewCtTable(&grid))
+			table, err := ParseCtTable(&grid)
+			if err != nil {
+				return nil, fmt.Errorf("node %d: %w", id, err)
+			}
+			if err := table.Validate(); err != nil {
+				log.Warnf("Table at offset %d of node %d: %v", grid.Offset, id, err)
+			}
+			anchoredWidgets = append(anchoredWidgets, table)
 		}
 		// images: png / embfile / anchor / latex
 		images, err := r.selectImagesByNodeId(id)
@@ -233,7 +255,7 @@ func (r Handle) GetNodeContentById(id int32, pathToSaveBinary *string) (*CtNodeC
 	{
 		err := xml.Unmarshal([]byte(raw.Txt), &xmlDocument)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("node %d: %w", id, err)
 		}
 		for _, e := range xmlDocument.RichTexts {
 			richTextNode := NewCtText(&e)
@@ -261,7 +283,7 @@ func (r Handle) GetNodeContentById(id int32, pathToSaveBinary *string) (*CtNodeC
 		}
 	}
 	// 与 anchored widgets 组合到一起
-	resultSet := [][]interface{}{{}} // 结果集，初始化一个空行
+	resultSet := CtRichText{{}} // 结果集，初始化一个空行
 	currentLineIndex = 0
 	var chars int32 = 0 // 记录当前字符数（配合偏移量来插入 anchored widget）
 	for len(texts) > 0 {
@@ -274,7 +296,7 @@ func (r Handle) GetNodeContentById(id int32, pathToSaveBinary *string) (*CtNodeC
 				currentLineIndex++
 				texts = texts[1:]
 				if len(texts) > 0 {
-					resultSet = append(resultSet, []interface{}{}) // 为下一行初始化空数组
+					resultSet = append(resultSet, CtLine{}) // 为下一行初始化空数组
 				}
 			}
 			texts = nil
@@ -293,7 +315,7 @@ func (r Handle) GetNodeContentById(id int32, pathToSaveBinary *string) (*CtNodeC
 		if len(texts[0]) == 0 {
 			texts = texts[1:]
 			currentLineIndex++
-			resultSet = append(resultSet, []interface{}{})
+			resultSet = append(resultSet, CtLine{})
 			chars++ // 隐含的 '\n'
 			continue
 		}
@@ -367,7 +389,9 @@ func (r Handle) GetNodeContentById(id int32, pathToSaveBinary *string) (*CtNodeC
 			}
 		}
 	}
-	ret.RichTexts = &resultSet
+	ret.Lines = resultSet
+	legacy := resultSet.Legacy()
+	ret.RichTexts = &legacy
 
 	return &ret, nil
 }
@@ -398,3 +422,70 @@ func (r Handle) GetNodeListFromRoot(id int32) ([]*CtNode, error) {
 	}
 	return ret, nil
 }
+
+// IsNotFound 判断错误是否由节点或附件不存在引起
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// GetAttachment 获取节点中指定偏移处的图片或附件（包含二进制数据），返回 *CtPng 或 *CtEmbFile
+func (r Handle) GetAttachment(id int32, offset int32) (CtAnchoredWidget, error) {
+	img, err := r.selectImageByOffset(id, offset)
+	if err != nil {
+		return nil, err
+	}
+	// 锚与 latex 没有可下载的内容
+	if img.Anchor != "" || img.Filename == "__ct_special.tex" {
+		return nil, fmt.Errorf("no attachment at offset %d of node %d: %w", offset, id, gorm.ErrRecordNotFound)
+	}
+	if img.Filename != "" {
+		return NewCtEmbFile(img, nil), nil
+	}
+	_png, err := png.DecodeConfig(bytes.NewReader(img.Png))
+	if err != nil {
+		return nil, err
+	}
+	return NewCtPng(img, _png.Width, _png.Height, nil), nil
+}
+
+// GetNodeLastSaveTime 获取节点最后保存时间（Unix 秒）
+func (r Handle) GetNodeLastSaveTime(id int32) (int32, error) {
+	return r.selectLastSaveTimeById(id)
+}
+
+// GetDocumentLastSaveTime 获取整个文档中最近的保存时间（Unix 秒）以及节点总数，可用于判断文档是否有变化
+func (r Handle) GetDocumentLastSaveTime() (int32, int64, error) {
+	return r.selectMaxLastSaveTime()
+}
+
+// SearchNodes 在节点名称、正文、代码框与表格中搜索关键字（ASCII 字母不区分大小写），按节点ID升序返回
+func (r Handle) SearchNodes(keyword string) ([]*CtNode, error) {
+	if keyword == "" {
+		return nil, nil
+	}
+	// 富文本以 xml 形式存储，转义后的关键字也需要匹配
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(keyword))
+	patterns := []string{likePattern(keyword)}
+	if escaped.String() != keyword {
+		patterns = append(patterns, likePattern(escaped.String()))
+	}
+	ids, err := r.selectNodeIdsByKeyword(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*CtNode
+	for _, id := range ids {
+		n, err := r.GetNodeById(id)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+func likePattern(keyword string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(keyword) + "%"
+}
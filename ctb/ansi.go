@@ -0,0 +1,186 @@
+package ctb
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const ansiReset = "\x1b[0m"
+
+// rgbColor 24 位颜色
+type rgbColor struct {
+	r, g, b uint8
+}
+
+// parseColor 解析 "#rrggbb" 以及 CherryTree 使用的 "#rrrrggggbbbb" 格式
+func parseColor(s string) (rgbColor, bool) {
+	s = strings.TrimPrefix(s, "#")
+	var parts [3]string
+	switch len(s) {
+	case 6:
+		parts = [3]string{s[0:2], s[2:4], s[4:6]}
+	case 12:
+		parts = [3]string{s[0:2], s[4:6], s[8:10]}
+	default:
+		return rgbColor{}, false
+	}
+	var c [3]uint8
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 16, 8)
+		if err != nil {
+			return rgbColor{}, false
+		}
+		c[i] = uint8(v)
+	}
+	return rgbColor{c[0], c[1], c[2]}, true
+}
+
+// ansi256 最接近的 256 色编号（6x6x6 色块或者灰阶）
+func (c rgbColor) ansi256() int {
+	level := func(v uint8) int {
+		if v < 48 {
+			return 0
+		}
+		if v < 115 {
+			return 1
+		}
+		return int(v-35) / 40
+	}
+	r, g, b := level(c.r), level(c.g), level(c.b)
+	steps := []int{0, 95, 135, 175, 215, 255}
+	cube := 16 + 36*r + 6*g + b
+	dist := func(x, y, z int) int {
+		dr, dg, db := x-int(c.r), y-int(c.g), z-int(c.b)
+		return dr*dr + dg*dg + db*db
+	}
+	cubeDist := dist(steps[r], steps[g], steps[b])
+	avg := (int(c.r) + int(c.g) + int(c.b)) / 3
+	grey := 23
+	if avg < 238 {
+		grey = (avg - 3) / 10
+		if grey < 0 {
+			grey = 0
+		}
+	}
+	gv := 8 + 10*grey
+	if dist(gv, gv, gv) < cubeDist {
+		return 232 + grey
+	}
+	return cube
+}
+
+// ansiStyle 终端文本样式
+type ansiStyle struct {
+	fg, bg                                        *rgbColor
+	bold, dim, italic, underline, strike, reverse bool
+}
+
+// sgr 样式对应的 SGR 转义序列，没有任何样式时为空串
+func (s ansiStyle) sgr(trueColor bool) string {
+	var codes []string
+	if s.bold {
+		codes = append(codes, "1")
+	}
+	if s.dim {
+		codes = append(codes, "2")
+	}
+	if s.italic {
+		codes = append(codes, "3")
+	}
+	if s.underline {
+		codes = append(codes, "4")
+	}
+	if s.reverse {
+		codes = append(codes, "7")
+	}
+	if s.strike {
+		codes = append(codes, "9")
+	}
+	color := func(base int, c *rgbColor) {
+		if c == nil {
+			return
+		}
+		if trueColor {
+			codes = append(codes, fmt.Sprintf("%d;2;%d;%d;%d", base, c.r, c.g, c.b))
+		} else {
+			codes = append(codes, fmt.Sprintf("%d;5;%d", base, c.ansi256()))
+		}
+	}
+	color(38, s.fg)
+	color(48, s.bg)
+	if len(codes) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+func rgb(v uint32) *rgbColor {
+	return &rgbColor{uint8(v >> 16), uint8(v >> 8), uint8(v)}
+}
+
+// tokenStyles 代码片段的终端样式，颜色与 CodeHTMLStyleSheet 一致
+var tokenStyles = map[TokenKind]ansiStyle{
+	TokenKeyword:  {fg: rgb(0xa52a2a), bold: true},
+	TokenType:     {fg: rgb(0x2e8b57), bold: true},
+	TokenBuiltin:  {fg: rgb(0x008a8c)},
+	TokenFunction: {fg: rgb(0x008a8c)},
+	TokenString:   {fg: rgb(0xff00ff)},
+	TokenNumber:   {fg: rgb(0xff00ff)},
+	TokenComment:  {fg: rgb(0x0000ff)},
+	TokenPreproc:  {fg: rgb(0xa020f0)},
+	TokenError:    {fg: rgb(0xff0000), underline: true},
+	TokenInserted: {fg: rgb(0x008b00)},
+	TokenDeleted:  {fg: rgb(0xcd0000)},
+	TokenHeading:  {bold: true},
+	TokenBrace:    {bold: true},
+}
+
+// unmatchedBraceStyle 没有配对的括号
+var unmatchedBraceStyle = ansiStyle{bg: rgb(0xff6666), bold: true}
+
+// highlightLinesANSI 带 ANSI 样式的代码行（不含换行符），每行末尾都会重置样式
+func highlightLinesANSI(code, language string, opts HighlightOptions) ([]string, error) {
+	tokens, err := HighlightCode(code, language, opts)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitTokenLines(tokens)
+	width := len(fmt.Sprint(len(lines)))
+	gutter := ansiStyle{dim: true}.sgr(opts.TrueColor)
+	ret := make([]string, 0, len(lines))
+	for i, line := range lines {
+		var sb strings.Builder
+		if opts.ShowLineNumbers {
+			fmt.Fprintf(&sb, "%s%*d │%s ", gutter, width, i+1, ansiReset)
+		}
+		for _, t := range line {
+			style := tokenStyles[t.Kind]
+			if t.Kind == TokenBrace && t.Pair == 0 {
+				style = unmatchedBraceStyle
+			}
+			if seq := style.sgr(opts.TrueColor); seq != "" {
+				sb.WriteString(seq + t.Text + ansiReset)
+			} else {
+				sb.WriteString(t.Text)
+			}
+		}
+		ret = append(ret, sb.String())
+	}
+	return ret, nil
+}
+
+// RenderCodeANSI 将代码渲染为带 ANSI 颜色的终端文本
+func RenderCodeANSI(w io.Writer, code, language string, opts HighlightOptions) error {
+	lines, err := highlightLinesANSI(code, language, opts)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
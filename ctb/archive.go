@@ -0,0 +1,105 @@
+package ctb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"gorm.io/gorm"
+)
+
+// ErrArchivePassword 密码错误，或者加密的文档已损坏
+var ErrArchivePassword = errors.New("wrong password or damaged archive")
+
+// IsArchive 是否为 CherryTree 加密保存的文档：.ctz（内含 .ctd）或 .ctx（内含 .ctb），都是 7-Zip 格式
+func IsArchive(filepath string) bool {
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".ctz", ".ctx":
+		return true
+	}
+	return false
+}
+
+// OpenArchive 用密码打开 .ctz 或 .ctx 文档。解密后的内容只保存在内存中，
+// 返回的 Handle 与 NewHandle 的用法相同；需要解密后的文件时使用 ExtractArchive
+func OpenArchive(filepath, password string) (*Handle, error) {
+	name, data, err := readArchiveDocument(filepath, password)
+	if err != nil {
+		return nil, err
+	}
+	var db *gorm.DB
+	if strings.EqualFold(path.Ext(name), ".ctb") {
+		db, err = openDBFromBytes(data)
+	} else {
+		var doc *rawDocument
+		if doc, err = readCTD(bytes.NewReader(data)); err == nil {
+			db, err = openDBFromDocument(doc)
+		}
+	}
+	// 明文已经复制到 sqlite 的内存数据库中
+	for i := range data {
+		data[i] = 0
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s: %w", filepath, name, err)
+	}
+	return &Handle{db: db, CtbFilepath: filepath}, nil
+}
+
+// ExtractArchive 解密 .ctz 或 .ctx 文档，写为 outPath；outPath 的扩展名决定写为 .ctb 还是 .ctd
+func ExtractArchive(filepath, password, outPath string) error {
+	h, err := OpenArchive(filepath, password)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	doc, err := h.loadRawDocument()
+	if err != nil {
+		return err
+	}
+	return writeRawDocument(outPath, doc)
+}
+
+// readArchiveDocument 解密并读出压缩包中的 .ctd 或 .ctb 文件
+func readArchiveDocument(filepath, password string) (string, []byte, error) {
+	r, err := sevenzip.OpenReaderWithPassword(filepath, password)
+	if err != nil {
+		return "", nil, archiveError(filepath, err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".ctd", ".ctb":
+		default:
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", nil, archiveError(filepath, err)
+		}
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return "", nil, archiveError(filepath, err)
+		}
+		// 密码错误时解密出的内容通常也能解压，只有校验和不对
+		if f.CRC32 != 0 && crc32.ChecksumIEEE(data) != f.CRC32 {
+			return "", nil, fmt.Errorf("%v: %w", filepath, ErrArchivePassword)
+		}
+		return f.Name, data, nil
+	}
+	return "", nil, fmt.Errorf("%v: no .ctd or .ctb document in the archive", filepath)
+}
+
+func archiveError(filepath string, err error) error {
+	var re *sevenzip.ReadError
+	if errors.As(err, &re) && re.Encrypted {
+		return fmt.Errorf("%v: %w", filepath, ErrArchivePassword)
+	}
+	return fmt.Errorf("%v: %w", filepath, err)
+}
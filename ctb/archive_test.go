@@ -0,0 +1,186 @@
+package ctb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// write7z 写入只包含一个文件的 7-Zip 压缩包，与 CherryTree 一样用 AES-256 加密内容（不压缩），文件头不加密
+func write7z(t *testing.T, path, name string, data []byte, password string) {
+	t.Helper()
+	const cycles = 10 // 密钥推导的轮数为 2^cycles；CherryTree 使用 7-Zip 的默认值 19
+	iv := []byte("0123456789abcdef")
+	// 密钥：对 UTF-16LE 的密码加上轮次计数反复计算 SHA-256（没有 salt）
+	var pw []byte
+	for _, c := range utf16.Encode([]rune(password)) {
+		pw = binary.LittleEndian.AppendUint16(pw, c)
+	}
+	h := sha256.New()
+	for i := uint64(0); i < 1<<cycles; i++ {
+		h.Write(pw)
+		_ = binary.Write(h, binary.LittleEndian, i)
+	}
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := append([]byte(nil), data...)
+	if n := len(packed) % aes.BlockSize; n != 0 {
+		packed = append(packed, make([]byte, aes.BlockSize-n)...)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(packed, packed)
+
+	var hdr bytes.Buffer
+	number := func(v uint64) {
+		// 首字节开头的 1 的个数表示后面还有几个字节
+		for n := 0; n < 8; n++ {
+			if v < 1<<(7*(n+1)) {
+				hdr.WriteByte(byte(0xff<<(8-n)) | byte(v>>(8*n)))
+				for i := 0; i < n; i++ {
+					hdr.WriteByte(byte(v >> (8 * i)))
+				}
+				return
+			}
+		}
+		hdr.WriteByte(0xff)
+		_ = binary.Write(&hdr, binary.LittleEndian, v)
+	}
+	hdr.Write([]byte{0x01, 0x04}) // Header, MainStreamsInfo
+	hdr.Write([]byte{0x06, 0, 1, 0x09})
+	number(uint64(len(packed)))
+	hdr.WriteByte(0x00)
+	hdr.Write([]byte{0x07, 0x0b, 1, 0}) // UnpackInfo：一个 folder
+	props := append([]byte{0x40 | cycles, 0x0f}, iv...)
+	hdr.Write([]byte{1, 0x24, 0x06, 0xf1, 0x07, 0x01}) // 一个带属性的 AES 编码器
+	number(uint64(len(props)))
+	hdr.Write(props)
+	hdr.WriteByte(0x0c)
+	number(uint64(len(data)))
+	hdr.WriteByte(0x00)
+	hdr.Write([]byte{0x08, 0x0a, 1}) // SubStreamsInfo：文件的 CRC
+	_ = binary.Write(&hdr, binary.LittleEndian, crc32.ChecksumIEEE(data))
+	hdr.Write([]byte{0x00, 0x00})
+	var names []byte
+	for _, c := range utf16.Encode([]rune(name + "\x00")) {
+		names = binary.LittleEndian.AppendUint16(names, c)
+	}
+	hdr.Write([]byte{0x05, 1, 0x11}) // FilesInfo：一个文件的名称
+	number(uint64(len(names) + 1))
+	hdr.WriteByte(0)
+	hdr.Write(names)
+	hdr.Write([]byte{0x00, 0x00})
+
+	var start [20]byte
+	binary.LittleEndian.PutUint64(start[0:], uint64(len(packed)))
+	binary.LittleEndian.PutUint64(start[8:], uint64(hdr.Len()))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(hdr.Bytes()))
+	var out bytes.Buffer
+	out.Write([]byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0, 4})
+	_ = binary.Write(&out, binary.LittleEndian, crc32.ChecksumIEEE(start[:]))
+	out.Write(start[:])
+	out.Write(packed)
+	out.Write(hdr.Bytes())
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	var ctd bytes.Buffer
+	if err := writeCTD(&ctd, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := filepath.Join(dir, "notes.ctx")
+	write7z(t, ctx, "notes.ctb", sampleBytes(t, false), "密码 secret")
+	ctz := filepath.Join(dir, "notes.ctz")
+	write7z(t, ctz, "notes.ctd", ctd.Bytes(), "密码 secret")
+
+	for _, p := range []string{ctx, ctz} {
+		h, err := OpenArchive(p, "密码 secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSample(t, h)
+		if h.CtbFilepath != p {
+			t.Errorf("CtbFilepath = %q", h.CtbFilepath)
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, password := range []string{"secret", ""} {
+			if h, err := OpenArchive(p, password); !errors.Is(err, ErrArchivePassword) {
+				if err == nil {
+					h.Close()
+				}
+				t.Errorf("%s with password %q: %v", filepath.Base(p), password, err)
+			}
+		}
+	}
+
+	// 解密后写为 .ctb 或 .ctd
+	for _, out := range []string{"plain.ctb", "plain.ctd"} {
+		out = filepath.Join(dir, out)
+		if err := ExtractArchive(ctz, "密码 secret", out); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadRawDocumentFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareRawDocuments(sampleDocument(), got); err != nil {
+			t.Errorf("%s: %v", out, err)
+		}
+	}
+	if err := ExtractArchive(ctz, "wrong", filepath.Join(dir, "wrong.ctb")); !errors.Is(err, ErrArchivePassword) {
+		t.Errorf("ExtractArchive with a wrong password: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "wrong.ctb")); !os.IsNotExist(err) {
+		t.Errorf("ExtractArchive with a wrong password wrote the output: %v", err)
+	}
+}
+
+func TestOpenArchiveErrors(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other.ctz")
+	write7z(t, other, "readme.txt", []byte("hello"), "pw")
+	if _, err := OpenArchive(other, "pw"); err == nil || !strings.Contains(err.Error(), "no .ctd or .ctb document") {
+		t.Errorf("archive without a document: %v", err)
+	}
+	damaged := filepath.Join(dir, "damaged.ctx")
+	write7z(t, damaged, "notes.ctb", []byte("not a database"), "pw")
+	if _, err := OpenArchive(damaged, "pw"); err == nil || errors.Is(err, ErrArchivePassword) {
+		t.Errorf("archive with a damaged document: %v", err)
+	}
+	if _, err := OpenArchive(filepath.Join(dir, "missing.ctz"), "pw"); err == nil {
+		t.Error("opened a missing archive")
+	}
+	plain := filepath.Join(dir, "plain.ctz")
+	if err := os.WriteFile(plain, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenArchive(plain, "pw"); err == nil {
+		t.Error("opened a file that is not an archive")
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.ctz": true, "a.CTX": true, "dir.ctz/a.ctb": false, "a.ctb": false, "a.ctd": false, "a.7z": false, "ctz": false,
+	} {
+		if got := IsArchive(name); got != want {
+			t.Errorf("IsArchive(%q) = %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package ctb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// CherryTree 新建代码框与表格时的默认尺寸
+	defaultCodeBoxWidth  = 500
+	defaultCodeBoxHeight = 100
+	defaultGridColMin    = 40
+	defaultGridColMax    = 400
+)
+
+// widgetRune 锚定元素在 richTextBuilder.tail 中的占位字符
+const widgetRune = '\uFFFC'
+
+// richTextBuilder 依次追加文本与锚定元素，生成节点的 txt 以及各锚定元素的偏移量
+type richTextBuilder struct {
+	runs      []XmlRichText
+	chars     int32  // 当前字符数（每个锚定元素占一个字符）
+	tail      []rune // 最后几个字符，锚定元素记为 widgetRune
+	codeBoxes []tCodeBox
+	grids     []tGrid
+	images    []tImage
+}
+
+// text 追加一段文本；样式与上一段相同时合并
+func (b *richTextBuilder) text(s string, style XmlRichText) {
+	if s == "" {
+		return
+	}
+	b.appendTail([]rune(s)...)
+	style.Text = ""
+	if n := len(b.runs); n > 0 {
+		last := b.runs[n-1]
+		last.Text = ""
+		if last == style {
+			b.runs[n-1].Text += s
+			b.chars += int32(utf8.RuneCountInString(s))
+			return
+		}
+	}
+	style.Text = s
+	b.runs = append(b.runs, style)
+	b.chars += int32(utf8.RuneCountInString(s))
+}
+
+// endsWith 已经追加的文本是否以 s 结尾
+func (b *richTextBuilder) endsWith(s string) bool {
+	return strings.HasSuffix(string(b.tail), s)
+}
+
+func (b *richTextBuilder) appendTail(r ...rune) {
+	const max = 8
+	b.tail = append(b.tail, r...)
+	if len(b.tail) > max {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-max:]...)
+	}
+}
+
+// empty 是否还没有任何内容
+func (b *richTextBuilder) empty() bool {
+	return b.chars == 0
+}
+
+func (b *richTextBuilder) codeBox(code, syntax string) {
+	b.codeBoxes = append(b.codeBoxes, tCodeBox{
+		Offset:            b.chars,
+		Justification:     "left",
+		Txt:               code,
+		Syntax:            syntax,
+		Width:             defaultCodeBoxWidth,
+		Height:            defaultCodeBoxHeight,
+		IsWidthPixel:      1,
+		DoHighlightBraces: 1,
+	})
+	b.chars++
+	b.appendTail(widgetRune)
+}
+
+// grid 追加表格，rows 的第一行为表头
+func (b *richTextBuilder) grid(rows [][]string) {
+	b.grids = append(b.grids, tGrid{
+		Offset:        b.chars,
+		Justification: "left",
+		Txt:           marshalGrid(rows, nil, false),
+		ColMin:        defaultGridColMin,
+		ColMax:        defaultGridColMax,
+	})
+	b.chars++
+	b.appendTail(widgetRune)
+}
+
+func (b *richTextBuilder) png(data []byte, link string) {
+	b.images = append(b.images, tImage{
+		Offset:        b.chars,
+		Justification: "left",
+		Png:           data,
+		Link:          link,
+	})
+	b.chars++
+	b.appendTail(widgetRune)
+}
+
+func (b *richTextBuilder) embFile(data []byte, filename string, t time.Time) {
+	b.images = append(b.images, tImage{
+		Offset:        b.chars,
+		Justification: "left",
+		Png:           data,
+		Filename:      filename,
+		Time:          int32(t.Unix()),
+	})
+	b.chars++
+	b.appendTail(widgetRune)
+}
+
+// build 生成富文本节点
+func (b *richTextBuilder) build(n *rawNode) {
+	// 去掉末尾多余的换行（锚定元素之后的文本不能去掉）
+	for len(b.runs) > 0 {
+		last := &b.runs[len(b.runs)-1]
+		trimmed := strings.TrimRight(last.Text, "\n")
+		if b.lastWidgetOffset() >= b.chars-int32(utf8.RuneCountInString(last.Text))+int32(utf8.RuneCountInString(trimmed)) {
+			break
+		}
+		b.chars -= int32(utf8.RuneCountInString(last.Text) - utf8.RuneCountInString(trimmed))
+		last.Text = trimmed
+		if trimmed != "" {
+			break
+		}
+		b.runs = b.runs[:len(b.runs)-1]
+	}
+	n.node.Txt = marshalXmlDocument(&XmlDocument{RichTexts: b.runs})
+	n.node.Syntax = CtNodeSyntaxRichText
+	n.node.IsRichtxt |= 1
+	n.codeBoxes = b.codeBoxes
+	n.grids = b.grids
+	n.images = b.images
+}
+
+func (b *richTextBuilder) lastWidgetOffset() int32 {
+	last := int32(-1)
+	for _, c := range b.codeBoxes {
+		if c.Offset > last {
+			last = c.Offset
+		}
+	}
+	for _, g := range b.grids {
+		if g.Offset > last {
+			last = g.Offset
+		}
+	}
+	for _, img := range b.images {
+		if img.Offset > last {
+			last = img.Offset
+		}
+	}
+	return last
+}
+
+// marshalGrid 生成 grid 表的 txt；CherryTree 把表头存放在最后一行
+func marshalGrid(rows [][]string, colWidths []int, isLight bool) string {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	widths := make([]string, cols)
+	for i := range widths {
+		widths[i] = "0"
+		if i < len(colWidths) {
+			widths[i] = fmt.Sprint(colWidths[i])
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	fmt.Fprintf(&sb, `<table col_widths="%s" is_light="%d">`, strings.Join(widths, ","), boolToInt32(isLight))
+	writeRow := func(row []string) {
+		sb.WriteString("<row>")
+		for i := 0; i < cols; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			sb.WriteString("<cell>" + xmlTextEscaper.Replace(cell) + "</cell>")
+		}
+		sb.WriteString("</row>")
+	}
+	if len(rows) > 0 {
+		for _, row := range rows[1:] {
+			writeRow(row)
+		}
+		writeRow(rows[0])
+	}
+	sb.WriteString("</table>")
+	return sb.String()
+}
+
+// newRawNode 新建节点，创建与修改时间都取 t
+func newRawNode(id, fatherId, sequence int32, name string, t time.Time) *rawNode {
+	return &rawNode{
+		node: tNode{
+			NodeId:     id,
+			Name:       name,
+			Syntax:     CtNodeSyntaxRichText,
+			IsRichtxt:  1,
+			TsCreation: int32(t.Unix()),
+			TsLastsave: int32(t.Unix()),
+			Txt:        xmlHeader + "<node/>",
+		},
+		pos: tChildren{NodeId: id, FatherId: fatherId, Sequence: sequence},
+	}
+}
@@ -0,0 +1,219 @@
+package ctb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CtElement 富文本中的元素：*CtText，或者某种附件类元素（*CtCodeBox、*CtTable、*CtPng、*CtEmbFile、*CtAnchor）。
+// 接口是封闭的，只有本包中的类型能实现，可以通过类型断言或者 CtVisitor 处理
+type CtElement interface {
+	GetType() string
+	Accept(v CtVisitor) error
+	ctElement()
+}
+
+// CtLine 一行（段落）中按顺序排列的元素，不包含换行符
+type CtLine []CtElement
+
+// CtRichText 富文本内容，按行组织
+type CtRichText []CtLine
+
+// CtVisitor 按顺序访问富文本中的元素；任何一个方法返回错误都会中止遍历
+type CtVisitor interface {
+	VisitText(t *CtText) error
+	VisitCodeBox(c *CtCodeBox) error
+	VisitTable(t *CtTable) error
+	VisitPng(p *CtPng) error
+	VisitEmbFile(f *CtEmbFile) error
+	VisitAnchor(a *CtAnchor) error
+	// VisitLineBreak 在两行之间调用
+	VisitLineBreak() error
+}
+
+// CtVisitorFuncs 用函数实现 CtVisitor，没有设置的函数会被跳过
+type CtVisitorFuncs struct {
+	Text      func(t *CtText) error
+	CodeBox   func(c *CtCodeBox) error
+	Table     func(t *CtTable) error
+	Png       func(p *CtPng) error
+	EmbFile   func(f *CtEmbFile) error
+	Anchor    func(a *CtAnchor) error
+	LineBreak func() error
+}
+
+func (f CtVisitorFuncs) VisitText(t *CtText) error {
+	if f.Text == nil {
+		return nil
+	}
+	return f.Text(t)
+}
+
+func (f CtVisitorFuncs) VisitCodeBox(c *CtCodeBox) error {
+	if f.CodeBox == nil {
+		return nil
+	}
+	return f.CodeBox(c)
+}
+
+func (f CtVisitorFuncs) VisitTable(t *CtTable) error {
+	if f.Table == nil {
+		return nil
+	}
+	return f.Table(t)
+}
+
+func (f CtVisitorFuncs) VisitPng(p *CtPng) error {
+	if f.Png == nil {
+		return nil
+	}
+	return f.Png(p)
+}
+
+func (f CtVisitorFuncs) VisitEmbFile(e *CtEmbFile) error {
+	if f.EmbFile == nil {
+		return nil
+	}
+	return f.EmbFile(e)
+}
+
+func (f CtVisitorFuncs) VisitAnchor(a *CtAnchor) error {
+	if f.Anchor == nil {
+		return nil
+	}
+	return f.Anchor(a)
+}
+
+func (f CtVisitorFuncs) VisitLineBreak() error {
+	if f.LineBreak == nil {
+		return nil
+	}
+	return f.LineBreak()
+}
+
+// Walk 按顺序访问所有元素
+func (rt CtRichText) Walk(v CtVisitor) error {
+	for i, line := range rt {
+		if i > 0 {
+			if err := v.VisitLineBreak(); err != nil {
+				return err
+			}
+		}
+		for _, e := range line {
+			if err := e.Accept(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Legacy 转换为 CtNodeContent.RichTexts 原有的形式
+func (rt CtRichText) Legacy() [][]interface{} {
+	ret := make([][]interface{}, len(rt))
+	for i, line := range rt {
+		ret[i] = make([]interface{}, len(line))
+		for j, e := range line {
+			ret[i][j] = e
+		}
+	}
+	return ret
+}
+
+// UnmarshalJSON 根据元素的 type 字段解析为对应的类型
+func (rt *CtRichText) UnmarshalJSON(data []byte) error {
+	var lines [][]json.RawMessage
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	ret := make(CtRichText, len(lines))
+	for i, line := range lines {
+		ret[i] = make(CtLine, 0, len(line))
+		for j, raw := range line {
+			e, err := unmarshalCtElement(raw)
+			if err != nil {
+				return fmt.Errorf("richTexts[%d][%d]: %w", i, j, err)
+			}
+			ret[i] = append(ret[i], e)
+		}
+	}
+	*rt = ret
+	return nil
+}
+
+func unmarshalCtElement(data []byte) (CtElement, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+	var e CtElement
+	switch head.Type {
+	case CtDocElementText:
+		e = &CtText{}
+	case CtDocElementCodeBox:
+		e = &CtCodeBox{}
+	case CtDocElementTable:
+		e = &CtTable{}
+	case CtDocElementPng:
+		e = &CtPng{}
+	case CtDocElementEmbFile:
+		e = &CtEmbFile{}
+	case CtDocElementAnchor:
+		e = &CtAnchor{}
+	default:
+		return nil, fmt.Errorf("unknown element type %q", head.Type)
+	}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// MarshalJSON richTexts 优先使用 Lines，没有时使用 RichTexts
+func (c CtNodeContent) MarshalJSON() ([]byte, error) {
+	type plain CtNodeContent
+	v := struct {
+		plain
+		RichTexts interface{} `json:"richTexts,omitempty"`
+	}{plain: plain(c)}
+	if c.Lines != nil {
+		v.RichTexts = c.Lines
+	} else if c.RichTexts != nil {
+		v.RichTexts = c.RichTexts
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON 解析 richTexts 为带类型的 Lines，同时填充兼容的 RichTexts
+func (c *CtNodeContent) UnmarshalJSON(data []byte) error {
+	type plain CtNodeContent
+	var v struct {
+		plain
+		RichTexts *CtRichText `json:"richTexts,omitempty"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*c = CtNodeContent(v.plain)
+	if v.RichTexts != nil {
+		c.Lines = *v.RichTexts
+		legacy := c.Lines.Legacy()
+		c.RichTexts = &legacy
+	}
+	return nil
+}
+
+func (t *CtText) GetType() string { return t.Type }
+
+func (*CtText) ctElement() {}
+
+func (e _CtAnchoredWidgetMixin) ctElement() {}
+
+func (t *CtText) Accept(v CtVisitor) error    { return v.VisitText(t) }
+func (c *CtCodeBox) Accept(v CtVisitor) error { return v.VisitCodeBox(c) }
+func (t *CtTable) Accept(v CtVisitor) error   { return v.VisitTable(t) }
+func (p *CtPng) Accept(v CtVisitor) error     { return v.VisitPng(p) }
+func (f *CtEmbFile) Accept(v CtVisitor) error { return v.VisitEmbFile(f) }
+func (a *CtAnchor) Accept(v CtVisitor) error  { return v.VisitAnchor(a) }
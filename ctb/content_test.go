@@ -0,0 +1,136 @@
+package ctb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openDocument 把 doc 写入临时文件后只读打开，测试结束时关闭
+func openDocument(t *testing.T, doc *rawDocument) *Handle {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "doc.ctb")
+	if err := writeRawDocument(p, doc); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenFile(p, OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = h.Close()
+	})
+	return h
+}
+
+func TestCtRichTextJSONRoundTrip(t *testing.T) {
+	h := openDocument(t, sampleDocument())
+	c, err := h.GetNodeContentById(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got CtNodeContent
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Lines, c.Lines) {
+		t.Errorf("lines differ after the round trip:\n got %s\nwant %s", describeLines(got.Lines), describeLines(c.Lines))
+	}
+	if got.RichTexts == nil || !reflect.DeepEqual(*got.RichTexts, c.Lines.Legacy()) {
+		t.Error("RichTexts is not filled from the lines")
+	}
+	got.Lines, got.RichTexts, c.Lines, c.RichTexts = nil, nil, nil, nil
+	if !reflect.DeepEqual(got, *c) {
+		t.Errorf("got %+v, want %+v", got, *c)
+	}
+	// 每种元素都出现过
+	for _, typ := range []string{CtDocElementText, CtDocElementCodeBox, CtDocElementTable, CtDocElementPng, CtDocElementEmbFile, CtDocElementAnchor} {
+		if !strings.Contains(string(data), `"type":"`+typ+`"`) {
+			t.Errorf("no element of type %s:\n%s", typ, data)
+		}
+	}
+
+	// 只有兼容的 RichTexts 时也输出 richTexts
+	legacy := [][]interface{}{{&CtText{Type: CtDocElementText, XmlRichText: XmlRichText{Text: "a"}}}}
+	data, err = json.Marshal(CtNodeContent{IsRichText: true, RichTexts: &legacy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"richTexts":[[{"type":"text","text":"a"}]]`) {
+		t.Errorf("legacy richTexts: %s", data)
+	}
+}
+
+// describeLines 逐个元素输出，便于比较
+func describeLines(rt CtRichText) string {
+	var sb strings.Builder
+	for i, line := range rt {
+		for _, e := range line {
+			fmt.Fprintf(&sb, "%d:%+v ", i, e)
+		}
+	}
+	return sb.String()
+}
+
+func TestCtRichTextUnmarshalErrors(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{`[[{"type":"video"}]]`, `richTexts[0][0]: unknown element type "video"`},
+		{`[[],[{"type":"text","text":"a"},{"type":"grid","data":1}]]`, `richTexts[1][1]: json: cannot unmarshal number`},
+		{`[{"type":"text"}]`, `json: cannot unmarshal object`},
+	} {
+		var rt CtRichText
+		if err := json.Unmarshal([]byte(tt.in), &rt); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestCtRichTextWalk(t *testing.T) {
+	rt := CtRichText{
+		{&CtText{XmlRichText: XmlRichText{Text: "a"}}, &CtCodeBox{Code: "b"}},
+		{},
+		{&CtTable{}, &CtPng{}, &CtEmbFile{Filename: "f"}, &CtAnchor{Name: "x"}},
+	}
+	var got []string
+	record := func(s string) error {
+		got = append(got, s)
+		return nil
+	}
+	v := CtVisitorFuncs{
+		Text:      func(t *CtText) error { return record("text " + t.Text) },
+		CodeBox:   func(c *CtCodeBox) error { return record("code " + c.Code) },
+		Table:     func(*CtTable) error { return record("table") },
+		Png:       func(*CtPng) error { return record("png") },
+		EmbFile:   func(f *CtEmbFile) error { return record("file " + f.Filename) },
+		Anchor:    func(a *CtAnchor) error { return record("anchor " + a.Name) },
+		LineBreak: func() error { return record("\n") },
+	}
+	if err := rt.Walk(v); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"text a", "code b", "\n", "\n", "table", "png", "file f", "anchor x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// 没有设置的函数被跳过，返回的错误中止遍历
+	got = nil
+	stop := errors.New("stop")
+	err := rt.Walk(CtVisitorFuncs{
+		Png: func(*CtPng) error { return stop },
+		EmbFile: func(*CtEmbFile) error {
+			return record("file")
+		},
+	})
+	if err != stop || got != nil {
+		t.Errorf("Walk returned %v, visited %q", err, got)
+	}
+}
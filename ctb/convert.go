@@ -0,0 +1,215 @@
+package ctb
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 文档的存储格式，由文件扩展名决定
+const (
+	FormatCTB = "ctb" // SQLite
+	FormatCTD = "ctd" // XML
+)
+
+// DocumentFormat 根据扩展名判断文档格式
+func DocumentFormat(filepath string) (string, error) {
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".ctb":
+		return FormatCTB, nil
+	case ".ctd":
+		return FormatCTD, nil
+	}
+	return "", fmt.Errorf("%v: unsupported document format, expected .ctb or .ctd", filepath)
+}
+
+// Convert 在 ctb 与 ctd 格式之间转换文档，格式由扩展名决定。
+// 节点ID、节点顺序、节点属性、标签、时间戳、书签与所有锚定元素都原样保留；
+// 先写入同一目录下的临时文件，重新读取并与源文档比较，一致时才替换 dstPath，不一致时 dstPath 原有的文件不受影响
+func Convert(srcPath, dstPath string) error {
+	format, err := DocumentFormat(dstPath)
+	if err != nil {
+		return err
+	}
+	src, err := loadRawDocumentFile(srcPath)
+	if err != nil {
+		return err
+	}
+	return writeRawDocumentChecked(dstPath, src, func(tmpPath string) error {
+		dst, err := loadRawDocumentFormat(tmpPath, format)
+		if err == nil {
+			err = compareRawDocuments(src, dst)
+		}
+		if err != nil {
+			return fmt.Errorf("verify %v: %w", dstPath, err)
+		}
+		return nil
+	})
+}
+
+// loadRawDocumentFile 按扩展名读取 ctb 或 ctd 文档
+func loadRawDocumentFile(filepath string) (*rawDocument, error) {
+	format, err := DocumentFormat(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return loadRawDocumentFormat(filepath, format)
+}
+
+// loadRawDocumentFormat 按指定的格式读取文档，不看扩展名
+func loadRawDocumentFormat(filepath, format string) (*rawDocument, error) {
+	if format == FormatCTD {
+		return readCTDFile(filepath)
+	}
+	h, err := OpenFile(filepath, OpenOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+	return h.loadRawDocument()
+}
+
+// compareRawDocuments 比较两个文档在格式转换中应当保持不变的部分，返回第一处差异。
+// 兄弟节点只比较先后顺序，富文本只比较解析后的片段
+func compareRawDocuments(a, b *rawDocument) error {
+	if len(a.nodes) != len(b.nodes) {
+		return fmt.Errorf("%d nodes, want %d", len(b.nodes), len(a.nodes))
+	}
+	for _, id := range a.sortedIds() {
+		an, bn := a.nodes[id], b.nodes[id]
+		if bn == nil {
+			return fmt.Errorf("node %d is missing", id)
+		}
+		if err := compareRawNodes(an, bn); err != nil {
+			return fmt.Errorf("node %d: %w", id, err)
+		}
+		if !reflect.DeepEqual(childIds(a, id), childIds(b, id)) {
+			return fmt.Errorf("node %d: children %v, want %v", id, childIds(b, id), childIds(a, id))
+		}
+	}
+	if !reflect.DeepEqual(childIds(a, 0), childIds(b, 0)) {
+		return fmt.Errorf("top-level nodes %v, want %v", childIds(b, 0), childIds(a, 0))
+	}
+	if fmt.Sprint(a.bookmarks) != fmt.Sprint(b.bookmarks) {
+		return fmt.Errorf("bookmarks %v, want %v", b.bookmarks, a.bookmarks)
+	}
+	return nil
+}
+
+func childIds(d *rawDocument, fatherId int32) []int32 {
+	var ids []int32
+	for _, n := range d.children(fatherId) {
+		ids = append(ids, n.node.NodeId)
+	}
+	return ids
+}
+
+func compareRawNodes(a, b *rawNode) error {
+	diff := func(what string, got, want interface{}) error {
+		return fmt.Errorf("%s %v, want %v", what, got, want)
+	}
+	switch {
+	case a.node.Name != b.node.Name:
+		return diff("name", fmt.Sprintf("%q", b.node.Name), fmt.Sprintf("%q", a.node.Name))
+	case a.node.Tags != b.node.Tags:
+		return diff("tags", fmt.Sprintf("%q", b.node.Tags), fmt.Sprintf("%q", a.node.Tags))
+	case a.node.IsRo != b.node.IsRo:
+		return diff("is_ro", b.node.IsRo, a.node.IsRo)
+	case a.node.IsRichtxt != b.node.IsRichtxt:
+		return diff("is_richtxt", b.node.IsRichtxt, a.node.IsRichtxt)
+	case a.node.TsCreation != b.node.TsCreation:
+		return diff("ts_creation", b.node.TsCreation, a.node.TsCreation)
+	case a.node.TsLastsave != b.node.TsLastsave:
+		return diff("ts_lastsave", b.node.TsLastsave, a.node.TsLastsave)
+	case a.pos.FatherId != b.pos.FatherId:
+		return diff("parent", b.pos.FatherId, a.pos.FatherId)
+	case a.pos.MasterId != b.pos.MasterId:
+		return diff("master_id", b.pos.MasterId, a.pos.MasterId)
+	}
+	if a.node.IsRichtxt&1 == 0 {
+		if a.node.Syntax != b.node.Syntax {
+			return diff("syntax", b.node.Syntax, a.node.Syntax)
+		}
+		if a.node.Txt != b.node.Txt {
+			return fmt.Errorf("text differs")
+		}
+	} else {
+		var ad, bd XmlDocument
+		if err := xml.Unmarshal([]byte(a.node.Txt), &ad); err != nil {
+			return err
+		}
+		if err := xml.Unmarshal([]byte(b.node.Txt), &bd); err != nil {
+			return err
+		}
+		if len(ad.RichTexts) != len(bd.RichTexts) || len(ad.RichTexts) > 0 && !reflect.DeepEqual(ad.RichTexts, bd.RichTexts) {
+			return fmt.Errorf("rich text differs")
+		}
+	}
+	if !reflect.DeepEqual(normalizedCodeBoxes(a), normalizedCodeBoxes(b)) {
+		return fmt.Errorf("code boxes differ")
+	}
+	ag, err := normalizedGrids(a)
+	if err != nil {
+		return err
+	}
+	bg, err := normalizedGrids(b)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(ag, bg) {
+		return fmt.Errorf("tables differ")
+	}
+	if !reflect.DeepEqual(normalizedImages(a), normalizedImages(b)) {
+		return fmt.Errorf("images, embedded files or anchors differ")
+	}
+	return nil
+}
+
+// 以下几个函数去掉与比较无关的差异：节点ID、记录的顺序以及空与 nil 的区别
+
+func normalizedCodeBoxes(n *rawNode) []tCodeBox {
+	ret := make([]tCodeBox, len(n.codeBoxes))
+	for i, c := range n.codeBoxes {
+		c.NodeId = 0
+		ret[i] = c
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Offset < ret[j].Offset
+	})
+	return ret
+}
+
+func normalizedGrids(n *rawNode) ([]interface{}, error) {
+	grids := append([]tGrid(nil), n.grids...)
+	sort.SliceStable(grids, func(i, j int) bool {
+		return grids[i].Offset < grids[j].Offset
+	})
+	var ret []interface{}
+	for _, g := range grids {
+		var x XmlGrid
+		if err := xml.Unmarshal([]byte(g.Txt), &x); err != nil {
+			return nil, fmt.Errorf("table at offset %d: %w", g.Offset, err)
+		}
+		g.NodeId, g.Txt = 0, ""
+		ret = append(ret, g, x)
+	}
+	return ret, nil
+}
+
+func normalizedImages(n *rawNode) []tImage {
+	ret := make([]tImage, len(n.images))
+	for i, img := range n.images {
+		img.NodeId = 0
+		if len(img.Png) == 0 {
+			img.Png = nil
+		}
+		ret[i] = img
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Offset < ret[j].Offset
+	})
+	return ret
+}
@@ -0,0 +1,100 @@
+package ctb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.ctb")
+	if err := writeRawDocument(src, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct{ from, to string }{
+		{"src.ctb", "a.ctd"},
+		{"a.ctd", "b.ctb"},
+		{"b.ctb", "c.ctd"},
+		{"c.ctd", "d.ctd"},
+	}
+	for _, s := range steps {
+		if err := Convert(filepath.Join(dir, s.from), filepath.Join(dir, s.to)); err != nil {
+			t.Fatalf("%s -> %s: %v", s.from, s.to, err)
+		}
+	}
+	want, err := loadRawDocumentFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.ctd", "b.ctb", "c.ctd", "d.ctd"} {
+		got, err := loadRawDocumentFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareRawDocuments(want, got); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// 经过 ctb 转换一圈后 ctd 的内容不变
+	a, err := os.ReadFile(filepath.Join(dir, "a.ctd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"c.ctd", "d.ctd"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s differs from a.ctd", name)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.ctb")
+	doc := sampleDocument()
+	// ctd 中不能保存控制字符，校验失败
+	doc.nodes[2].node.Txt = "a\x01b"
+	if err := writeRawDocument(src, doc); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst.ctd")
+	if err := os.WriteFile(dst, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		src, dst string
+	}{
+		{"unsupported destination", src, filepath.Join(dir, "dst.txt")},
+		{"unsupported source", filepath.Join(dir, "src.txt"), dst},
+		{"missing source", filepath.Join(dir, "missing.ctd"), dst},
+		{"verification fails", src, dst},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Convert(tt.src, tt.dst); err == nil {
+				t.Fatal("no error")
+			}
+			// 原有的目标文件不变，也不留下临时文件
+			if b, err := os.ReadFile(dst); err != nil || string(b) != "existing" {
+				t.Errorf("destination %q, %v", b, err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("directory contains %v, want only src.ctb and dst.ctd", names)
+			}
+		})
+	}
+}
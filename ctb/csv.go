@@ -0,0 +1,25 @@
+package ctb
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// WriteCSV 以 CSV 格式输出表格，第一行为表头
+func (t *CtTable) WriteCSV(w io.Writer) error {
+	return t.writeDelimited(w, ',')
+}
+
+// WriteTSV 以 Tab 分隔的格式输出表格，第一行为表头；包含 Tab、换行或引号的单元格会加上引号
+func (t *CtTable) WriteTSV(w io.Writer) error {
+	return t.writeDelimited(w, '\t')
+}
+
+func (t *CtTable) writeDelimited(w io.Writer, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.WriteAll(t.Data); err != nil {
+		return err
+	}
+	return cw.Error()
+}
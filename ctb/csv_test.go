@@ -0,0 +1,31 @@
+package ctb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCtTableWriteDelimited(t *testing.T) {
+	table := &CtTable{Data: [][]string{{"name", "note"}, {"a,b", "say \"hi\""}, {"tab\there", "two\nlines"}}}
+	tests := []struct {
+		name  string
+		write func(*CtTable, *bytes.Buffer) error
+		want  string
+	}{
+		{"csv", func(t *CtTable, b *bytes.Buffer) error { return t.WriteCSV(b) },
+			"name,note\n\"a,b\",\"say \"\"hi\"\"\"\ntab\there,\"two\nlines\"\n"},
+		{"tsv", func(t *CtTable, b *bytes.Buffer) error { return t.WriteTSV(b) },
+			"name\tnote\na,b\t\"say \"\"hi\"\"\"\n\"tab\there\"\t\"two\nlines\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(table, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
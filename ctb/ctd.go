@@ -0,0 +1,455 @@
+package ctb
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportCTD 将整个文档写为 CherryTree 的 XML 格式（.ctd）；
+// 输出按节点层次缩进，每个富文本片段与附件一个元素，适合纳入 git 等版本管理
+func (r Handle) ExportCTD(w io.Writer) error {
+	doc, err := r.loadRawDocument()
+	if err != nil {
+		return err
+	}
+	return writeCTD(w, doc)
+}
+
+// writeCTD 输出 ctd 文档，节点属性与元素的写法与 CherryTree 相同
+func writeCTD(w io.Writer, doc *rawDocument) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xmlHeader + "\n<cherrytree>\n")
+	if len(doc.bookmarks) > 0 {
+		ids := make([]string, len(doc.bookmarks))
+		for i, id := range doc.bookmarks {
+			ids[i] = fmt.Sprint(id)
+		}
+		fmt.Fprintf(bw, "  <bookmarks list=\"%s\"/>\n", strings.Join(ids, ","))
+	}
+	var walk func(fatherId int32, depth int) error
+	walk = func(fatherId int32, depth int) error {
+		for _, n := range doc.children(fatherId) {
+			indent := strings.Repeat("  ", depth)
+			bw.WriteString(indent + ctdNodeStart(n) + "\n")
+			content, err := ctdNodeContent(n)
+			if err != nil {
+				return fmt.Errorf("node %d: %w", n.node.NodeId, err)
+			}
+			for _, e := range content {
+				bw.WriteString(indent + "  " + e + "\n")
+			}
+			if err := walk(n.node.NodeId, depth+1); err != nil {
+				return err
+			}
+			bw.WriteString(indent + "</node>\n")
+		}
+		return nil
+	}
+	if err := walk(0, 1); err != nil {
+		return err
+	}
+	bw.WriteString("</cherrytree>\n")
+	return bw.Flush()
+}
+
+// ctdNodeStart 节点的开始标签，is_ro 与 is_richtxt 中的各个标志展开为单独的属性
+func ctdNodeStart(n *rawNode) string {
+	var sb strings.Builder
+	attr := func(name, value string) {
+		sb.WriteString(" " + name + `="` + xmlText(value) + `"`)
+	}
+	sb.WriteString("<node")
+	attr("name", n.node.Name)
+	attr("unique_id", fmt.Sprint(n.node.NodeId))
+	if n.pos.MasterId != 0 {
+		attr("master_id", fmt.Sprint(n.pos.MasterId))
+	}
+	syntax := n.node.Syntax
+	if n.node.IsRichtxt&1 != 0 {
+		syntax = CtNodeSyntaxRichText
+	}
+	attr("prog_lang", syntax)
+	attr("tags", n.node.Tags)
+	attr("readonly", fmt.Sprint(n.node.IsRo&1))
+	attr("custom_icon_id", fmt.Sprint(n.node.IsRo>>1))
+	attr("is_bold", fmt.Sprint(n.node.IsRichtxt>>1&1))
+	foreground := ""
+	if n.node.IsRichtxt&0b100 != 0 {
+		foreground = fmt.Sprintf("#%06x", n.node.IsRichtxt>>3&0xffffff)
+	}
+	attr("foreground", foreground)
+	attr("ts_creation", fmt.Sprint(n.node.TsCreation))
+	attr("ts_lastsave", fmt.Sprint(n.node.TsLastsave))
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// ctdWidget 附件及其在节点中的偏移量
+type ctdWidget struct {
+	offset int32
+	xml    string
+}
+
+// ctdNodeContent 节点内容的各个元素：富文本片段按顺序输出，附件插在它所在位置之前的片段之后
+func ctdNodeContent(n *rawNode) ([]string, error) {
+	if n.node.IsRichtxt&1 == 0 {
+		return []string{"<rich_text>" + xmlCharData(n.node.Txt) + "</rich_text>"}, nil
+	}
+	var doc XmlDocument
+	if err := xml.Unmarshal([]byte(n.node.Txt), &doc); err != nil {
+		return nil, err
+	}
+	widgets, err := ctdWidgets(n)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	var chars int32
+	for _, rt := range doc.RichTexts {
+		for len(widgets) > 0 && widgets[0].offset <= chars {
+			ret = append(ret, widgets[0].xml)
+			widgets = widgets[1:]
+			chars++
+		}
+		var sb strings.Builder
+		writeRichText(&sb, rt)
+		ret = append(ret, sb.String())
+		chars += int32(len([]rune(rt.Text)))
+	}
+	for _, w := range widgets {
+		ret = append(ret, w.xml)
+	}
+	return ret, nil
+}
+
+// ctdWidgets 节点中的代码框、表格、图片、附件与锚，按偏移量排序
+func ctdWidgets(n *rawNode) ([]ctdWidget, error) {
+	var ret []ctdWidget
+	start := func(tag string, offset int32, justification string) *strings.Builder {
+		sb := &strings.Builder{}
+		fmt.Fprintf(sb, `<%s char_offset="%d" justification="%s"`, tag, offset, xmlText(justification))
+		return sb
+	}
+	for _, c := range n.codeBoxes {
+		sb := start("codebox", c.Offset, c.Justification)
+		fmt.Fprintf(sb, ` frame_width="%d" frame_height="%d" width_in_pixels="%d" syntax_highlighting="%s" highlight_brackets="%d" show_line_numbers="%d">`,
+			c.Width, c.Height, c.IsWidthPixel, xmlText(c.Syntax), c.DoHighlightBraces, c.DoShowLineNumber)
+		sb.WriteString(xmlCharData(c.Txt) + "</codebox>")
+		ret = append(ret, ctdWidget{c.Offset, sb.String()})
+	}
+	for _, g := range n.grids {
+		var grid XmlGrid
+		if err := xml.Unmarshal([]byte(g.Txt), &grid); err != nil {
+			return nil, fmt.Errorf("table at offset %d: %w", g.Offset, err)
+		}
+		sb := start("table", g.Offset, g.Justification)
+		fmt.Fprintf(sb, ` col_min="%d" col_max="%d" col_widths="%s" is_light="%s">`, g.ColMin, g.ColMax, xmlText(grid.ColWidths), xmlText(grid.IsLight))
+		// 与 ctb 相同，表头是最后一行
+		for _, row := range grid.Rows {
+			sb.WriteString("<row>")
+			for _, cell := range row.Cells {
+				sb.WriteString("<cell>" + xmlCharData(cell) + "</cell>")
+			}
+			sb.WriteString("</row>")
+		}
+		sb.WriteString("</table>")
+		ret = append(ret, ctdWidget{g.Offset, sb.String()})
+	}
+	for _, img := range n.images {
+		sb := start("encoded_png", img.Offset, img.Justification)
+		switch {
+		case img.Anchor != "":
+			fmt.Fprintf(sb, ` anchor="%s"/>`, xmlText(img.Anchor))
+		case img.Filename != "":
+			fmt.Fprintf(sb, ` filename="%s" time="%d">%s</encoded_png>`, xmlText(img.Filename), img.Time, base64.StdEncoding.EncodeToString(img.Png))
+		default:
+			fmt.Fprintf(sb, ` link="%s">%s</encoded_png>`, xmlText(img.Link), base64.StdEncoding.EncodeToString(img.Png))
+		}
+		ret = append(ret, ctdWidget{img.Offset, sb.String()})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].offset < ret[j].offset
+	})
+	return ret, nil
+}
+
+// ctdElement ctd 中的一个元素，读取时先解析为通用的元素树
+type ctdElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Text     string       `xml:",chardata"`
+	Children []ctdElement `xml:",any"`
+}
+
+func (e *ctdElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// intAttr 整数属性，缺少时为 0；旧版本的 CherryTree 把时间戳写为小数
+func (e *ctdElement) intAttr(name string) (int32, error) {
+	s := e.attr(name)
+	if s == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("<%s> attribute %s: invalid number %q", e.XMLName.Local, name, s)
+	}
+	return int32(f), nil
+}
+
+// boolAttr 布尔属性，新版本写为 0/1，旧版本写为 False/True
+func (e *ctdElement) boolAttr(name string) int32 {
+	switch e.attr(name) {
+	case "1", "True", "true":
+		return 1
+	}
+	return 0
+}
+
+func readCTDFile(filepath string) (*rawDocument, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := readCTD(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %v: %w", filepath, err)
+	}
+	return doc, nil
+}
+
+// readCTD 解析 ctd 文档；节点的 sequence 按文件中的顺序编号
+func readCTD(rd io.Reader) (*rawDocument, error) {
+	var root ctdElement
+	if err := xml.NewDecoder(rd).Decode(&root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Local != "cherrytree" {
+		return nil, fmt.Errorf("unexpected root element <%s>", root.XMLName.Local)
+	}
+	doc := newRawDocument()
+	var walk func(children []ctdElement, fatherId int32) error
+	walk = func(children []ctdElement, fatherId int32) error {
+		var sequence int32
+		for i := range children {
+			e := &children[i]
+			if e.XMLName.Local != "node" {
+				continue
+			}
+			n, err := readCTDNode(e)
+			if err != nil {
+				return err
+			}
+			if _, ok := doc.nodes[n.node.NodeId]; ok || n.node.NodeId <= 0 {
+				return fmt.Errorf("invalid or duplicate node id %d", n.node.NodeId)
+			}
+			sequence++
+			n.pos.FatherId = fatherId
+			n.pos.Sequence = sequence
+			doc.nodes[n.node.NodeId] = n
+			if err := walk(e.Children, n.node.NodeId); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root.Children, 0); err != nil {
+		return nil, err
+	}
+	for _, e := range root.Children {
+		if e.XMLName.Local != "bookmarks" || e.attr("list") == "" {
+			continue
+		}
+		for _, s := range strings.Split(e.attr("list"), ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bookmark list %q", e.attr("list"))
+			}
+			if _, ok := doc.nodes[int32(id)]; ok {
+				doc.bookmarks = append(doc.bookmarks, int32(id))
+			}
+		}
+	}
+	return doc, nil
+}
+
+// readCTDNode 节点的属性与内容，下级节点由调用者处理
+func readCTDNode(e *ctdElement) (*rawNode, error) {
+	var n rawNode
+	id, err := e.intAttr("unique_id")
+	if err != nil {
+		return nil, err
+	}
+	n.node.NodeId = id
+	n.pos.NodeId = id
+	if n.pos.MasterId, err = e.intAttr("master_id"); err != nil {
+		return nil, err
+	}
+	if n.node.TsCreation, err = e.intAttr("ts_creation"); err != nil {
+		return nil, err
+	}
+	if n.node.TsLastsave, err = e.intAttr("ts_lastsave"); err != nil {
+		return nil, err
+	}
+	icon, err := e.intAttr("custom_icon_id")
+	if err != nil {
+		return nil, err
+	}
+	n.node.Name = e.attr("name")
+	n.node.Tags = e.attr("tags")
+	n.node.Syntax = e.attr("prog_lang")
+	n.node.IsRo = icon<<1 | e.boolAttr("readonly")
+	n.node.IsRichtxt = e.boolAttr("is_bold") << 1
+	if fg := e.attr("foreground"); fg != "" {
+		c, ok := parseColor(fg)
+		if !ok {
+			return nil, fmt.Errorf("node %d: invalid foreground %q", id, fg)
+		}
+		n.node.IsRichtxt |= 0b100 | (int32(c.r)<<16|int32(c.g)<<8|int32(c.b))<<3
+	}
+	if n.node.Syntax == CtNodeSyntaxRichText {
+		n.node.IsRichtxt |= 1
+	}
+	var runs []XmlRichText
+	for i := range e.Children {
+		c := &e.Children[i]
+		var err error
+		switch c.XMLName.Local {
+		case "rich_text":
+			var rt XmlRichText
+			rt, err = readCTDRichText(c)
+			runs = append(runs, rt)
+		case "codebox":
+			err = n.readCTDCodeBox(c)
+		case "table":
+			err = n.readCTDTable(c)
+		case "encoded_png":
+			err = n.readCTDImage(c)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %w", id, err)
+		}
+	}
+	if n.node.IsRichtxt&1 != 0 {
+		n.node.Txt = marshalXmlDocument(&XmlDocument{RichTexts: runs})
+	} else {
+		var sb strings.Builder
+		for _, rt := range runs {
+			sb.WriteString(rt.Text)
+		}
+		n.node.Txt = sb.String()
+	}
+	return &n, nil
+}
+
+func readCTDRichText(e *ctdElement) (XmlRichText, error) {
+	indent, err := e.intAttr("indent")
+	return XmlRichText{
+		Foreground:    e.attr("foreground"),
+		Background:    e.attr("background"),
+		Weight:        e.attr("weight"),
+		Style:         e.attr("style"),
+		Underline:     e.attr("underline"),
+		Strikethrough: e.attr("strikethrough"),
+		Scale:         e.attr("scale"),
+		Family:        e.attr("family"),
+		Link:          e.attr("link"),
+		Justification: e.attr("justification"),
+		Indent:        indent,
+		Text:          e.Text,
+	}, err
+}
+
+func (n *rawNode) readCTDCodeBox(e *ctdElement) error {
+	c := tCodeBox{
+		Justification:     e.attr("justification"),
+		Txt:               e.Text,
+		Syntax:            e.attr("syntax_highlighting"),
+		IsWidthPixel:      e.boolAttr("width_in_pixels"),
+		DoHighlightBraces: e.boolAttr("highlight_brackets"),
+		DoShowLineNumber:  e.boolAttr("show_line_numbers"),
+	}
+	var err error
+	for _, a := range []struct {
+		name string
+		v    *int32
+	}{{"char_offset", &c.Offset}, {"frame_width", &c.Width}, {"frame_height", &c.Height}} {
+		if *a.v, err = e.intAttr(a.name); err != nil {
+			return err
+		}
+	}
+	n.codeBoxes = append(n.codeBoxes, c)
+	return nil
+}
+
+// readCTDTable 表格按 ctb 的 grid 表的 txt 格式保存，行的顺序不变（表头在最后）
+func (n *rawNode) readCTDTable(e *ctdElement) error {
+	g := tGrid{Justification: e.attr("justification")}
+	var err error
+	for _, a := range []struct {
+		name string
+		v    *int32
+	}{{"char_offset", &g.Offset}, {"col_min", &g.ColMin}, {"col_max", &g.ColMax}} {
+		if *a.v, err = e.intAttr(a.name); err != nil {
+			return err
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	fmt.Fprintf(&sb, `<table col_widths="%s" is_light="%s">`, xmlText(e.attr("col_widths")), xmlText(e.attr("is_light")))
+	for _, row := range e.Children {
+		if row.XMLName.Local != "row" {
+			continue
+		}
+		sb.WriteString("<row>")
+		for _, cell := range row.Children {
+			if cell.XMLName.Local == "cell" {
+				sb.WriteString("<cell>" + xmlTextEscaper.Replace(cell.Text) + "</cell>")
+			}
+		}
+		sb.WriteString("</row>")
+	}
+	sb.WriteString("</table>")
+	g.Txt = sb.String()
+	n.grids = append(n.grids, g)
+	return nil
+}
+
+// readCTDImage encoded_png 元素：有 anchor 属性的是锚，有 filename 属性的是附件，其余为图片
+func (n *rawNode) readCTDImage(e *ctdElement) error {
+	img := tImage{
+		Justification: e.attr("justification"),
+		Anchor:        e.attr("anchor"),
+		Filename:      e.attr("filename"),
+		Link:          e.attr("link"),
+	}
+	var err error
+	if img.Offset, err = e.intAttr("char_offset"); err != nil {
+		return err
+	}
+	if img.Time, err = e.intAttr("time"); err != nil {
+		return err
+	}
+	if img.Anchor == "" {
+		data := strings.Join(strings.Fields(e.Text), "")
+		if img.Png, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return fmt.Errorf("encoded_png at offset %d: %w", img.Offset, err)
+		}
+	}
+	n.images = append(n.images, img)
+	return nil
+}
@@ -0,0 +1,190 @@
+package ctb
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleDocument 测试用的文档，包含各种节点属性与锚定元素
+func sampleDocument() *rawDocument {
+	t := time.Unix(1700000000, 0)
+	doc := newRawDocument()
+
+	rich := newRawNode(1, 0, 1, `rich <"&'>`, t)
+	rich.node.Tags = "a b"
+	rich.node.IsRo = 3<<1 | 1
+	rich.node.IsRichtxt |= 0b110 | 0x12ab34<<3
+	var b richTextBuilder
+	b.text("中文 heading\n", XmlRichText{Scale: "h1", Weight: "heavy"})
+	b.text("link ", XmlRichText{Link: "node 2"})
+	b.codeBox("if a < b && c {\n\treturn\n}", "go")
+	b.text("\n", XmlRichText{})
+	b.grid([][]string{{"h1", "h2"}, {"<a>", "b&c"}})
+	b.png(samplePng(), "webs https://example.com")
+	b.embFile([]byte("\x00\x01 attachment"), "file name.bin", t)
+	b.text("  trailing  ", XmlRichText{Foreground: "#ff0000", Indent: 2})
+	// 锚放在末尾，占用一个字符
+	anchor := tImage{Offset: b.chars, Justification: "left", Anchor: "here"}
+	b.build(rich)
+	rich.images = append(rich.images, anchor)
+	doc.nodes[1] = rich
+
+	code := newRawNode(2, 1, 1, "code", t)
+	code.node.Syntax = "python"
+	code.node.IsRichtxt = 0
+	code.node.Txt = "print('<&>')\n\n"
+	doc.nodes[2] = code
+
+	plain := newRawNode(3, 0, 2, "", t.Add(time.Hour))
+	plain.node.Syntax = CtNodeSyntaxPlainText
+	plain.node.IsRichtxt = 0
+	plain.node.Txt = ""
+	doc.nodes[3] = plain
+
+	doc.nodes[5] = newRawNode(5, 1, 2, "empty rich", t)
+	doc.bookmarks = []int32{3, 1}
+	return doc
+}
+
+// samplePng 2x1 的 PNG 图片
+func samplePng() []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 1))); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteCTD(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCTD(&buf, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"\n<cherrytree>\n  <bookmarks list=\"3,1\"/>\n  <node name=\"rich &lt;&quot;&amp;'&gt;\" unique_id=\"1\"",
+		` prog_lang="custom-colors" tags="a b" readonly="1" custom_icon_id="3" is_bold="1" foreground="#12ab34" ts_creation="1700000000" ts_lastsave="1700000000">`,
+		"\n    <node name=\"code\" unique_id=\"2\" prog_lang=\"python\"",
+		"\n      <rich_text>print('&lt;&amp;&gt;')\n\n</rich_text>\n    </node>\n",
+		`<codebox char_offset="16" justification="left"`,
+		` syntax_highlighting="go" highlight_brackets="1" show_line_numbers="0">if a &lt; b &amp;&amp; c {`,
+		`<encoded_png char_offset="33" justification="left" anchor="here"/>`,
+		`<encoded_png char_offset="20" justification="left" filename="file name.bin" time="1700000000">AAEgYXR0YWNobWVudA==</encoded_png>`,
+		`<row><cell>&lt;a&gt;</cell><cell>b&amp;c</cell></row><row><cell>h1</cell><cell>h2</cell></row>`,
+		"\n  <node name=\"\" unique_id=\"3\" prog_lang=\"plain-text\"",
+		"</node>\n</cherrytree>\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	// 节点按层次与顺序输出
+	var order []string
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.Index(line, "unique_id=\""); i >= 0 {
+			order = append(order, line[i+len("unique_id=\""):][:1])
+		}
+	}
+	if got := strings.Join(order, ","); got != "1,2,5,3" {
+		t.Errorf("node order %s, want 1,2,5,3", got)
+	}
+}
+
+func TestReadCTDRoundTrip(t *testing.T) {
+	src := sampleDocument()
+	var buf bytes.Buffer
+	if err := writeCTD(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readCTD(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareRawDocuments(src, doc); err != nil {
+		t.Fatal(err)
+	}
+	// 再写一次，输出完全相同
+	var again bytes.Buffer
+	if err := writeCTD(&again, doc); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != buf.String() {
+		t.Errorf("second write differs:\n%s\nwant\n%s", again.String(), buf.String())
+	}
+}
+
+func TestReadCTD(t *testing.T) {
+	const head = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	tests := []struct {
+		name    string
+		ctd     string
+		check   func(t *testing.T, doc *rawDocument)
+		wantErr string
+	}{
+		{
+			name: "old format flags and timestamps",
+			ctd: head + `<cherrytree><node name="a" unique_id="7" prog_lang="sh" readonly="True" is_bold="False" custom_icon_id="2" ts_creation="1700000000.25" ts_lastsave="1700000001.9">` +
+				`<rich_text>echo 1</rich_text><rich_text>` + "\n" + `echo 2</rich_text>` +
+				`<node name="b" unique_id="3" prog_lang="custom-colors"/></node></cherrytree>`,
+			check: func(t *testing.T, doc *rawDocument) {
+				a := doc.nodes[7]
+				if a == nil || doc.nodes[3] == nil || len(doc.nodes) != 2 {
+					t.Fatalf("nodes %v, want 3 and 7", doc.sortedIds())
+				}
+				if a.node.IsRo != 2<<1|1 || a.node.IsRichtxt != 0 || a.node.TsCreation != 1700000000 || a.node.TsLastsave != 1700000001 {
+					t.Errorf("node 7 is_ro %d is_richtxt %d ts %d/%d", a.node.IsRo, a.node.IsRichtxt, a.node.TsCreation, a.node.TsLastsave)
+				}
+				if a.node.Txt != "echo 1\necho 2" {
+					t.Errorf("node 7 text %q", a.node.Txt)
+				}
+				if b := doc.nodes[3]; b.pos.FatherId != 7 || b.pos.Sequence != 1 || b.node.IsRichtxt != 1 {
+					t.Errorf("node 3 father %d sequence %d is_richtxt %d", b.pos.FatherId, b.pos.Sequence, b.node.IsRichtxt)
+				}
+			},
+		},
+		{
+			name: "bookmarks of missing nodes are dropped",
+			ctd:  head + `<cherrytree><bookmarks list="2, 9,1"/><node name="a" unique_id="1"/><node name="b" unique_id="2"/></cherrytree>`,
+			check: func(t *testing.T, doc *rawDocument) {
+				if got := fmt.Sprint(doc.bookmarks); got != "[2 1]" {
+					t.Errorf("bookmarks %s, want [2 1]", got)
+				}
+				if doc.nodes[2].pos.Sequence != 2 {
+					t.Errorf("node 2 sequence %d, want 2", doc.nodes[2].pos.Sequence)
+				}
+			},
+		},
+		{name: "not xml", ctd: "hello", wantErr: "EOF"},
+		{name: "wrong root", ctd: head + `<notes/>`, wantErr: "unexpected root element <notes>"},
+		{name: "duplicate id", ctd: head + `<cherrytree><node unique_id="1"/><node unique_id="1"/></cherrytree>`, wantErr: "invalid or duplicate node id 1"},
+		{name: "missing id", ctd: head + `<cherrytree><node name="a"/></cherrytree>`, wantErr: "invalid or duplicate node id 0"},
+		{name: "invalid number", ctd: head + `<cherrytree><node unique_id="x"/></cherrytree>`, wantErr: `<node> attribute unique_id: invalid number "x"`},
+		{name: "invalid foreground", ctd: head + `<cherrytree><node unique_id="1" foreground="red"/></cherrytree>`, wantErr: `node 1: invalid foreground "red"`},
+		{name: "invalid bookmarks", ctd: head + `<cherrytree><bookmarks list="1,a"/></cherrytree>`, wantErr: `invalid bookmark list "1,a"`},
+		{
+			name:    "invalid image data",
+			ctd:     head + `<cherrytree><node unique_id="4" prog_lang="custom-colors"><encoded_png char_offset="3">!!</encoded_png></node></cherrytree>`,
+			wantErr: "node 4: encoded_png at offset 3:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := readCTD(strings.NewReader(tt.ctd))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, doc)
+		})
+	}
+}
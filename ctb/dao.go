@@ -1,6 +1,7 @@
 package ctb
 
 import (
+	"gorm.io/gorm"
 	"sort"
 )
 
@@ -30,11 +31,11 @@ func (r Handle) selectChildrenByNodeId(nodeId int32) (tChildren, error) {
 
 func (r Handle) selectChildrenByFatherId(nodeId int32) ([]tChildren, error) {
 	var list []tChildren
-	result := r.db.Where("father_id = ?", nodeId).Find(&list)
+	result := r.db.Where("father_id = ?", nodeId).Order("node_id").Find(&list)
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	sort.Slice(list, func(i, j int) bool {
+	sort.SliceStable(list, func(i, j int) bool {
 		return list[i].Sequence < list[j].Sequence
 	})
 	return list, nil
@@ -54,3 +55,122 @@ func (r Handle) selectImagesByNodeId(id int32) ([]*tImage, error) {
 	}
 	return images, nil
 }
+
+func (r Handle) selectImageByOffset(id, offset int32) (*tImage, error) {
+	var img tImage
+	result := r.db.Where("node_id = ? AND offset = ?", id, offset).Take(&img)
+	return &img, result.Error
+}
+
+func (r Handle) selectMaxLastSaveTime() (int32, int64, error) {
+	var row struct {
+		MaxTs int32
+		Count int64
+	}
+	result := r.db.Model(&tNode{}).Select("COALESCE(MAX(ts_lastsave), 0) AS max_ts, COUNT(*) AS count").Take(&row)
+	return row.MaxTs, row.Count, result.Error
+}
+
+func (r Handle) selectLastSaveTimeById(id int32) (int32, error) {
+	var ts int32
+	result := r.db.Model(&tNode{}).Where("node_id = ?", id).Select("ts_lastsave").Take(&ts)
+	return ts, result.Error
+}
+
+// selectNodeIdsByKeyword 在节点名称与正文、代码框、表格中做 LIKE 匹配，返回去重并升序排列的节点ID
+func (r Handle) selectNodeIdsByKeyword(patterns ...string) ([]int32, error) {
+	set := map[int32]struct{}{}
+	for _, p := range patterns {
+		queries := []*gorm.DB{
+			r.db.Model(&tNode{}).Where(`name LIKE ? ESCAPE '\' OR txt LIKE ? ESCAPE '\'`, p, p),
+			r.db.Model(&tCodeBox{}).Where(`txt LIKE ? ESCAPE '\'`, p),
+			r.db.Model(&tGrid{}).Where(`txt LIKE ? ESCAPE '\'`, p),
+		}
+		for _, q := range queries {
+			var ids []int32
+			if err := q.Distinct().Pluck("node_id", &ids).Error; err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				set[id] = struct{}{}
+			}
+		}
+	}
+	ret := make([]int32, 0, len(set))
+	for id := range set {
+		ret = append(ret, id)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return ret, nil
+}
+
+// selectLastSaveTimes 返回所有节点的 node_id -> ts_lastsave
+func (r Handle) selectLastSaveTimes() (map[int32]int32, error) {
+	var rows []struct {
+		NodeId     int32
+		TsLastsave int32
+	}
+	result := r.db.Model(&tNode{}).Select("node_id, ts_lastsave").Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	ret := make(map[int32]int32, len(rows))
+	for _, row := range rows {
+		ret[row.NodeId] = row.TsLastsave
+	}
+	return ret, nil
+}
+
+func (r Handle) selectNodeMetaModifiedSince(ts int64) ([]ptNodeMeta, error) {
+	var list []ptNodeMeta
+	result := r.db.Model(&tNode{}).Where("ts_lastsave >= ?", ts).Order("ts_lastsave, node_id").Find(&list)
+	return list, result.Error
+}
+
+func (r Handle) selectNodeMetaRecentlyCreated(limit int) ([]ptNodeMeta, error) {
+	var list []ptNodeMeta
+	result := r.db.Model(&tNode{}).Order("ts_creation DESC, node_id DESC").Limit(limit).Find(&list)
+	return list, result.Error
+}
+
+// selectFatherIds 返回所有拥有子节点的节点ID
+func (r Handle) selectFatherIds() (map[int32]bool, error) {
+	var ids []int32
+	result := r.db.Model(&tChildren{}).Distinct().Pluck("father_id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	ret := make(map[int32]bool, len(ids))
+	for _, id := range ids {
+		ret[id] = true
+	}
+	return ret, nil
+}
+
+func (r Handle) selectAllNodeMeta() ([]ptNodeMeta, error) {
+	var list []ptNodeMeta
+	result := r.db.Model(&tNode{}).Order("node_id").Find(&list)
+	return list, result.Error
+}
+
+func (r Handle) selectAllChildren() ([]tChildren, error) {
+	var list []tChildren
+	result := r.db.Order("node_id").Find(&list)
+	return list, result.Error
+}
+
+// selectNodeIdsWithWidget 返回拥有某种锚定元素（model 为 tCodeBox、tGrid 或 tImage）的节点ID
+func (r Handle) selectNodeIdsWithWidget(model interface{}) (map[int32]bool, error) {
+	var ids []int32
+	result := r.db.Model(model).Distinct().Pluck("node_id", &ids)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	ret := make(map[int32]bool, len(ids))
+	for _, id := range ids {
+		ret[id] = true
+	}
+	return ret, nil
+}
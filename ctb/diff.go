@@ -0,0 +1,487 @@
+package ctb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	DiffKindAdded   = "added"
+	DiffKindRemoved = "removed"
+	DiffKindChanged = "changed"
+)
+
+// DocumentDiff 两个文档之间按节点ID比较得到的差异
+type DocumentDiff struct {
+	Added   []*CtNode   `json:"added,omitempty"`
+	Removed []*CtNode   `json:"removed,omitempty"`
+	Changed []*NodeDiff `json:"changed,omitempty"`
+}
+
+// NodeDiff 同一个节点在两个版本之间的差异
+type NodeDiff struct {
+	Id          int32              `json:"id"`
+	Name        string             `json:"name"`
+	OldName     string             `json:"oldName,omitempty"` // 节点被重命名时为旧名称
+	Move        *NodeMove          `json:"move,omitempty"`
+	Attributes  []AttributeChange  `json:"attributes,omitempty"`
+	Text        []DiffHunk         `json:"text,omitempty"` // 渲染后文本的行级差异
+	CodeBoxes   []CodeBoxChange    `json:"codeBoxes,omitempty"`
+	Tables      []TableChange      `json:"tables,omitempty"`
+	Attachments []AttachmentChange `json:"attachments,omitempty"`
+}
+
+// NodeMove 节点位置的变化：父节点改变，或者与兄弟节点的先后顺序改变
+type NodeMove struct {
+	OldFatherId int32 `json:"oldFatherId"`
+	OldSequence int32 `json:"oldSequence"`
+	NewFatherId int32 `json:"newFatherId"`
+	NewSequence int32 `json:"newSequence"`
+}
+
+// AttributeChange 节点属性（类型、只读、加粗、颜色、图标）的变化
+type AttributeChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// CodeBoxChange 代码框的变化，Index 为代码框在节点中的序号（删除时为旧版本中的序号）
+type CodeBoxChange struct {
+	Kind     string     `json:"kind"`
+	Index    int        `json:"index"`
+	Language string     `json:"language"`
+	Lines    []DiffHunk `json:"lines,omitempty"`
+}
+
+// TableChange 表格的变化，Index 为表格在节点中的序号（删除时为旧版本中的序号）
+type TableChange struct {
+	Kind    string       `json:"kind"`
+	Index   int          `json:"index"`
+	OldRows int          `json:"oldRows"`
+	OldCols int          `json:"oldCols"`
+	NewRows int          `json:"newRows"`
+	NewCols int          `json:"newCols"`
+	Cells   []CellChange `json:"cells,omitempty"`
+}
+
+// CellChange 单元格的变化，行列号从 0 开始，第 0 行为表头
+type CellChange struct {
+	Row int    `json:"row"`
+	Col int    `json:"col"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// AttachmentChange 新增或删除的图片与附件
+type AttachmentChange struct {
+	Kind     string `json:"kind"`
+	Type     string `json:"type"`
+	Filename string `json:"filename,omitempty"`
+	Size     int    `json:"size"`
+	Offset   int32  `json:"offset"`
+}
+
+func (d *DocumentDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffSnapshot 用于比较的文档结构
+type diffSnapshot struct {
+	nodes map[int32]*CtNode
+	pos   map[int32]tChildren
+	ids   []int32
+}
+
+func (r Handle) loadDiffSnapshot() (*diffSnapshot, error) {
+	metas, err := r.selectAllNodeMeta()
+	if err != nil {
+		return nil, err
+	}
+	children, err := r.selectAllChildren()
+	if err != nil {
+		return nil, err
+	}
+	fathers, err := r.selectFatherIds()
+	if err != nil {
+		return nil, err
+	}
+	s := &diffSnapshot{
+		nodes: map[int32]*CtNode{},
+		pos:   map[int32]tChildren{},
+	}
+	for i := range metas {
+		s.nodes[metas[i].NodeId] = NewCtNode(&metas[i], fathers[metas[i].NodeId])
+		s.ids = append(s.ids, metas[i].NodeId)
+	}
+	for _, c := range children {
+		s.pos[c.NodeId] = c
+	}
+	return s, nil
+}
+
+// siblings 各父节点下的子节点ID，按 sequence 排序
+func (s *diffSnapshot) siblings() map[int32][]int32 {
+	ret := map[int32][]int32{}
+	for _, id := range s.ids {
+		if p, ok := s.pos[id]; ok {
+			ret[p.FatherId] = append(ret[p.FatherId], id)
+		}
+	}
+	for _, ids := range ret {
+		sort.SliceStable(ids, func(i, j int) bool {
+			return s.pos[ids[i]].Sequence < s.pos[ids[j]].Sequence
+		})
+	}
+	return ret
+}
+
+// reorderedNodes 父节点没有变化、但与兄弟节点的先后顺序改变了的节点。
+// 只比较两个版本中都在同一父节点下的兄弟节点，保持相对顺序的最长子序列之外的节点才算移动，
+// 所以插入或删除一个兄弟节点不会让后面的兄弟节点都显示为移动
+func reorderedNodes(a, b *diffSnapshot) map[int32]bool {
+	ret := map[int32]bool{}
+	newSiblings := b.siblings()
+	// common 在另一个版本中父节点相同的兄弟节点
+	common := func(ids []int32, fatherId int32, other *diffSnapshot) []int32 {
+		var ret []int32
+		for _, id := range ids {
+			if p, ok := other.pos[id]; ok && other.nodes[id] != nil && p.FatherId == fatherId {
+				ret = append(ret, id)
+			}
+		}
+		return ret
+	}
+	for fatherId, ids := range a.siblings() {
+		for _, id := range reorderedIds(common(ids, fatherId, b), common(newSiblings[fatherId], fatherId, a)) {
+			ret[id] = true
+		}
+	}
+	return ret
+}
+
+// reorderedIds x 与 y 包含相同的节点，返回保持相对顺序的最长子序列之外的节点
+func reorderedIds(x, y []int32) []int32 {
+	var ret []int32
+	edits := diffSeq(len(x), len(y), func(i, j int) bool {
+		return x[i] == y[j]
+	})
+	for _, e := range edits {
+		if e.op == opDelete {
+			ret = append(ret, x[e.a])
+		}
+	}
+	return ret
+}
+
+// DiffDocuments 按节点ID比较两个文档，返回节点的增删、重命名、移动以及内容的变化
+func DiffDocuments(oldDoc, newDoc *Handle) (*DocumentDiff, error) {
+	a, err := oldDoc.loadDiffSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	b, err := newDoc.loadDiffSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	ret := &DocumentDiff{}
+	reordered := reorderedNodes(a, b)
+	for _, id := range a.ids {
+		if _, ok := b.nodes[id]; !ok {
+			ret.Removed = append(ret.Removed, a.nodes[id])
+		}
+	}
+	for _, id := range b.ids {
+		oldNode, ok := a.nodes[id]
+		if !ok {
+			ret.Added = append(ret.Added, b.nodes[id])
+			continue
+		}
+		newNode := b.nodes[id]
+		nd := &NodeDiff{Id: id, Name: newNode.Name}
+		if oldNode.Name != newNode.Name {
+			nd.OldName = oldNode.Name
+		}
+		if pa, pb := a.pos[id], b.pos[id]; pa.FatherId != pb.FatherId || reordered[id] {
+			nd.Move = &NodeMove{
+				OldFatherId: pa.FatherId,
+				OldSequence: pa.Sequence,
+				NewFatherId: pb.FatherId,
+				NewSequence: pb.Sequence,
+			}
+		}
+		nd.Attributes = diffNodeAttributes(oldNode, newNode)
+		oldContent, err := oldDoc.GetNodeContentById(id, nil)
+		if err != nil {
+			return nil, err
+		}
+		newContent, err := newDoc.GetNodeContentById(id, nil)
+		if err != nil {
+			return nil, err
+		}
+		diffNodeContent(nd, oldContent, newContent)
+		if nd.OldName != "" || nd.Move != nil || len(nd.Attributes) > 0 || len(nd.Text) > 0 ||
+			len(nd.CodeBoxes) > 0 || len(nd.Tables) > 0 || len(nd.Attachments) > 0 {
+			ret.Changed = append(ret.Changed, nd)
+		}
+	}
+	return ret, nil
+}
+
+func diffNodeAttributes(a, b *CtNode) []AttributeChange {
+	var ret []AttributeChange
+	add := func(name string, old, new interface{}) {
+		o, n := fmt.Sprint(old), fmt.Sprint(new)
+		if o != n {
+			ret = append(ret, AttributeChange{Name: name, Old: o, New: n})
+		}
+	}
+	add("syntax", a.Syntax, b.Syntax)
+	add("readOnly", a.IsReadOnly, b.IsReadOnly)
+	add("bold", a.IsBold, b.IsBold)
+	add("color", nodeColorString(a), nodeColorString(b))
+	add("icon", a.Icon, b.Icon)
+	return ret
+}
+
+func nodeColorString(n *CtNode) string {
+	if !n.IsCustomColor {
+		return ""
+	}
+	return fmt.Sprintf("#%06x", n.Color)
+}
+
+func diffNodeContent(nd *NodeDiff, a, b *CtNodeContent) {
+	nd.Text = diffTextHunks(renderText(a), renderText(b))
+	wa, wb := collectWidgets(a), collectWidgets(b)
+	// 代码框
+	edits := diffSeq(len(wa.codeBoxes), len(wb.codeBoxes), func(i, j int) bool {
+		return wa.codeBoxes[i].Code == wb.codeBoxes[j].Code && wa.codeBoxes[i].Language == wb.codeBoxes[j].Language
+	})
+	pairEdits(edits, func(i, j int) {
+		nd.CodeBoxes = append(nd.CodeBoxes, CodeBoxChange{
+			Kind:     DiffKindChanged,
+			Index:    j,
+			Language: wb.codeBoxes[j].Language,
+			Lines:    diffTextHunks(wa.codeBoxes[i].Code, wb.codeBoxes[j].Code),
+		})
+	}, func(i int) {
+		nd.CodeBoxes = append(nd.CodeBoxes, CodeBoxChange{Kind: DiffKindRemoved, Index: i, Language: wa.codeBoxes[i].Language})
+	}, func(j int) {
+		nd.CodeBoxes = append(nd.CodeBoxes, CodeBoxChange{Kind: DiffKindAdded, Index: j, Language: wb.codeBoxes[j].Language})
+	})
+	// 表格
+	edits = diffSeq(len(wa.tables), len(wb.tables), func(i, j int) bool {
+		return tableEqual(wa.tables[i].Data, wb.tables[j].Data)
+	})
+	pairEdits(edits, func(i, j int) {
+		tc := newTableChange(DiffKindChanged, j, wa.tables[i].Data, wb.tables[j].Data)
+		tc.Cells = diffTableCells(wa.tables[i].Data, wb.tables[j].Data)
+		nd.Tables = append(nd.Tables, tc)
+	}, func(i int) {
+		nd.Tables = append(nd.Tables, newTableChange(DiffKindRemoved, i, wa.tables[i].Data, nil))
+	}, func(j int) {
+		nd.Tables = append(nd.Tables, newTableChange(DiffKindAdded, j, nil, wb.tables[j].Data))
+	})
+	// 图片与附件：按内容比较
+	count := map[string]int{}
+	for _, at := range wa.attachments {
+		count[at.key]--
+	}
+	for _, at := range wb.attachments {
+		count[at.key]++
+	}
+	for _, at := range wa.attachments {
+		if count[at.key] < 0 {
+			count[at.key]++
+			nd.Attachments = append(nd.Attachments, at.change(DiffKindRemoved))
+		}
+	}
+	for _, at := range wb.attachments {
+		if count[at.key] > 0 {
+			count[at.key]--
+			nd.Attachments = append(nd.Attachments, at.change(DiffKindAdded))
+		}
+	}
+}
+
+type diffAttachment struct {
+	key      string
+	typ      string
+	filename string
+	size     int
+	offset   int32
+}
+
+func (at diffAttachment) change(kind string) AttachmentChange {
+	return AttachmentChange{
+		Kind:     kind,
+		Type:     at.typ,
+		Filename: at.filename,
+		Size:     at.size,
+		Offset:   at.offset,
+	}
+}
+
+type diffWidgets struct {
+	codeBoxes   []*CtCodeBox
+	tables      []*CtTable
+	attachments []diffAttachment
+}
+
+func collectWidgets(c *CtNodeContent) diffWidgets {
+	var w diffWidgets
+	for _, line := range c.Lines {
+		for _, el := range line {
+			switch e := el.(type) {
+			case *CtCodeBox:
+				w.codeBoxes = append(w.codeBoxes, e)
+			case *CtTable:
+				w.tables = append(w.tables, e)
+			case *CtPng:
+				w.attachments = append(w.attachments, diffAttachment{
+					key:    fmt.Sprintf("png:%x", sha256.Sum256(e.Data)),
+					typ:    e.Type,
+					size:   len(e.Data),
+					offset: e.Offset,
+				})
+			case *CtEmbFile:
+				w.attachments = append(w.attachments, diffAttachment{
+					key:      fmt.Sprintf("file:%s:%x", e.Filename, sha256.Sum256(e.Data)),
+					typ:      e.Type,
+					filename: e.Filename,
+					size:     len(e.Data),
+					offset:   e.Offset,
+				})
+			}
+		}
+	}
+	return w
+}
+
+func tableSize(data [][]string) (rows, cols int) {
+	rows = len(data)
+	for _, row := range data {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	return
+}
+
+func newTableChange(kind string, index int, a, b [][]string) TableChange {
+	tc := TableChange{Kind: kind, Index: index}
+	tc.OldRows, tc.OldCols = tableSize(a)
+	tc.NewRows, tc.NewCols = tableSize(b)
+	return tc
+}
+
+func tableEqual(a, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if strings.Join(a[i], "\x00") != strings.Join(b[i], "\x00") || len(a[i]) != len(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// diffTableCells 逐个单元格比较，行列数变化时缺失的单元格视为空串
+func diffTableCells(a, b [][]string) []CellChange {
+	cell := func(data [][]string, row, col int) string {
+		if row < len(data) && col < len(data[row]) {
+			return data[row][col]
+		}
+		return ""
+	}
+	rowsA, colsA := tableSize(a)
+	rowsB, colsB := tableSize(b)
+	rows, cols := rowsA, colsA
+	if rowsB > rows {
+		rows = rowsB
+	}
+	if colsB > cols {
+		cols = colsB
+	}
+	var ret []CellChange
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if o, n := cell(a, i, j), cell(b, i, j); o != n {
+				ret = append(ret, CellChange{Row: i, Col: j, Old: o, New: n})
+			}
+		}
+	}
+	return ret
+}
+
+// WriteText 以便于阅读的文本形式输出差异
+func (d *DocumentDiff) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, n := range d.Added {
+		fmt.Fprintf(&buf, "+ node %d %q\n", n.Id, n.Name)
+	}
+	for _, n := range d.Removed {
+		fmt.Fprintf(&buf, "- node %d %q\n", n.Id, n.Name)
+	}
+	changed := append([]*NodeDiff{}, d.Changed...)
+	sort.SliceStable(changed, func(i, j int) bool {
+		return changed[i].Id < changed[j].Id
+	})
+	for _, nd := range changed {
+		fmt.Fprintf(&buf, "~ node %d %q\n", nd.Id, nd.Name)
+		if nd.OldName != "" {
+			fmt.Fprintf(&buf, "    renamed: %q -> %q\n", nd.OldName, nd.Name)
+		}
+		if m := nd.Move; m != nil {
+			fmt.Fprintf(&buf, "    moved: parent %d #%d -> parent %d #%d\n", m.OldFatherId, m.OldSequence, m.NewFatherId, m.NewSequence)
+		}
+		for _, a := range nd.Attributes {
+			fmt.Fprintf(&buf, "    %s: %q -> %q\n", a.Name, a.Old, a.New)
+		}
+		if len(nd.Text) > 0 {
+			buf.WriteString("    text:\n")
+			writeHunks(&buf, nd.Text, "      ")
+		}
+		for _, c := range nd.CodeBoxes {
+			fmt.Fprintf(&buf, "    code box #%d (%s) %s\n", c.Index+1, c.Language, c.Kind)
+			writeHunks(&buf, c.Lines, "      ")
+		}
+		for _, t := range nd.Tables {
+			switch t.Kind {
+			case DiffKindAdded:
+				fmt.Fprintf(&buf, "    table #%d added (%dx%d)\n", t.Index+1, t.NewRows, t.NewCols)
+			case DiffKindRemoved:
+				fmt.Fprintf(&buf, "    table #%d removed (%dx%d)\n", t.Index+1, t.OldRows, t.OldCols)
+			default:
+				fmt.Fprintf(&buf, "    table #%d changed (%dx%d -> %dx%d)\n", t.Index+1, t.OldRows, t.OldCols, t.NewRows, t.NewCols)
+			}
+			for _, c := range t.Cells {
+				fmt.Fprintf(&buf, "      [%d,%d] %q -> %q\n", c.Row, c.Col, c.Old, c.New)
+			}
+		}
+		for _, a := range nd.Attachments {
+			name := a.Filename
+			if name == "" {
+				name = "image"
+			}
+			fmt.Fprintf(&buf, "    %s %s: %s (%d bytes) at offset %d\n", a.Type, a.Kind, name, a.Size, a.Offset)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeHunks(buf *bytes.Buffer, hunks []DiffHunk, indent string) {
+	for _, h := range hunks {
+		fmt.Fprintf(buf, "%s@@ -%d,%d +%d,%d @@\n", indent, h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, l := range h.Lines {
+			fmt.Fprintf(buf, "%s%s %s\n", indent, l.Op, l.Text)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ctb
+
+import (
+	"reflect"
+	"testing"
+)
+
+// snapshotOf 测试用的文档结构，children 为父节点ID -> 按顺序排列的子节点ID
+func snapshotOf(children map[int32][]int32) *diffSnapshot {
+	s := &diffSnapshot{nodes: map[int32]*CtNode{}, pos: map[int32]tChildren{}}
+	for fatherId, ids := range children {
+		for i, id := range ids {
+			s.nodes[id] = &CtNode{Id: id}
+			s.pos[id] = tChildren{NodeId: id, FatherId: fatherId, Sequence: int32(i + 1)}
+			s.ids = append(s.ids, id)
+		}
+	}
+	return s
+}
+
+func TestReorderedNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new map[int32][]int32
+		want     []int32
+	}{
+		{"unchanged", map[int32][]int32{0: {1, 2, 3}}, map[int32][]int32{0: {1, 2, 3}}, nil},
+		{"sibling inserted", map[int32][]int32{0: {1, 2, 3}}, map[int32][]int32{0: {4, 1, 2, 3}}, nil},
+		{"sibling removed", map[int32][]int32{0: {1, 2, 3}}, map[int32][]int32{0: {2, 3}}, nil},
+		{"one node moved down", map[int32][]int32{0: {1, 2, 3, 4}}, map[int32][]int32{0: {2, 3, 1, 4}}, []int32{1}},
+		{"two nodes swapped", map[int32][]int32{0: {1, 2}}, map[int32][]int32{0: {2, 1}}, []int32{1}},
+		{
+			"moved to another parent",
+			map[int32][]int32{0: {1, 2}, 1: {3, 4}},
+			map[int32][]int32{0: {1, 2}, 1: {4}, 2: {3}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int32
+			for id := range reorderedNodes(snapshotOf(tt.old), snapshotOf(tt.new)) {
+				got = append(got, id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package ctb
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ctbSchema CherryTree 的 ctb 表结构
+var ctbSchema = []string{
+	`CREATE TABLE node (node_id INTEGER UNIQUE, name TEXT, txt TEXT, syntax TEXT, tags TEXT, is_ro INTEGER, is_richtxt INTEGER, has_codebox INTEGER, has_table INTEGER, has_image INTEGER, level INTEGER, ts_creation INTEGER, ts_lastsave INTEGER)`,
+	`CREATE TABLE codebox (node_id INTEGER, offset INTEGER, justification TEXT, txt TEXT, syntax TEXT, width INTEGER, height INTEGER, is_width_pix INTEGER, do_highl_bra INTEGER, do_show_linenum INTEGER)`,
+	`CREATE TABLE grid (node_id INTEGER, offset INTEGER, justification TEXT, txt TEXT, col_min INTEGER, col_max INTEGER)`,
+	`CREATE TABLE image (node_id INTEGER, offset INTEGER, justification TEXT, anchor TEXT, png BLOB, filename TEXT, link TEXT, time INTEGER)`,
+	`CREATE TABLE children (node_id INTEGER UNIQUE, father_id INTEGER, sequence INTEGER, master_id INTEGER)`,
+	`CREATE TABLE bookmark (node_id INTEGER UNIQUE, sequence INTEGER)`,
+}
+
+// rawNode 一个节点在各表中的原始数据
+type rawNode struct {
+	node      tNode
+	pos       tChildren
+	codeBoxes []tCodeBox
+	grids     []tGrid
+	images    []tImage
+}
+
+// rawDocument 整个文档的原始数据，用于合并、转换与写入
+type rawDocument struct {
+	nodes     map[int32]*rawNode
+	bookmarks []int32 // 按 sequence 排序
+}
+
+func newRawDocument() *rawDocument {
+	return &rawDocument{nodes: map[int32]*rawNode{}}
+}
+
+// sortedIds 按节点ID升序返回所有节点
+func (d *rawDocument) sortedIds() []int32 {
+	ids := make([]int32, 0, len(d.nodes))
+	for id := range d.nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// maxId 返回最大的节点ID
+func (d *rawDocument) maxId() int32 {
+	var max int32
+	for id := range d.nodes {
+		if id > max {
+			max = id
+		}
+	}
+	return max
+}
+
+// children 按 sequence 返回某个节点的子节点
+func (d *rawDocument) children(fatherId int32) []*rawNode {
+	var ret []*rawNode
+	for _, n := range d.nodes {
+		if n.pos.FatherId == fatherId {
+			ret = append(ret, n)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].pos.Sequence != ret[j].pos.Sequence {
+			return ret[i].pos.Sequence < ret[j].pos.Sequence
+		}
+		return ret[i].node.NodeId < ret[j].node.NodeId
+	})
+	return ret
+}
+
+// normalizeSequences 将每组兄弟节点的 sequence 重新编号为 1..n，保持原有顺序
+func (d *rawDocument) normalizeSequences() {
+	fathers := map[int32]bool{0: true}
+	for _, n := range d.nodes {
+		fathers[n.pos.FatherId] = true
+	}
+	for f := range fathers {
+		for i, n := range d.children(f) {
+			n.pos.Sequence = int32(i + 1)
+		}
+	}
+}
+
+// loadRawDocument 读取文档所有表的原始数据
+func (r Handle) loadRawDocument() (*rawDocument, error) {
+	doc := newRawDocument()
+	var nodes []tNode
+	if err := r.db.Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		doc.nodes[n.NodeId] = &rawNode{node: n, pos: tChildren{NodeId: n.NodeId}}
+	}
+	var children []tChildren
+	if err := r.db.Find(&children).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		if n, ok := doc.nodes[c.NodeId]; ok {
+			n.pos = c
+		}
+	}
+	var codeBoxes []tCodeBox
+	if err := r.db.Order("node_id, offset").Find(&codeBoxes).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range codeBoxes {
+		if n, ok := doc.nodes[c.NodeId]; ok {
+			n.codeBoxes = append(n.codeBoxes, c)
+		}
+	}
+	var grids []tGrid
+	if err := r.db.Order("node_id, offset").Find(&grids).Error; err != nil {
+		return nil, err
+	}
+	for _, g := range grids {
+		if n, ok := doc.nodes[g.NodeId]; ok {
+			n.grids = append(n.grids, g)
+		}
+	}
+	var images []tImage
+	if err := r.db.Order("node_id, offset").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		if n, ok := doc.nodes[img.NodeId]; ok {
+			n.images = append(n.images, img)
+		}
+	}
+	// 旧版本的文档可能没有 bookmark 表
+	if r.db.Migrator().HasTable(&tBookmark{}) {
+		var bookmarks []tBookmark
+		if err := r.db.Order("sequence").Find(&bookmarks).Error; err != nil {
+			return nil, err
+		}
+		for _, b := range bookmarks {
+			doc.bookmarks = append(doc.bookmarks, b.NodeId)
+		}
+	}
+	return doc, nil
+}
+
+// writeRawDocument 将文档写入新的 ctb 文件（扩展名为 .ctd 时写为 XML 格式）；先写临时文件再改名，不会留下写了一半的文件
+func writeRawDocument(filepath string, doc *rawDocument) error {
+	return writeRawDocumentChecked(filepath, doc, nil)
+}
+
+// writeRawDocumentChecked 与 writeRawDocument 相同，但改名之前先用 check 检查写好的临时文件；
+// check 返回错误时删除临时文件，filepath 原有的文件保持不变
+func writeRawDocumentChecked(filepath string, doc *rawDocument, check func(tmpPath string) error) error {
+	tmp, err := os.CreateTemp(path.Dir(filepath), "."+path.Base(filepath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	_ = tmp.Chmod(0644)
+	if strings.EqualFold(path.Ext(filepath), ".ctd") {
+		err = writeCTD(tmp, doc)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+	} else {
+		_ = tmp.Close()
+		var db *gorm.DB
+		if db, err = openDB(tmpPath); err != nil {
+			return err
+		}
+		err = writeRawDocumentDB(db, doc)
+		if sqlDB, cerr := db.DB(); cerr == nil {
+			if cerr = sqlDB.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("write %v: %w", filepath, err)
+	}
+	if check != nil {
+		if err := check(tmpPath); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, filepath)
+}
+
+// writeRawDocumentDB 在空的数据库中建表并写入文档
+func writeRawDocumentDB(db *gorm.DB, doc *rawDocument) error {
+	for _, ddl := range ctbSchema {
+		if err := db.Exec(ddl).Error; err != nil {
+			return err
+		}
+	}
+	tx := db.Begin()
+	for _, id := range doc.sortedIds() {
+		n := doc.nodes[id]
+		node := n.node
+		node.NodeId = id
+		node.HasCodebox = boolToInt32(len(n.codeBoxes) > 0)
+		node.HasTable = boolToInt32(len(n.grids) > 0)
+		node.HasImage = boolToInt32(len(n.images) > 0)
+		pos := n.pos
+		pos.NodeId = id
+		if err := tx.Create(&node).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Create(&pos).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, c := range n.codeBoxes {
+			c.NodeId = id
+			if err := tx.Create(&c).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		for _, g := range n.grids {
+			g.NodeId = id
+			if err := tx.Create(&g).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		for _, img := range n.images {
+			img.NodeId = id
+			if err := tx.Create(&img).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	for i, id := range doc.bookmarks {
+		if err := tx.Create(&tBookmark{NodeId: id, Sequence: int32(i + 1)}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+package ctb
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WriteTextDump 输出稳定的文本形式：先是节点树，然后按节点ID依次输出每个节点的属性与内容。
+// 相同的文档总是得到相同的输出，可以作为 git 的 textconv 过滤器。
+func (r Handle) WriteTextDump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# tree")
+	if err := r.dumpTree(bw, 0, 0); err != nil {
+		return err
+	}
+	// 标签只在原始数据中
+	raw, err := r.loadRawDocument()
+	if err != nil {
+		return err
+	}
+	for _, id := range raw.sortedIds() {
+		if err := r.dumpNode(bw, raw.nodes[id]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (r Handle) dumpTree(w *bufio.Writer, fatherId int32, depth int) error {
+	list, err := r.GetSubNodesById(fatherId)
+	if err != nil {
+		return err
+	}
+	for _, n := range list {
+		fmt.Fprintf(w, "%s%d %s\n", strings.Repeat("  ", depth), n.Id, n.Name)
+		if n.HasChildren {
+			if err := r.dumpTree(w, n.Id, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r Handle) dumpNode(w *bufio.Writer, raw *rawNode) error {
+	id := raw.node.NodeId
+	n, err := r.GetNodeById(id)
+	if err != nil {
+		return err
+	}
+	c, err := r.GetNodeContentById(id, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n# node %d: %s\n", n.Id, n.Name)
+	fmt.Fprintf(w, "syntax: %s\n", n.Syntax)
+	var flags []string
+	if n.IsReadOnly {
+		flags = append(flags, "readonly")
+	}
+	if n.IsBold {
+		flags = append(flags, "bold")
+	}
+	if n.IsCustomColor {
+		flags = append(flags, nodeColorString(n))
+	}
+	if n.Icon != 0 {
+		flags = append(flags, fmt.Sprintf("icon=%d", n.Icon))
+	}
+	if len(flags) > 0 {
+		fmt.Fprintf(w, "flags: %s\n", strings.Join(flags, " "))
+	}
+	if raw.node.Tags != "" {
+		fmt.Fprintf(w, "tags: %s\n", raw.node.Tags)
+	}
+	fmt.Fprintf(w, "created: %s\n", n.CreateTime.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "modified: %s\n", n.UpdateTime.UTC().Format(time.RFC3339))
+	fmt.Fprintln(w, "---")
+	fmt.Fprintln(w, renderText(c))
+	spans, err := formattingSpans(raw)
+	if err != nil {
+		return fmt.Errorf("node %d: %w", id, err)
+	}
+	if len(spans) > 0 {
+		fmt.Fprintln(w, "--- formatting")
+		for _, s := range spans {
+			fmt.Fprintln(w, s)
+		}
+	}
+	// 锚定元素的详细内容
+	widgets := collectWidgets(c)
+	for i, cb := range widgets.codeBoxes {
+		fmt.Fprintf(w, "--- code-box #%d: %s\n", i+1, cb.Language)
+		fmt.Fprintln(w, cb.Code)
+	}
+	for i, t := range widgets.tables {
+		fmt.Fprintf(w, "--- table #%d\n", i+1)
+		for _, row := range t.Data {
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+	}
+	for _, line := range c.Lines {
+		for _, el := range line {
+			switch e := el.(type) {
+			case *CtPng:
+				fmt.Fprintf(w, "--- image at %d: %dx%d sha256:%x\n", e.Offset, e.Width, e.Height, sha256.Sum256(e.Data))
+			case *CtEmbFile:
+				fmt.Fprintf(w, "--- file at %d: %s sha256:%x\n", e.Offset, e.Filename, sha256.Sum256(e.Data))
+			}
+		}
+	}
+	return nil
+}
+
+// formattingSpans 带样式的文本片段，每个一行：起始偏移量+字符数，然后是原始的 rich_text 属性。
+// 偏移量与锚定元素相同，每个锚定元素占一个字符
+func formattingSpans(n *rawNode) ([]string, error) {
+	if n.node.IsRichtxt&1 == 0 {
+		return nil, nil
+	}
+	var doc XmlDocument
+	if err := xml.Unmarshal([]byte(n.node.Txt), &doc); err != nil {
+		return nil, err
+	}
+	var widgets []int32
+	for _, c := range n.codeBoxes {
+		widgets = append(widgets, c.Offset)
+	}
+	for _, g := range n.grids {
+		widgets = append(widgets, g.Offset)
+	}
+	for _, img := range n.images {
+		widgets = append(widgets, img.Offset)
+	}
+	sort.Slice(widgets, func(i, j int) bool {
+		return widgets[i] < widgets[j]
+	})
+	var ret []string
+	var chars int32
+	for _, rt := range doc.RichTexts {
+		for len(widgets) > 0 && widgets[0] <= chars {
+			widgets = widgets[1:]
+			chars++
+		}
+		n := int32(utf8.RuneCountInString(rt.Text))
+		if attrs := richTextAttrs(rt); len(attrs) > 0 {
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "%d+%d", chars, n)
+			for _, a := range attrs {
+				fmt.Fprintf(&sb, " %s=%q", a[0], a[1])
+			}
+			ret = append(ret, sb.String())
+		}
+		chars += n
+	}
+	return ret, nil
+}
@@ -0,0 +1,69 @@
+package ctb
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func dumpDocument(t *testing.T, doc *rawDocument) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "doc.ctb")
+	if err := writeRawDocument(p, doc); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenFile(p, OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	var buf bytes.Buffer
+	if err := h.WriteTextDump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWriteTextDump(t *testing.T) {
+	out := dumpDocument(t, sampleDocument())
+	for _, want := range []string{
+		"# tree\n1 rich <\"&'>\n  2 code\n  5 empty rich\n3 \n",
+		"\n# node 1: rich <\"&'>\nsyntax: custom-colors\nflags: readonly bold #12ab34 icon=3\ntags: a b\n",
+		"--- formatting\n0+11 weight=\"heavy\" scale=\"h1\"\n11+5 link=\"node 2\"\n21+12 foreground=\"#ff0000\" indent=\"2\"\n",
+		"--- code-box #1: go\nif a < b && c {\n",
+		"\n# node 2: code\nsyntax: python\ncreated:",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump does not contain %q:\n%s", want, out)
+		}
+	}
+	if again := dumpDocument(t, sampleDocument()); again != out {
+		t.Errorf("dump is not stable")
+	}
+}
+
+func TestWriteTextDumpChanges(t *testing.T) {
+	base := dumpDocument(t, sampleDocument())
+	tests := []struct {
+		name   string
+		change func(doc *rawDocument)
+	}{
+		{"tags", func(doc *rawDocument) { doc.nodes[2].node.Tags = "new" }},
+		{"style", func(doc *rawDocument) {
+			doc.nodes[1].node.Txt = strings.Replace(doc.nodes[1].node.Txt, `weight="heavy"`, `style="italic"`, 1)
+		}},
+		{"link", func(doc *rawDocument) {
+			doc.nodes[1].node.Txt = strings.Replace(doc.nodes[1].node.Txt, `link="node 2"`, `link="node 3"`, 1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := sampleDocument()
+			tt.change(doc)
+			if dumpDocument(t, doc) == base {
+				t.Error("dump did not change")
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package ctb
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// EPUBOptions EPUB 导出的选项
+type EPUBOptions struct {
+	// 同时导出所有下级节点
+	WithChildren bool
+	// 书名；为空时使用第一个节点的名称
+	Title string
+	// 作者，可以为空
+	Author string
+	// 语言标签，如 "zh-CN"；为空表示 "en"
+	Language string
+}
+
+// epubStyleSheet 章节使用的样式，代码部分见 CodeHTMLStyleSheet
+const epubStyleSheet = `body { font-family: serif; line-height: 1.5; }
+h1.ct-node { border-bottom: 1px solid #ccc; padding-bottom: 0.2em; }
+p { margin: 0; }
+p.ct-empty { height: 1em; }
+.ct-mono { font-family: monospace; }
+.ct-small { font-size: smaller; }
+.ct-placeholder { color: #008a8c; font-style: italic; }
+pre.ct-code { padding: 0.5em; background: #f5f5f5; white-space: pre-wrap; word-wrap: break-word; font-size: 0.85em; }
+table.ct-table { border-collapse: collapse; margin: 0.5em 0; }
+table.ct-table th, table.ct-table td { border: 1px solid #999; padding: 0.2em 0.4em; vertical-align: top; }
+table.ct-table th { background: #eee; }
+img.ct-image { max-width: 100%; }
+` + CodeHTMLStyleSheet
+
+// ExportEPUB 将节点（id 为 0 时为整个文档）导出为 EPUB 3 电子书：每个节点一个章节，
+// 目录按节点层次嵌套，图片嵌入书中，代码框带高亮样式，指向书中节点与锚的内部链接改为章节内的链接
+func (r Handle) ExportEPUB(w io.Writer, id int32, opts EPUBOptions) error {
+	entries, err := r.subtree(id, opts.WithChildren)
+	if err != nil {
+		return err
+	}
+	if opts.Title == "" && len(entries) > 0 {
+		opts.Title = entries[0].node.Name
+	}
+	if opts.Language == "" {
+		opts.Language = "en"
+	}
+	e := &epubWriter{opts: opts, entries: entries, exported: map[int32]bool{}}
+	for _, n := range entries {
+		e.exported[n.node.Id] = true
+	}
+	for _, n := range entries {
+		c, err := r.GetNodeContentById(n.node.Id, nil)
+		if err != nil {
+			return fmt.Errorf("node %d: %w", n.node.Id, err)
+		}
+		chapter, err := e.chapter(n, c)
+		if err != nil {
+			return fmt.Errorf("node %d: %w", n.node.Id, err)
+		}
+		e.files = append(e.files, epubFile{name: epubChapterName(n.node.Id), mediaType: "application/xhtml+xml", data: []byte(chapter)})
+		e.chapters = append(e.chapters, epubChapterName(n.node.Id))
+		if n.node.UpdateTime.After(e.modified) {
+			e.modified = n.node.UpdateTime
+		}
+	}
+	return e.write(w)
+}
+
+// epubFile 书中 OEBPS 目录下的一个文件
+type epubFile struct {
+	name      string
+	mediaType string
+	data      []byte
+}
+
+type epubWriter struct {
+	opts     EPUBOptions
+	entries  []treeEntry
+	exported map[int32]bool
+	files    []epubFile // 章节与图片
+	chapters []string
+	modified time.Time
+}
+
+func epubChapterName(id int32) string {
+	return fmt.Sprintf("node%d.xhtml", id)
+}
+
+// epubAnchorId 锚名称对应的元素 id；锚名称可以包含任意字符，这里转换为合法的 XML 名称
+func epubAnchorId(name string) string {
+	var sb strings.Builder
+	sb.WriteString("anchor-")
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			sb.WriteRune(c)
+		default:
+			fmt.Fprintf(&sb, ".%x", c)
+		}
+	}
+	return sb.String()
+}
+
+// epubLink 链接对应的 href；指向导出范围以外节点的链接以及本地文件链接返回空串
+func (e *epubWriter) epubLink(link string) string {
+	l, ok := ParseLink(link)
+	switch {
+	case !ok:
+		return ""
+	case l.Kind == CtLinkWeb:
+		return l.Target
+	case l.Kind == CtLinkNode && e.exported[l.NodeId]:
+		href := epubChapterName(l.NodeId)
+		if l.Anchor != "" {
+			href += "#" + epubAnchorId(l.Anchor)
+		}
+		return href
+	}
+	return ""
+}
+
+// chapter 节点对应的 XHTML 章节
+func (e *epubWriter) chapter(n treeEntry, c *CtNodeContent) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader + "\n<!DOCTYPE html>\n")
+	fmt.Fprintf(&sb, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">`+"\n", xmlText(e.opts.Language), xmlText(e.opts.Language))
+	fmt.Fprintf(&sb, "<head><title>%s</title><link rel=\"stylesheet\" type=\"text/css\" href=\"style.css\"/></head>\n<body>\n", xmlText(n.node.Name))
+	fmt.Fprintf(&sb, "<section epub:type=\"chapter\" id=\"node%d\">\n<h1 class=\"ct-node\">%s</h1>\n", n.node.Id, xmlText(n.node.Name))
+	if !c.IsRichText {
+		if err := RenderCodeHTML(&sb, c.Code, c.Language, HighlightOptions{}); err != nil {
+			return "", err
+		}
+		sb.WriteString("\n")
+	} else {
+		for _, line := range c.Lines {
+			if err := e.line(&sb, n.node.Id, line); err != nil {
+				return "", err
+			}
+		}
+	}
+	sb.WriteString("</section>\n</body>\n</html>\n")
+	return sb.String(), nil
+}
+
+// line 富文本中的一行作为一个段落，整行为同一级标题时作为标题；代码框与表格在段落之外
+func (e *epubWriter) line(sb *strings.Builder, nodeId int32, line CtLine) error {
+	tag, class := "p", ""
+	if heading := lineHeading(line); heading > 0 {
+		// h1 用于节点名称
+		level := heading + 1
+		if level > 6 {
+			level = 6
+		}
+		tag = fmt.Sprintf("h%d", level)
+	}
+	open := false
+	openParagraph := func() {
+		if open {
+			return
+		}
+		attrs := ""
+		if class != "" {
+			attrs = fmt.Sprintf(` class="%s"`, class)
+		}
+		if align := lineAlignment(line); align != "" {
+			attrs += fmt.Sprintf(` style="text-align: %s"`, align)
+		}
+		fmt.Fprintf(sb, "<%s%s>", tag, attrs)
+		open = true
+	}
+	closeParagraph := func() {
+		if open {
+			fmt.Fprintf(sb, "</%s>\n", tag)
+			open = false
+		}
+	}
+	if len(line) == 0 {
+		sb.WriteString("<p class=\"ct-empty\"></p>\n")
+		return nil
+	}
+	for _, el := range line {
+		switch el := el.(type) {
+		case *CtText:
+			openParagraph()
+			e.text(sb, el)
+		case *CtCodeBox:
+			closeParagraph()
+			if err := RenderCodeHTML(sb, el.Code, el.Language, HighlightOptionsOf(el)); err != nil {
+				return err
+			}
+			sb.WriteString("\n")
+		case *CtTable:
+			closeParagraph()
+			e.table(sb, el)
+		case *CtPng:
+			openParagraph()
+			name := fmt.Sprintf("images/node%d_%d.png", nodeId, el.Offset)
+			e.files = append(e.files, epubFile{name: name, mediaType: "image/png", data: el.Data})
+			fmt.Fprintf(sb, `<img class="ct-image" src="%s" alt=""/>`, name)
+		case *CtAnchor:
+			openParagraph()
+			fmt.Fprintf(sb, `<span id="%s"></span>`, epubAnchorId(el.Name))
+		case CtAnchoredWidget:
+			openParagraph()
+			fmt.Fprintf(sb, `<span class="ct-placeholder">%s</span>`, xmlText(DefaultPlaceholder(el)))
+		}
+	}
+	closeParagraph()
+	return nil
+}
+
+// lineHeading 行中所有非空文本都是同一级标题时返回其级别（1-6），否则返回 0
+func lineHeading(line CtLine) int {
+	level := 0
+	for _, el := range line {
+		t, ok := el.(*CtText)
+		if !ok {
+			return 0
+		}
+		if strings.TrimSpace(t.Text) == "" {
+			continue
+		}
+		if len(t.Scale) != 2 || t.Scale[0] != 'h' || t.Scale[1] < '1' || t.Scale[1] > '6' {
+			return 0
+		}
+		l := int(t.Scale[1] - '0')
+		if level != 0 && l != level {
+			return 0
+		}
+		level = l
+	}
+	return level
+}
+
+// lineAlignment 行的对齐方式（CSS 的 text-align），左对齐时为空
+func lineAlignment(line CtLine) string {
+	for _, el := range line {
+		var j string
+		switch el := el.(type) {
+		case *CtText:
+			j = el.Justification
+		case interface{ GetJustification() string }:
+			j = el.GetJustification()
+		}
+		switch j {
+		case "center", "right":
+			return j
+		case "fill":
+			return "justify"
+		}
+	}
+	return ""
+}
+
+// text 带样式的一段文本
+func (e *epubWriter) text(sb *strings.Builder, t *CtText) {
+	var styles, classes []string
+	if c, ok := parseColor(t.Foreground); ok {
+		styles = append(styles, fmt.Sprintf("color: #%02x%02x%02x", c.r, c.g, c.b))
+	}
+	if c, ok := parseColor(t.Background); ok {
+		styles = append(styles, fmt.Sprintf("background-color: #%02x%02x%02x", c.r, c.g, c.b))
+	}
+	if t.Family == "monospace" {
+		classes = append(classes, "ct-mono")
+	}
+	if t.Scale == "small" {
+		classes = append(classes, "ct-small")
+	}
+	var open, close []string
+	wrap := func(tag string) {
+		open = append(open, "<"+tag+">")
+		close = append([]string{"</" + tag + ">"}, close...)
+	}
+	if t.Weight == "heavy" {
+		wrap("strong")
+	}
+	if t.Style == "italic" {
+		wrap("em")
+	}
+	if t.Underline != "" {
+		wrap("u")
+	}
+	if t.Strikethrough == "true" {
+		wrap("s")
+	}
+	switch t.Scale {
+	case "sup", "sub":
+		wrap(t.Scale)
+	}
+	text := xmlText(t.Text)
+	if len(styles) > 0 || len(classes) > 0 {
+		attrs := ""
+		if len(classes) > 0 {
+			attrs += fmt.Sprintf(` class="%s"`, strings.Join(classes, " "))
+		}
+		if len(styles) > 0 {
+			attrs += fmt.Sprintf(` style="%s"`, xmlText(strings.Join(styles, "; ")))
+		}
+		text = "<span" + attrs + ">" + text + "</span>"
+	}
+	text = strings.Join(open, "") + text + strings.Join(close, "")
+	if t.Link != "" {
+		if href := e.epubLink(t.Link); href != "" {
+			text = fmt.Sprintf(`<a href="%s">%s</a>`, xmlText(href), text)
+		} else {
+			text = fmt.Sprintf(`<span title="%s">%s</span>`, xmlText(linkTarget(t.Link)), text)
+		}
+	}
+	sb.WriteString(text)
+}
+
+// table 第一行作为表头
+func (e *epubWriter) table(sb *strings.Builder, t *CtTable) {
+	sb.WriteString(`<table class="ct-table">`)
+	for i, row := range t.Data {
+		tag := "td"
+		if i == 0 {
+			tag = "th"
+			sb.WriteString("<thead>")
+		} else if i == 1 {
+			sb.WriteString("<tbody>")
+		}
+		sb.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(sb, "<%s>%s</%s>", tag, strings.ReplaceAll(xmlText(cell), "&#10;", "<br/>"), tag)
+		}
+		sb.WriteString("</tr>")
+		if i == 0 {
+			sb.WriteString("</thead>")
+		}
+	}
+	if len(t.Data) > 1 {
+		sb.WriteString("</tbody>")
+	}
+	sb.WriteString("</table>\n")
+}
+
+// identifier 书的唯一标识，由节点ID与名称生成，同一个子树多次导出时保持不变
+func (e *epubWriter) identifier() string {
+	h := sha1.New()
+	for _, n := range e.entries {
+		fmt.Fprintf(h, "%d %s\n", n.node.Id, n.node.Name)
+	}
+	s := h.Sum(nil)
+	s[6] = s[6]&0x0f | 0x50 // 基于 SHA-1 的 UUID（版本 5）
+	s[8] = s[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", s[0:4], s[4:6], s[6:8], s[8:10], s[10:16])
+}
+
+// nav EPUB 3 的导航文档，目录按节点层次嵌套
+func (e *epubWriter) nav() string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader + "\n<!DOCTYPE html>\n")
+	fmt.Fprintf(&sb, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">`+"\n", xmlText(e.opts.Language), xmlText(e.opts.Language))
+	fmt.Fprintf(&sb, "<head><title>%s</title></head>\n<body>\n<nav epub:type=\"toc\" id=\"toc\">\n<h1>%s</h1>\n", xmlText(e.opts.Title), xmlText(e.opts.Title))
+	e.nested(&sb, func(n treeEntry) string {
+		return fmt.Sprintf(`<li><a href="%s">%s</a>`, epubChapterName(n.node.Id), xmlText(n.node.Name))
+	}, "<ol>\n", "</ol>\n", "</li>\n")
+	sb.WriteString("</nav>\n</body>\n</html>\n")
+	return sb.String()
+}
+
+// nested 按深度输出嵌套的列表，item 返回列表项的开始部分
+func (e *epubWriter) nested(sb *strings.Builder, item func(n treeEntry) string, openList, closeList, closeItem string) {
+	depth := -1
+	for _, n := range e.entries {
+		if n.depth > depth {
+			for ; depth < n.depth; depth++ {
+				sb.WriteString(openList)
+			}
+		} else {
+			sb.WriteString(closeItem)
+			for ; depth > n.depth; depth-- {
+				sb.WriteString(closeList + closeItem)
+			}
+		}
+		sb.WriteString(item(n))
+	}
+	for ; depth >= 0; depth-- {
+		sb.WriteString(closeItem + closeList)
+	}
+}
+
+// ncx EPUB 2 的目录，供不支持导航文档的阅读器使用
+func (e *epubWriter) ncx() string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader + "\n")
+	sb.WriteString(`<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">` + "\n")
+	fmt.Fprintf(&sb, `<head><meta name="dtb:uid" content="%s"/></head>`+"\n", e.identifier())
+	fmt.Fprintf(&sb, "<docTitle><text>%s</text></docTitle>\n<navMap>\n", xmlText(e.opts.Title))
+	order := 0
+	e.nested(&sb, func(n treeEntry) string {
+		order++
+		return fmt.Sprintf(`<navPoint id="nav%d" playOrder="%d"><navLabel><text>%s</text></navLabel><content src="%s"/>`+"\n",
+			order, order, xmlText(n.node.Name), epubChapterName(n.node.Id))
+	}, "", "", "</navPoint>\n")
+	sb.WriteString("</navMap>\n</ncx>\n")
+	return sb.String()
+}
+
+// opf 包文档：元数据、清单与阅读顺序
+func (e *epubWriter) opf() string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader + "\n")
+	sb.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">` + "\n")
+	sb.WriteString(`<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	fmt.Fprintf(&sb, "<dc:identifier id=\"book-id\">%s</dc:identifier>\n", e.identifier())
+	fmt.Fprintf(&sb, "<dc:title>%s</dc:title>\n", xmlText(e.opts.Title))
+	fmt.Fprintf(&sb, "<dc:language>%s</dc:language>\n", xmlText(e.opts.Language))
+	if e.opts.Author != "" {
+		fmt.Fprintf(&sb, "<dc:creator>%s</dc:creator>\n", xmlText(e.opts.Author))
+	}
+	modified := e.modified
+	if modified.IsZero() {
+		modified = time.Unix(0, 0)
+	}
+	fmt.Fprintf(&sb, "<meta property=\"dcterms:modified\">%s</meta>\n</metadata>\n<manifest>\n", modified.UTC().Format("2006-01-02T15:04:05Z"))
+	sb.WriteString(`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>` + "\n")
+	sb.WriteString(`<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>` + "\n")
+	sb.WriteString(`<item id="css" href="style.css" media-type="text/css"/>` + "\n")
+	for i, f := range e.files {
+		fmt.Fprintf(&sb, "<item id=\"f%d\" href=\"%s\" media-type=\"%s\"/>\n", i+1, f.name, f.mediaType)
+	}
+	sb.WriteString("</manifest>\n<spine toc=\"ncx\">\n")
+	for i, f := range e.files {
+		if f.mediaType == "application/xhtml+xml" {
+			fmt.Fprintf(&sb, "<itemref idref=\"f%d\"/>\n", i+1)
+		}
+	}
+	sb.WriteString("</spine>\n</package>\n")
+	return sb.String()
+}
+
+// write 写入 EPUB 的 zip 包，mimetype 必须是第一个且不压缩
+func (e *epubWriter) write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, "application/epub+zip"); err != nil {
+		return err
+	}
+	files := []epubFile{
+		{name: "META-INF/container.xml", data: []byte(xmlHeader + "\n" +
+			`<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">` +
+			`<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>` + "\n")},
+		{name: "OEBPS/content.opf", data: []byte(e.opf())},
+		{name: "OEBPS/nav.xhtml", data: []byte(e.nav())},
+		{name: "OEBPS/toc.ncx", data: []byte(e.ncx())},
+		{name: "OEBPS/style.css", data: []byte(epubStyleSheet)},
+	}
+	for _, f := range e.files {
+		files = append(files, epubFile{name: "OEBPS/" + f.name, data: f.data})
+	}
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(file.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
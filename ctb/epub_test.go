@@ -0,0 +1,131 @@
+package ctb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readEPUB 按顺序返回书中的文件名与内容
+func readEPUB(t *testing.T, data []byte) ([]string, map[string]string) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	files := map[string]string{}
+	for i, f := range zr.File {
+		if i == 0 && (f.Name != "mimetype" || f.Method != zip.Store) {
+			t.Errorf("the first file is %s (method %d), want an uncompressed mimetype", f.Name, f.Method)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, f.Name)
+		files[f.Name] = string(content)
+	}
+	return names, files
+}
+
+func TestExportEPUB(t *testing.T) {
+	h := openDocument(t, sampleDocument())
+	var buf bytes.Buffer
+	if err := h.ExportEPUB(&buf, 0, EPUBOptions{Author: "me & you", Language: "zh-CN"}); err != nil {
+		t.Fatal(err)
+	}
+	names, files := readEPUB(t, buf.Bytes())
+	want := []string{
+		"mimetype", "META-INF/container.xml",
+		"OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/style.css",
+		"OEBPS/images/node1_19.png", "OEBPS/node1.xhtml", "OEBPS/node2.xhtml", "OEBPS/node5.xhtml", "OEBPS/node3.xhtml",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("files:\n got %q\nwant %q", names, want)
+	}
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype %q", files["mimetype"])
+	}
+	// 所有 XML 文件都是良构的
+	for name, content := range files {
+		if strings.HasSuffix(name, ".xhtml") || strings.HasSuffix(name, ".opf") || strings.HasSuffix(name, ".ncx") || strings.HasSuffix(name, ".xml") {
+			d := xml.NewDecoder(strings.NewReader(content))
+			d.Strict = true
+			d.Entity = xml.HTMLEntity
+			for {
+				if _, err := d.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Errorf("%s: %v\n%s", name, err, content)
+					break
+				}
+			}
+		}
+	}
+	for name, wants := range map[string][]string{
+		"OEBPS/content.opf": {
+			`<dc:title>rich &lt;&quot;&amp;'&gt;</dc:title>`, `<dc:creator>me &amp; you</dc:creator>`, `<dc:language>zh-CN</dc:language>`,
+			`<item id="f1" href="images/node1_19.png" media-type="image/png"/>`,
+			`<item id="f2" href="node1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine toc="ncx">` + "\n" + `<itemref idref="f2"/>`,
+		},
+		"OEBPS/nav.xhtml": {`<li><a href="node1.xhtml">rich &lt;&quot;&amp;'&gt;</a><ol>`, `<li><a href="node2.xhtml">code</a></li>`},
+		"OEBPS/node1.xhtml": {
+			`xml:lang="zh-CN"`,
+			// 指向书中节点的链接改为章节链接
+			`<a href="node2.xhtml">link </a>`,
+			`<span class="ct-brace" data-pair="1">{</span>`,
+			`<th>h1</th><th>h2</th>`, `<td>&lt;a&gt;</td>`,
+			`<img class="ct-image" src="images/node1_19.png" alt=""/>`,
+			`<span id="anchor-here"></span>`,
+		},
+		"OEBPS/node2.xhtml": {`print`},
+	} {
+		for _, w := range wants {
+			if !strings.Contains(files[name], w) {
+				t.Errorf("%s does not contain %s:\n%s", name, w, files[name])
+			}
+		}
+	}
+}
+
+func TestExportEPUBSubtree(t *testing.T) {
+	h := openDocument(t, sampleDocument())
+	var buf bytes.Buffer
+	if err := h.ExportEPUB(&buf, 2, EPUBOptions{Title: "Only code"}); err != nil {
+		t.Fatal(err)
+	}
+	names, files := readEPUB(t, buf.Bytes())
+	for _, name := range names {
+		if strings.HasPrefix(name, "OEBPS/node") && name != "OEBPS/node2.xhtml" {
+			t.Errorf("unexpected chapter %s", name)
+		}
+	}
+	if !strings.Contains(files["OEBPS/content.opf"], "<dc:title>Only code</dc:title>") {
+		t.Errorf("title:\n%s", files["OEBPS/content.opf"])
+	}
+
+	// 指向导出范围以外节点的链接去掉
+	buf.Reset()
+	if err := h.ExportEPUB(&buf, 1, EPUBOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	_, files = readEPUB(t, buf.Bytes())
+	if strings.Contains(files["OEBPS/node1.xhtml"], `href="node2.xhtml"`) {
+		t.Errorf("link to a node that is not exported:\n%s", files["OEBPS/node1.xhtml"])
+	}
+
+	if err := h.ExportEPUB(&bytes.Buffer{}, 99, EPUBOptions{}); !IsNotFound(err) {
+		t.Errorf("missing node: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package ctb
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CodeSnippetKind 代码片段的来源
+const (
+	CodeSnippetNode    = "code-node"         // 代码节点
+	CodeSnippetCodeBox = CtDocElementCodeBox // 富文本中的代码框
+)
+
+// CodeSnippet 文档中的一段代码：代码节点的内容或者一个代码框
+type CodeSnippet struct {
+	Kind     string   `json:"kind"`
+	NodeId   int32    `json:"nodeId"`
+	Path     []string `json:"path"`   // 从顶层节点到所在节点的名称
+	Offset   int32    `json:"offset"` // 代码框的偏移量，代码节点为 0
+	Language string   `json:"language"`
+	File     string   `json:"file,omitempty"` // 提取后的文件名（相对于输出目录）
+	Sha256   string   `json:"sha256"`
+	Lines    int      `json:"lines"`
+	Code     string   `json:"-"`
+}
+
+// codeManifestName 提取代码时写入的清单文件
+const codeManifestName = "manifest.json"
+
+// GetAllCodeSnippets 按节点树的顺序返回所有代码节点与代码框（纯文本节点不包括在内）
+func (r Handle) GetAllCodeSnippets() ([]CodeSnippet, error) {
+	withCodeBox, err := r.selectNodeIdsWithWidget(&tCodeBox{})
+	if err != nil {
+		return nil, err
+	}
+	var ret []CodeSnippet
+	err = r.walkNodes(0, nil, func(n *CtNode, path []string) error {
+		if !n.IsRichText && n.Syntax == CtNodeSyntaxPlainText || n.IsRichText && !withCodeBox[n.Id] {
+			return nil
+		}
+		c, err := r.GetNodeContentById(n.Id, nil)
+		if err != nil {
+			return err
+		}
+		if !n.IsRichText {
+			ret = append(ret, newCodeSnippet(CodeSnippetNode, n.Id, path, 0, c.Language, c.Code))
+			return nil
+		}
+		for _, line := range c.Lines {
+			for _, e := range line {
+				if cb, ok := e.(*CtCodeBox); ok {
+					ret = append(ret, newCodeSnippet(CodeSnippetCodeBox, n.Id, path, cb.Offset, cb.Language, cb.Code))
+				}
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+func newCodeSnippet(kind string, id int32, path []string, offset int32, lang, code string) CodeSnippet {
+	lines := strings.Count(code, "\n")
+	if code != "" && !strings.HasSuffix(code, "\n") {
+		lines++
+	}
+	return CodeSnippet{
+		Kind:     kind,
+		NodeId:   id,
+		Path:     path,
+		Offset:   offset,
+		Language: lang,
+		Sha256:   fmt.Sprintf("%x", sha256.Sum256([]byte(code))),
+		Lines:    lines,
+		Code:     code,
+	}
+}
+
+// ExtractCode 将所有代码节点与代码框写入目录 dir，扩展名由语言决定，文件名由节点路径（代码框还有偏移量）组成，
+// 如 "Runbook_Deploy_42.sh"；同时写入清单 manifest.json，返回写入的代码片段
+func (r Handle) ExtractCode(dir string) ([]CodeSnippet, error) {
+	snippets, err := r.GetAllCodeSnippets()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	names := uniqueNames{}
+	names.next(codeManifestName, nil)
+	for i := range snippets {
+		s := &snippets[i]
+		ext := LanguageExtension(s.Language)
+		var base string
+		if s.Kind == CodeSnippetCodeBox {
+			base = widgetFileName(s.Path, s.NodeId, s.Offset)
+		} else {
+			path := s.Path
+			// 节点名称本身就是文件名时不重复扩展名
+			if last := len(path) - 1; last >= 0 {
+				if name := safeFileName(path[last]); strings.HasSuffix(strings.ToLower(name), ext) {
+					path = append(append([]string(nil), path[:last]...), name[:len(name)-len(ext)])
+				}
+			}
+			base = pathFileName(path, s.NodeId)
+		}
+		s.File = names.next(base+ext, func(name string, n int) string {
+			return fmt.Sprintf("%s~%d%s", strings.TrimSuffix(name, ext), n, ext)
+		})
+		if err := os.WriteFile(filepath.Join(dir, s.File), []byte(s.Code), 0644); err != nil {
+			return nil, err
+		}
+	}
+	err = writeFile(filepath.Join(dir, codeManifestName), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if snippets == nil {
+			return enc.Encode([]CodeSnippet{})
+		}
+		return enc.Encode(snippets)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
@@ -0,0 +1,146 @@
+package ctb
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func codeDocument() *rawDocument {
+	now := time.Unix(1700000000, 0)
+	doc := newRawDocument()
+	code := func(id, fatherId, seq int32, name, syntax, txt string) {
+		n := newRawNode(id, fatherId, seq, name, now)
+		n.node.IsRichtxt = 0
+		n.node.Syntax = syntax
+		n.node.Txt = txt
+		doc.nodes[id] = n
+	}
+	runbook := newRawNode(1, 0, 1, "Runbook", now)
+	var b richTextBuilder
+	b.text("intro\n", XmlRichText{})
+	b.codeBox("echo hi\n", "sh")
+	b.text("\nthen\n", XmlRichText{})
+	b.codeBox("print(1)", "python")
+	b.build(runbook)
+	doc.nodes[1] = runbook
+	// 节点名称本身就是文件名
+	code(2, 1, 1, "deploy.sh", "sh", "#!/bin/sh\necho deploy\n")
+	// 与清单文件同名
+	code(3, 0, 2, "manifest", "json", "{}")
+	code(4, 0, 3, "notes", CtNodeSyntaxPlainText, "not code")
+	code(5, 0, 4, "Tool", "sh", "")
+	code(6, 0, 5, "tool", "sh", "a\nb")
+	doc.nodes[7] = newRawNode(7, 0, 6, "no code", now)
+	return doc
+}
+
+func TestExtractCode(t *testing.T) {
+	h := openDocument(t, codeDocument())
+	dir := filepath.Join(t.TempDir(), "out")
+	snippets, err := h.ExtractCode(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		Kind   string
+		NodeId int32
+		Offset int32
+		Lang   string
+		File   string
+		Lines  int
+	}
+	var got []summary
+	for _, s := range snippets {
+		got = append(got, summary{s.Kind, s.NodeId, s.Offset, s.Language, s.File, s.Lines})
+	}
+	want := []summary{
+		{CodeSnippetCodeBox, 1, 6, "sh", "Runbook_6.sh", 1},
+		{CodeSnippetCodeBox, 1, 13, "python", "Runbook_13.py", 1},
+		{CodeSnippetNode, 2, 0, "sh", "Runbook_deploy.sh", 2},
+		{CodeSnippetNode, 3, 0, "json", "manifest~2.json", 1},
+		{CodeSnippetNode, 5, 0, "sh", "Tool.sh", 0},
+		{CodeSnippetNode, 6, 0, "sh", "tool~2.sh", 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snippets:\n got %+v\nwant %+v", got, want)
+	}
+
+	// 清单与返回值相同（不含代码）
+	data, err := os.ReadFile(filepath.Join(dir, codeManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest []CodeSnippet
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != len(snippets) {
+		t.Fatalf("manifest has %d entries, want %d", len(manifest), len(snippets))
+	}
+	for i, s := range snippets {
+		code := s.Code
+		s.Code = ""
+		if !reflect.DeepEqual(manifest[i], s) {
+			t.Errorf("manifest[%d] = %+v, want %+v", i, manifest[i], s)
+		}
+		file, err := os.ReadFile(filepath.Join(dir, s.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(file) != code || s.Sha256 != fmt.Sprintf("%x", sha256.Sum256(file)) {
+			t.Errorf("%s: content %q, sha256 %s", s.File, file, s.Sha256)
+		}
+	}
+	if !strings.Contains(string(data), `"path": [
+      "Runbook",
+      "deploy.sh"
+    ]`) {
+		t.Errorf("manifest is not indented or has no path:\n%s", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(snippets)+1 {
+		t.Errorf("%d files in the output directory, want %d", len(entries), len(snippets)+1)
+	}
+}
+
+func TestExtractCodeEmpty(t *testing.T) {
+	h := openDocument(t, newRawDocument())
+	dir := t.TempDir()
+	snippets, err := h.ExtractCode(dir)
+	if err != nil || len(snippets) != 0 {
+		t.Fatalf("ExtractCode() = %v, %v", snippets, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, codeManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]\n" {
+		t.Errorf("manifest of an empty document: %q", data)
+	}
+}
+
+func TestFileNameLimit(t *testing.T) {
+	long := strings.Repeat("长", 100)
+	for _, tt := range []struct{ got, suffix string }{
+		{pathFileName([]string{"a", long}, 12), "长_12"},
+		{widgetFileName([]string{long, "b"}, 12, 34), "长_b_12_34"},
+	} {
+		if len(tt.got) > maxFileNameBytes || !utf8.ValidString(tt.got) || !strings.HasPrefix(tt.got, "…") || !strings.HasSuffix(tt.got, tt.suffix) {
+			t.Errorf("%q (%d bytes)", tt.got, len(tt.got))
+		}
+	}
+	if got := widgetFileName([]string{"a/b", "c"}, 12, 34); got != "a_b_c_34" {
+		t.Errorf("short name: %q", got)
+	}
+}
@@ -0,0 +1,44 @@
+package ctb
+
+import (
+	"time"
+)
+
+// CtNodeChange 变更列表与增量同步中的节点，创建、修改时间由 CtNode 提供
+type CtNodeChange struct {
+	*CtNode
+}
+
+// GetNodesModifiedSince 返回最后保存时间不早于 t 的节点，按保存时间、节点ID升序排列。
+// 时间戳精度为秒，边界值会被包含在内，增量同步时重复收到的节点应当按幂等处理。
+func (r Handle) GetNodesModifiedSince(t time.Time) ([]*CtNodeChange, error) {
+	list, err := r.selectNodeMetaModifiedSince(t.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return r.newCtNodeChanges(list)
+}
+
+// GetRecentlyCreated 返回最近创建的 n 个节点，按创建时间从新到旧排列
+func (r Handle) GetRecentlyCreated(n int) ([]*CtNodeChange, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	list, err := r.selectNodeMetaRecentlyCreated(n)
+	if err != nil {
+		return nil, err
+	}
+	return r.newCtNodeChanges(list)
+}
+
+func (r Handle) newCtNodeChanges(list []ptNodeMeta) ([]*CtNodeChange, error) {
+	fathers, err := r.selectFatherIds()
+	if err != nil {
+		return nil, err
+	}
+	var ret []*CtNodeChange
+	for i := range list {
+		ret = append(ret, &CtNodeChange{CtNode: NewCtNode(&list[i], fathers[list[i].NodeId])})
+	}
+	return ret, nil
+}
@@ -0,0 +1,290 @@
+package ctb
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// TokenKind 代码中一段文本的类别，对应 GtkSourceView 样式方案中的 def:* 样式
+type TokenKind string
+
+const (
+	TokenText        TokenKind = "text"
+	TokenKeyword     TokenKind = "keyword"
+	TokenType        TokenKind = "type"
+	TokenName        TokenKind = "name"
+	TokenBuiltin     TokenKind = "builtin"
+	TokenFunction    TokenKind = "function"
+	TokenString      TokenKind = "string"
+	TokenNumber      TokenKind = "number"
+	TokenComment     TokenKind = "comment"
+	TokenPreproc     TokenKind = "preproc"
+	TokenOperator    TokenKind = "operator"
+	TokenPunctuation TokenKind = "punctuation"
+	TokenBrace       TokenKind = "brace" // 括号，只在 HighlightBraces 时单独区分
+	TokenError       TokenKind = "error"
+	TokenInserted    TokenKind = "inserted" // diff 中新增的行
+	TokenDeleted     TokenKind = "deleted"  // diff 中删除的行
+	TokenHeading     TokenKind = "heading"
+)
+
+// CodeToken 代码中的一段文本及其类别
+type CodeToken struct {
+	Kind TokenKind `json:"kind"`
+	Text string    `json:"text"`
+	// 括号的配对编号，配对的两个括号编号相同；0 表示没有配对的括号
+	Pair int `json:"pair,omitempty"`
+}
+
+// HighlightOptions 渲染代码的选项，与代码框的设置对应
+type HighlightOptions struct {
+	ShowLineNumbers bool
+	HighlightBraces bool
+	// ANSI 渲染时使用 24 位真彩色，否则使用 256 色
+	TrueColor bool
+}
+
+// HighlightOptionsOf 代码框的显示设置
+func HighlightOptionsOf(cb *CtCodeBox) HighlightOptions {
+	return HighlightOptions{
+		ShowLineNumbers: cb.IsShowLineNumber,
+		HighlightBraces: cb.IsHighlightBraces,
+	}
+}
+
+// chromaLexerNames GtkSourceView 语言ID与 chroma 词法分析器名称不一致的部分
+var chromaLexerNames = map[string]string{
+	"sh":       "bash",
+	"python3":  "python",
+	"js":       "javascript",
+	"c-sharp":  "csharp",
+	"cpp":      "c++",
+	"dosbatch": "batchfile",
+	"objc":     "objective-c",
+	"vbnet":    "vb.net",
+	"latex":    "tex",
+	"html":     "html",
+	"xml":      "xml",
+	"ini":      "ini",
+	"markdown": "markdown",
+}
+
+// codeLexer 语言ID对应的词法分析器，无法识别时返回 nil
+func codeLexer(language string) chroma.Lexer {
+	id := NormalizeLanguage(language)
+	if id == CtNodeSyntaxPlainText || id == CtNodeSyntaxRichText {
+		return nil
+	}
+	if name, ok := chromaLexerNames[id]; ok {
+		if l := lexers.Get(name); l != nil {
+			return l
+		}
+	}
+	return lexers.Get(id)
+}
+
+// HighlightCode 将代码分解为带类别的文本片段；无法识别的语言整段作为 TokenText 返回
+func HighlightCode(code, language string, opts HighlightOptions) ([]CodeToken, error) {
+	var tokens []CodeToken
+	if lexer := codeLexer(language); lexer != nil {
+		it, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+		if err != nil {
+			return nil, err
+		}
+		for t := it(); t != chroma.EOF; t = it() {
+			tokens = appendToken(tokens, CodeToken{Kind: tokenKind(t.Type), Text: t.Value})
+		}
+		// 有的词法分析器会在末尾补一个换行
+		if !strings.HasSuffix(code, "\n") && len(tokens) > 0 {
+			last := &tokens[len(tokens)-1]
+			last.Text = strings.TrimSuffix(last.Text, "\n")
+			if last.Text == "" {
+				tokens = tokens[:len(tokens)-1]
+			}
+		}
+	} else if code != "" {
+		tokens = []CodeToken{{Kind: TokenText, Text: code}}
+	}
+	if opts.HighlightBraces {
+		tokens = matchBraces(tokens)
+	}
+	return tokens, nil
+}
+
+// appendToken 追加片段，与前一个片段类别相同时合并
+func appendToken(tokens []CodeToken, t CodeToken) []CodeToken {
+	if t.Text == "" {
+		return tokens
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].Kind == t.Kind && t.Kind != TokenBrace {
+		tokens[n-1].Text += t.Text
+		return tokens
+	}
+	return append(tokens, t)
+}
+
+func tokenKind(t chroma.TokenType) TokenKind {
+	switch {
+	case t == chroma.KeywordType:
+		return TokenType
+	case t.InCategory(chroma.Keyword):
+		return TokenKeyword
+	case t == chroma.NameBuiltin || t == chroma.NameBuiltinPseudo:
+		return TokenBuiltin
+	case t == chroma.NameFunction || t == chroma.NameFunctionMagic || t == chroma.NameDecorator:
+		return TokenFunction
+	case t == chroma.NameClass || t == chroma.NameNamespace:
+		return TokenType
+	case t == chroma.NameTag:
+		return TokenKeyword
+	case t.InCategory(chroma.Name):
+		return TokenName
+	case t.InSubCategory(chroma.LiteralString):
+		return TokenString
+	case t.InSubCategory(chroma.LiteralNumber):
+		return TokenNumber
+	case t.InSubCategory(chroma.CommentPreproc):
+		return TokenPreproc
+	case t.InCategory(chroma.Comment):
+		return TokenComment
+	case t.InCategory(chroma.Operator):
+		return TokenOperator
+	case t.InCategory(chroma.Punctuation):
+		return TokenPunctuation
+	case t == chroma.Error || t == chroma.GenericError:
+		return TokenError
+	case t == chroma.GenericInserted:
+		return TokenInserted
+	case t == chroma.GenericDeleted:
+		return TokenDeleted
+	case t == chroma.GenericHeading || t == chroma.GenericSubheading:
+		return TokenHeading
+	}
+	return TokenText
+}
+
+var braceOpen = map[rune]rune{'(': ')', '[': ']', '{': '}'}
+
+// matchBraces 把字符串与注释以外的括号拆成单独的片段，并为配对的括号编号
+func matchBraces(tokens []CodeToken) []CodeToken {
+	var ret []CodeToken
+	for _, t := range tokens {
+		switch t.Kind {
+		case TokenString, TokenComment, TokenPreproc:
+			ret = appendToken(ret, t)
+			continue
+		}
+		start := 0
+		for i, c := range t.Text {
+			if strings.ContainsRune("()[]{}", c) {
+				ret = appendToken(ret, CodeToken{Kind: t.Kind, Text: t.Text[start:i]})
+				ret = append(ret, CodeToken{Kind: TokenBrace, Text: string(c)})
+				start = i + 1
+			}
+		}
+		ret = appendToken(ret, CodeToken{Kind: t.Kind, Text: t.Text[start:]})
+	}
+	var stack []int
+	pair := 0
+	for i, t := range ret {
+		if t.Kind != TokenBrace {
+			continue
+		}
+		c := []rune(t.Text)[0]
+		if _, ok := braceOpen[c]; ok {
+			stack = append(stack, i)
+			continue
+		}
+		if n := len(stack); n > 0 && braceOpen[[]rune(ret[stack[n-1]].Text)[0]] == c {
+			pair++
+			ret[stack[n-1]].Pair = pair
+			ret[i].Pair = pair
+			stack = stack[:n-1]
+		}
+	}
+	return ret
+}
+
+// splitTokenLines 按行拆分片段，每行不含换行符；末尾的换行不产生空行
+func splitTokenLines(tokens []CodeToken) [][]CodeToken {
+	lines := [][]CodeToken{nil}
+	for _, t := range tokens {
+		parts := strings.Split(t.Text, "\n")
+		for i, p := range parts {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if p != "" {
+				pt := t
+				pt.Text = p
+				lines[len(lines)-1] = append(lines[len(lines)-1], pt)
+			}
+		}
+	}
+	if n := len(lines); n > 1 && lines[n-1] == nil {
+		lines = lines[:n-1]
+	}
+	return lines
+}
+
+// CodeHTMLStyleSheet RenderCodeHTML 输出使用的样式，颜色参照 GtkSourceView 的 classic 方案
+const CodeHTMLStyleSheet = `.ct-code { font-family: monospace; background: #fff; color: #000; }
+.ct-code .ct-ln { color: #888; user-select: none; }
+.ct-code .ct-keyword { color: #a52a2a; font-weight: bold; }
+.ct-code .ct-type { color: #2e8b57; font-weight: bold; }
+.ct-code .ct-builtin { color: #008a8c; }
+.ct-code .ct-function { color: #008a8c; }
+.ct-code .ct-string { color: #ff00ff; }
+.ct-code .ct-number { color: #ff00ff; }
+.ct-code .ct-comment { color: #0000ff; }
+.ct-code .ct-preproc { color: #a020f0; }
+.ct-code .ct-error { color: #ff0000; text-decoration: underline wavy; }
+.ct-code .ct-inserted { color: #008b00; }
+.ct-code .ct-deleted { color: #cd0000; }
+.ct-code .ct-heading { font-weight: bold; }
+.ct-code .ct-brace { font-weight: bold; }
+.ct-code .ct-brace-unmatched { background: #ff6666; }
+.ct-code .ct-brace.ct-active { background: #bebebe; }
+`
+
+// RenderCodeHTML 将代码渲染为 HTML 的 <pre> 元素，样式见 CodeHTMLStyleSheet；
+// 配对的括号带有相同的 data-pair 属性，页面可以据此在鼠标悬停时高亮
+func RenderCodeHTML(w io.Writer, code, language string, opts HighlightOptions) error {
+	tokens, err := HighlightCode(code, language, opts)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<pre class="ct-code ct-lang-%s"><code>`, html.EscapeString(NormalizeLanguage(language)))
+	lines := splitTokenLines(tokens)
+	width := len(fmt.Sprint(len(lines)))
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		if opts.ShowLineNumbers {
+			fmt.Fprintf(&sb, `<span class="ct-ln">%*d </span>`, width, i+1)
+		}
+		for _, t := range line {
+			text := html.EscapeString(t.Text)
+			switch {
+			case t.Kind == TokenBrace && t.Pair > 0:
+				fmt.Fprintf(&sb, `<span class="ct-brace" data-pair="%d">%s</span>`, t.Pair, text)
+			case t.Kind == TokenBrace:
+				fmt.Fprintf(&sb, `<span class="ct-brace ct-brace-unmatched">%s</span>`, text)
+			case t.Kind == TokenText || t.Kind == TokenName || t.Kind == TokenOperator || t.Kind == TokenPunctuation:
+				sb.WriteString(text)
+			default:
+				fmt.Fprintf(&sb, `<span class="ct-%s">%s</span>`, t.Kind, text)
+			}
+		}
+	}
+	sb.WriteString("</code></pre>")
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
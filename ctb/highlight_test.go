@@ -0,0 +1,101 @@
+package ctb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// braceSummary 括号片段及其配对编号，如 "(1"；同时检查片段连起来与原文相同
+func braceSummary(t *testing.T, tokens []CodeToken, code string) []string {
+	t.Helper()
+	var sb strings.Builder
+	var ret []string
+	for _, tok := range tokens {
+		sb.WriteString(tok.Text)
+		if tok.Kind == TokenBrace {
+			ret = append(ret, fmt.Sprintf("%s%d", tok.Text, tok.Pair))
+		} else if tok.Pair != 0 {
+			t.Errorf("%q: %v token has a pair", code, tok)
+		}
+	}
+	if sb.String() != code {
+		t.Errorf("tokens do not add up to the code: %q, want %q", sb.String(), code)
+	}
+	return ret
+}
+
+func TestMatchBraces(t *testing.T) {
+	text := func(s string) CodeToken { return CodeToken{Kind: TokenText, Text: s} }
+	tests := []struct {
+		name   string
+		tokens []CodeToken
+		want   []string
+	}{
+		{"nested", []CodeToken{text("f(a[1]) {x}")}, []string{"(2", "[1", "]1", ")2", "{3", "}3"}},
+		{"across tokens", []CodeToken{text("if ("), {Kind: TokenName, Text: "x"}, text(") {\n"), text("}")}, []string{"(1", ")1", "{2", "}2"}},
+		{"mismatched", []CodeToken{text("(]")}, []string{"(0", "]0"}},
+		{"unclosed", []CodeToken{text("((x)")}, []string{"(0", "(1", ")1"}},
+		{"extra closing", []CodeToken{text(")(")}, []string{")0", "(0"}},
+		{"crossing", []CodeToken{text("([)]")}, []string{"(0", "[1", ")0", "]1"}},
+		{"strings and comments", []CodeToken{
+			text("f("), {Kind: TokenString, Text: `")"`}, {Kind: TokenComment, Text: "/* { */"}, {Kind: TokenPreproc, Text: "#if (a"}, text(")"),
+		}, []string{"(1", ")1"}},
+		{"no braces", []CodeToken{text("a + b")}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		var code strings.Builder
+		for _, tok := range tt.tokens {
+			code.WriteString(tok.Text)
+		}
+		got := braceSummary(t, matchBraces(tt.tokens), code.String())
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	// 括号之间相同类别的片段合并
+	got := matchBraces([]CodeToken{text("a"), text("b("), text("c")})
+	want := []CodeToken{text("ab"), {Kind: TokenBrace, Text: "("}, text("c")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestHighlightCodeBraces(t *testing.T) {
+	const code = "func f(a []int) {\n\ts := \"{\" // }\n}"
+	tokens, err := HighlightCode(code, "go", HighlightOptions{HighlightBraces: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := braceSummary(t, tokens, code), []string{"(2", "[1", "]1", ")2", "{3", "}3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	tokens, err = HighlightCode(code, "go", HighlightOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := braceSummary(t, tokens, code); got != nil {
+		t.Errorf("braces without HighlightBraces: %q", got)
+	}
+	// 无法识别的语言也配对括号
+	tokens, err = HighlightCode("a(b]", "no-such-language", HighlightOptions{HighlightBraces: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := braceSummary(t, tokens, "a(b]"), []string{"(0", "]0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unknown language: got %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderCodeHTML(&buf, "f(x)]", CtNodeSyntaxPlainText, HighlightOptions{HighlightBraces: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<pre class="ct-code ct-lang-plain-text"><code>f<span class="ct-brace" data-pair="1">(</span>x` +
+		`<span class="ct-brace" data-pair="1">)</span><span class="ct-brace ct-brace-unmatched">]</span></code></pre>`
+	if buf.String() != want {
+		t.Errorf("RenderCodeHTML:\n got %s\nwant %s", buf.String(), want)
+	}
+}
@@ -0,0 +1,148 @@
+package ctb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// binarySniffLen 判断是否为二进制文件时检查的字节数
+const binarySniffLen = 8000
+
+// ImportDirectory 将目录树原样导入为新的 ctb 文档：目录成为带子节点的富文本节点，
+// 可识别语言的源代码文件成为代码节点，其他文本文件成为纯文本节点，二进制文件以附件的形式嵌入富文本节点。
+// 节点的创建与修改时间取文件的修改时间；以 . 开头的文件与目录会被忽略。
+func ImportDirectory(src, outPath string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	imp := &dirImporter{doc: newRawDocument(), nextId: 1}
+	if fi.IsDir() {
+		err = imp.addDir(src, 0)
+	} else {
+		err = imp.addFile(src, fi, 0, 1)
+	}
+	if err != nil {
+		return err
+	}
+	return writeRawDocument(outPath, imp.doc)
+}
+
+type dirImporter struct {
+	doc    *rawDocument
+	nextId int32
+	// 正在导入的各级目录的真实路径，用于发现符号链接形成的环
+	visiting map[string]bool
+}
+
+func (imp *dirImporter) newNode(fatherId, seq int32, fi os.FileInfo) *rawNode {
+	n := newRawNode(imp.nextId, fatherId, seq, fi.Name(), fi.ModTime())
+	imp.nextId++
+	imp.doc.nodes[n.node.NodeId] = n
+	return n
+}
+
+// dirEntry 目录项及其跟随符号链接后的信息
+type dirEntry struct {
+	path string
+	fi   os.FileInfo
+}
+
+func (imp *dirImporter) addDir(dir string, fatherId int32) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if imp.visiting == nil {
+		imp.visiting = map[string]bool{}
+	}
+	imp.visiting[real] = true
+	defer delete(imp.visiting, real)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var items []dirEntry
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		// 跟随符号链接
+		fi, err := os.Stat(path)
+		if err != nil {
+			if e.Type()&os.ModeSymlink != 0 {
+				log.Warnf("Skipped broken symbolic link %v: %v", path, err)
+				continue
+			}
+			return err
+		}
+		items = append(items, dirEntry{path, fi})
+	}
+	// 目录（包括指向目录的符号链接）在前，然后是文件，各自按名称排序
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].fi.IsDir() && !items[j].fi.IsDir()
+	})
+	var seq int32
+	for _, it := range items {
+		if it.fi.IsDir() {
+			if real, err := filepath.EvalSymlinks(it.path); err == nil && imp.visiting[real] {
+				log.Warnf("Skipped %v: symbolic link loop", it.path)
+				continue
+			}
+			seq++
+			n := imp.newNode(fatherId, seq, it.fi)
+			if err := imp.addDir(it.path, n.node.NodeId); err != nil {
+				return err
+			}
+		} else if it.fi.Mode().IsRegular() {
+			seq++
+			if err := imp.addFile(it.path, it.fi, fatherId, seq); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (imp *dirImporter) addFile(path string, fi os.FileInfo, fatherId, seq int32) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	n := imp.newNode(fatherId, seq, fi)
+	if isBinary(data) {
+		var b richTextBuilder
+		b.embFile(data, fi.Name(), fi.ModTime())
+		b.build(n)
+		return nil
+	}
+	syntax := LanguageFromFilename(fi.Name())
+	if syntax == "" {
+		syntax = CtNodeSyntaxPlainText
+	}
+	n.node.Syntax = syntax
+	n.node.IsRichtxt &^= 1
+	n.node.Txt = string(data)
+	return nil
+}
+
+// isBinary 含有 NUL 字节或不是合法 UTF-8 的内容视为二进制
+func isBinary(data []byte) bool {
+	head := data
+	if len(head) > binarySniffLen {
+		head = head[:binarySniffLen]
+		// 截断处可能切开了一个多字节字符
+		for i := 0; i < utf8.UTFMax && !utf8.Valid(head); i++ {
+			head = head[:len(head)-1]
+		}
+	}
+	return bytes.IndexByte(head, 0) >= 0 || !utf8.Valid(head)
+}
@@ -0,0 +1,122 @@
+package ctb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":         "package main\n",
+		"notes.txt":       "plain text\n",
+		"data.bin":        "\x00\x01\x02",
+		"latin1.txt":      "caf\xe9",
+		".git/config":     "hidden",
+		"src/lib.py":      "print(1)\n",
+		"src/deep/x.json": "{}",
+		"zdir/y.sh":       "echo y\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 指向上级目录的符号链接形成环，应当跳过；指向兄弟目录的符号链接照常导入，并且按目录排在文件之前
+	if err := os.Symlink("..", filepath.Join(dir, "src", "loop")); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	if err := os.Symlink("zdir", filepath.Join(dir, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(dir, "broken")); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out.ctb")
+	if err := ImportDirectory(dir, out); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := loadRawDocumentFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type node struct {
+		path   string
+		syntax string
+		text   string
+	}
+	var got []node
+	var walk func(fatherId int32, prefix string)
+	walk = func(fatherId int32, prefix string) {
+		for _, n := range doc.children(fatherId) {
+			text := ""
+			if n.node.IsRichtxt&1 == 0 {
+				text = n.node.Txt
+			}
+			got = append(got, node{prefix + n.node.Name, n.node.Syntax, text})
+			walk(n.node.NodeId, prefix+n.node.Name+"/")
+		}
+	}
+	walk(0, "")
+	want := []node{
+		{"alias", CtNodeSyntaxRichText, ""},
+		{"alias/y.sh", "sh", "echo y\n"},
+		{"src", CtNodeSyntaxRichText, ""},
+		{"src/deep", CtNodeSyntaxRichText, ""},
+		{"src/deep/x.json", "json", "{}"},
+		{"src/lib.py", "python", "print(1)\n"},
+		{"zdir", CtNodeSyntaxRichText, ""},
+		{"zdir/y.sh", "sh", "echo y\n"},
+		{"data.bin", CtNodeSyntaxRichText, ""},
+		{"latin1.txt", CtNodeSyntaxRichText, ""},
+		{"main.go", "go", "package main\n"},
+		{"notes.txt", CtNodeSyntaxPlainText, "plain text\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	// 二进制文件作为附件嵌入
+	for _, n := range doc.nodes {
+		if n.node.Name != "data.bin" {
+			continue
+		}
+		if len(n.images) != 1 || n.images[0].Filename != "data.bin" || string(n.images[0].Png) != files["data.bin"] {
+			t.Errorf("data.bin attachments %+v", n.images)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	long := make([]byte, binarySniffLen-1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"empty", nil, false},
+		{"ascii", []byte("hello\n"), false},
+		{"utf-8", []byte("中文"), false},
+		{"nul", []byte("a\x00b"), true},
+		{"invalid utf-8", []byte("caf\xe9"), true},
+		// 多字节字符被检查范围截断时不算作二进制
+		{"truncated at sniff length", append(long, "中文"...), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinary(tt.data); got != tt.want {
+				t.Errorf("isBinary = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
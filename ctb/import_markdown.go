@@ -0,0 +1,421 @@
+package ctb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// ImportMarkdown 将一个 Markdown 文件，或者包含 Markdown 文件的目录树，导入为新的 ctb 文档。
+// 每个目录与 .md 文件对应一个节点（不包含 Markdown 文件的目录会被忽略）；标题、强调、行内代码与链接转换为带样式的富文本，
+// 代码块转换为代码框，表格转换为 CherryTree 表格，本地图片嵌入为 PNG；指向其他已导入文件的链接转换为节点链接。
+func ImportMarkdown(src, outPath string) error {
+	imp := &markdownImporter{
+		doc:    newRawDocument(),
+		nextId: 1,
+		files:  map[string]*rawNode{},
+		md:     goldmark.New(goldmark.WithExtensions(extension.Table, extension.Strikethrough)),
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if _, err := imp.addDir(src, 0); err != nil {
+			return err
+		}
+	} else {
+		imp.addFile(src, fi, 0, 1)
+	}
+	for path, n := range imp.files {
+		if err := imp.convert(path, n); err != nil {
+			return fmt.Errorf("import %v: %w", path, err)
+		}
+	}
+	return writeRawDocument(outPath, imp.doc)
+}
+
+type markdownImporter struct {
+	doc    *rawDocument
+	nextId int32
+	files  map[string]*rawNode // md 文件的绝对路径 -> 节点
+	md     goldmark.Markdown
+}
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// addDir 为目录中的 md 文件与子目录创建节点，返回创建的节点数
+func (imp *markdownImporter) addDir(dir string, fatherId int32) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	var seq int32
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		fi, err := e.Info()
+		if err != nil {
+			return 0, err
+		}
+		if e.IsDir() {
+			seq++
+			n := newRawNode(imp.nextId, fatherId, seq, e.Name(), fi.ModTime())
+			imp.nextId++
+			sub, err := imp.addDir(path, n.node.NodeId)
+			if err != nil {
+				return 0, err
+			}
+			if sub == 0 {
+				// 目录中没有 md 文件，撤销
+				seq--
+				imp.nextId--
+				continue
+			}
+			imp.doc.nodes[n.node.NodeId] = n
+			count += sub + 1
+		} else if isMarkdownFile(e.Name()) {
+			seq++
+			imp.addFile(path, fi, fatherId, seq)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (imp *markdownImporter) addFile(path string, fi os.FileInfo, fatherId, seq int32) {
+	name := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+	n := newRawNode(imp.nextId, fatherId, seq, name, fi.ModTime())
+	imp.nextId++
+	imp.doc.nodes[n.node.NodeId] = n
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	imp.files[path] = n
+}
+
+func (imp *markdownImporter) convert(path string, n *rawNode) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	c := &markdownConverter{imp: imp, source: source, dir: filepath.Dir(path)}
+	root := imp.md.Parser().Parse(text.NewReader(source))
+	if err := c.blocks(root, 0); err != nil {
+		return err
+	}
+	c.b.build(n)
+	return nil
+}
+
+// markdownConverter 将一个 md 文件的语法树转换为富文本
+type markdownConverter struct {
+	imp    *markdownImporter
+	source []byte
+	dir    string
+	quote  int // 引用块的嵌套层数，引用内的文本使用斜体
+	b      richTextBuilder
+}
+
+// blockStyle 块内文本的基础样式
+func (c *markdownConverter) blockStyle(style XmlRichText) XmlRichText {
+	if c.quote > 0 {
+		style.Style = "italic"
+	}
+	return style
+}
+
+// newLine 确保接下来的内容从新的一行开始
+func (c *markdownConverter) newLine() {
+	if !c.b.empty() && !c.b.endsWith("\n") {
+		c.b.text("\n", XmlRichText{})
+	}
+}
+
+// newParagraph 确保接下来的内容与前面隔一个空行
+func (c *markdownConverter) newParagraph(depth int) {
+	if depth > 0 {
+		c.newLine()
+		return
+	}
+	c.newLine()
+	if !c.b.empty() && !c.b.endsWith("\n\n") {
+		c.b.text("\n", XmlRichText{})
+	}
+}
+
+func (c *markdownConverter) blocks(parent ast.Node, depth int) error {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		if err := c.block(n, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *markdownConverter) block(n ast.Node, depth int) error {
+	switch n := n.(type) {
+	case *ast.Heading:
+		c.newParagraph(depth)
+		level := n.Level
+		if level > 6 {
+			level = 6
+		}
+		c.inlines(n, c.blockStyle(XmlRichText{Scale: "h" + strconv.Itoa(level)}))
+		c.b.text("\n", XmlRichText{})
+	case *ast.Paragraph, *ast.TextBlock:
+		if n.PreviousSibling() != nil || depth == 0 {
+			c.newParagraph(depth)
+		}
+		c.inlines(n, c.blockStyle(XmlRichText{}))
+		c.b.text("\n", XmlRichText{})
+	case *ast.ThematicBreak:
+		c.newParagraph(depth)
+		c.b.text(strings.Repeat("─", 20)+"\n", XmlRichText{})
+	case *ast.FencedCodeBlock:
+		c.newParagraph(depth)
+		c.b.codeBox(c.lines(n), NormalizeLanguage(string(n.Language(c.source))))
+		c.b.text("\n", XmlRichText{})
+	case *ast.CodeBlock:
+		c.newParagraph(depth)
+		c.b.codeBox(c.lines(n), CtNodeSyntaxPlainText)
+		c.b.text("\n", XmlRichText{})
+	case *ast.HTMLBlock:
+		c.newParagraph(depth)
+		s := c.lines(n)
+		if n.HasClosure() {
+			s += "\n" + string(n.ClosureLine.Value(c.source))
+		}
+		c.b.text(strings.TrimRight(s, "\n")+"\n", XmlRichText{})
+	case *ast.Blockquote:
+		c.newParagraph(depth)
+		c.quote++
+		err := c.blocks(n, depth)
+		c.quote--
+		if err != nil {
+			return err
+		}
+	case *ast.List:
+		if depth == 0 {
+			c.newParagraph(depth)
+		} else {
+			c.newLine()
+		}
+		index := n.Start
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			c.newLine()
+			c.b.text(strings.Repeat("    ", depth), XmlRichText{})
+			if n.IsOrdered() {
+				c.b.text(fmt.Sprintf("%d. ", index), XmlRichText{})
+				index++
+			} else {
+				c.b.text("• ", XmlRichText{})
+			}
+			if err := c.blocks(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case *east.Table:
+		c.newParagraph(depth)
+		var rows [][]string
+		for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+			var cells []string
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				cells = append(cells, c.plainText(cell))
+			}
+			rows = append(rows, cells)
+		}
+		c.b.grid(rows)
+		c.b.text("\n", XmlRichText{})
+	default:
+		return c.blocks(n, depth)
+	}
+	return nil
+}
+
+// lines 代码块等按行存储的内容
+func (c *markdownConverter) lines(n ast.Node) string {
+	var buf bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		buf.Write(seg.Value(c.source))
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func (c *markdownConverter) inlines(parent ast.Node, style XmlRichText) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		c.inline(n, style)
+	}
+}
+
+func (c *markdownConverter) inline(n ast.Node, style XmlRichText) {
+	switch n := n.(type) {
+	case *ast.Text:
+		c.b.text(string(n.Segment.Value(c.source)), style)
+		if n.HardLineBreak() {
+			c.b.text("\n", XmlRichText{})
+		} else if n.SoftLineBreak() {
+			c.b.text(" ", style)
+		}
+	case *ast.String:
+		c.b.text(string(n.Value), style)
+	case *ast.CodeSpan:
+		style.Family = "monospace"
+		c.b.text(c.plainText(n), style)
+	case *ast.Emphasis:
+		if n.Level >= 2 {
+			style.Weight = "heavy"
+		} else {
+			style.Style = "italic"
+		}
+		c.inlines(n, style)
+	case *east.Strikethrough:
+		style.Strikethrough = "true"
+		c.inlines(n, style)
+	case *ast.Link:
+		style.Link = c.linkTarget(string(n.Destination))
+		c.inlines(n, style)
+	case *ast.AutoLink:
+		u := string(n.URL(c.source))
+		if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(u, "mailto:") {
+			u = "mailto:" + u
+		}
+		style.Link = "webs " + u
+		c.b.text(string(n.Label(c.source)), style)
+	case *ast.Image:
+		c.image(n, style)
+	case *ast.RawHTML:
+		for i := 0; i < n.Segments.Len(); i++ {
+			seg := n.Segments.At(i)
+			c.b.text(string(seg.Value(c.source)), style)
+		}
+	default:
+		c.inlines(n, style)
+	}
+}
+
+// plainText 行内内容的纯文本
+func (c *markdownConverter) plainText(parent ast.Node) string {
+	var sb strings.Builder
+	_ = ast.Walk(parent, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			sb.Write(n.Segment.Value(c.source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return sb.String()
+}
+
+// linkTarget 将 Markdown 链接转换为 CherryTree 的链接格式：
+// 网址为 "webs URL"，已导入的 md 文件为 "node ID"，其他本地文件与目录为 "file/fold base64(路径)"
+func (c *markdownConverter) linkTarget(dest string) string {
+	if u, err := url.Parse(dest); err == nil && u.Scheme != "" {
+		return "webs " + dest
+	}
+	p := dest
+	if i := strings.IndexByte(p, '#'); i >= 0 {
+		p = p[:i]
+	}
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	if p == "" {
+		return "webs " + dest
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(c.dir, p)
+	}
+	if n, ok := c.imp.files[p]; ok {
+		return fmt.Sprintf("node %d", n.node.NodeId)
+	}
+	if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+		return "fold " + base64.StdEncoding.EncodeToString([]byte(p))
+	}
+	return "file " + base64.StdEncoding.EncodeToString([]byte(p))
+}
+
+// image 本地图片嵌入为 PNG（其他格式转换为 PNG），远程图片与无法读取的图片保留为链接
+func (c *markdownConverter) image(n *ast.Image, style XmlRichText) {
+	dest := string(n.Destination)
+	alt := c.plainText(n)
+	if alt == "" {
+		alt = dest
+	}
+	fallback := func() {
+		style.Link = c.linkTarget(dest)
+		c.b.text(alt, style)
+	}
+	if u, err := url.Parse(dest); err != nil || u.Scheme != "" {
+		fallback()
+		return
+	}
+	p, err := url.PathUnescape(dest)
+	if err != nil {
+		p = dest
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(c.dir, p)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		log.Warnf("Cannot read image %v: %v", p, err)
+		fallback()
+		return
+	}
+	data, err = toPng(data)
+	if err != nil {
+		log.Warnf("Cannot decode image %v: %v", p, err)
+		fallback()
+		return
+	}
+	c.b.png(data, "")
+}
+
+// toPng 非 PNG 格式的图片重新编码为 PNG
+func toPng(data []byte) ([]byte, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "png" {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,131 @@
+package ctb
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// importMarkdownFiles 在临时目录中写入 files（相对路径 -> 内容），导入 src（相对路径）后读出文档
+func importMarkdownFiles(t *testing.T, files map[string]string, src string) *rawDocument {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(t.TempDir(), "out.ctb")
+	if err := ImportMarkdown(filepath.Join(dir, src), out); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := loadRawDocumentFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func richTextRuns(t *testing.T, n *rawNode) []XmlRichText {
+	t.Helper()
+	var doc XmlDocument
+	if err := xml.Unmarshal([]byte(n.node.Txt), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.RichTexts
+}
+
+func TestImportMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     []XmlRichText
+	}{
+		{"paragraph", "hello world", []XmlRichText{{Text: "hello world"}}},
+		{"heading", "# Title\n\nbody", []XmlRichText{{Scale: "h1", Text: "Title"}, {Text: "\n\nbody"}}},
+		{"deep heading", "######## not a heading", []XmlRichText{{Text: "######## not a heading"}}},
+		{"emphasis", "a *b* **c**", []XmlRichText{{Text: "a "}, {Style: "italic", Text: "b"}, {Text: " "}, {Weight: "heavy", Text: "c"}}},
+		{"inline code", "run `ls -l`", []XmlRichText{{Text: "run "}, {Family: "monospace", Text: "ls -l"}}},
+		{"strikethrough", "~~gone~~", []XmlRichText{{Strikethrough: "true", Text: "gone"}}},
+		{"web link", "[site](https://example.com)", []XmlRichText{{Link: "webs https://example.com", Text: "site"}}},
+		{"autolink", "<https://example.com>", []XmlRichText{{Link: "webs https://example.com", Text: "https://example.com"}}},
+		{"email autolink", "<me@example.com>", []XmlRichText{{Link: "webs mailto:me@example.com", Text: "me@example.com"}}},
+		{"unordered list", "- a\n- b", []XmlRichText{{Text: "• a\n• b"}}},
+		{"ordered list", "3. a\n4. b", []XmlRichText{{Text: "3. a\n4. b"}}},
+		{"quote", "> quoted", []XmlRichText{{Style: "italic", Text: "quoted"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := importMarkdownFiles(t, map[string]string{"note.md": tt.markdown}, "note.md")
+			if len(doc.nodes) != 1 || doc.nodes[1] == nil || doc.nodes[1].node.Name != "note" {
+				t.Fatalf("nodes %v, want a single node 1 named note", doc.sortedIds())
+			}
+			if got := richTextRuns(t, doc.nodes[1]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportMarkdownWidgets(t *testing.T) {
+	md := "intro\n\n```Go\nfmt.Println(1)\n```\n\n| h1 | h2 |\n|----|----|\n| a  | b  |\n"
+	doc := importMarkdownFiles(t, map[string]string{"note.md": md}, "note.md")
+	n := doc.nodes[1]
+	if len(n.codeBoxes) != 1 {
+		t.Fatalf("%d code boxes, want 1", len(n.codeBoxes))
+	}
+	if c := n.codeBoxes[0]; c.Txt != "fmt.Println(1)" || c.Syntax != "go" || c.Offset != 7 {
+		t.Errorf("code box %q (%s) at %d, want %q (go) at 7", c.Txt, c.Syntax, c.Offset, "fmt.Println(1)")
+	}
+	if len(n.grids) != 1 {
+		t.Fatalf("%d tables, want 1", len(n.grids))
+	}
+	table, err := ParseCtTable(&n.grids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"h1", "h2"}, {"a", "b"}}; !reflect.DeepEqual(table.Data, want) {
+		t.Errorf("table %v, want %v", table.Data, want)
+	}
+	if n.grids[0].Offset != 10 {
+		t.Errorf("table at %d, want 10", n.grids[0].Offset)
+	}
+}
+
+func TestImportMarkdownDirectory(t *testing.T) {
+	doc := importMarkdownFiles(t, map[string]string{
+		"a.md":           "see [b](sub/b.md) and [c](c.markdown#part)",
+		"c.markdown":     "c",
+		"empty/x.txt":    "no markdown here",
+		"sub/b.md":       "b",
+		"sub/.hidden.md": "hidden",
+		"readme.txt":     "ignored",
+	}, ".")
+	type node struct {
+		name     string
+		fatherId int32
+	}
+	got := map[int32]node{}
+	for id, n := range doc.nodes {
+		got[id] = node{n.node.Name, n.pos.FatherId}
+	}
+	want := map[int32]node{1: {"a", 0}, 2: {"c", 0}, 3: {"sub", 0}, 4: {"b", 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("nodes %v, want %v", got, want)
+	}
+	var links []string
+	for _, rt := range richTextRuns(t, doc.nodes[1]) {
+		if rt.Link != "" {
+			links = append(links, rt.Link)
+		}
+	}
+	if want := []string{"node 4", "node 2"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("links %v, want %v", links, want)
+	}
+}
@@ -0,0 +1,529 @@
+package ctb
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// DocumentJSONVersion 整个文档 JSON 格式的版本号，格式有不兼容的变化时递增
+const DocumentJSONVersion = 1
+
+// DocumentJSONSchemaId 与 DocumentJSONVersion 对应的 JSON Schema 的 $id
+const DocumentJSONSchemaId = "urn:cherrytree-api:document:v1"
+
+// DocumentJSONSchema 整个文档 JSON 格式的 JSON Schema（draft 2020-12）
+//
+//go:embed schema/document-v1.schema.json
+var DocumentJSONSchema []byte
+
+// JSONOptions 导出与导入 JSON 文档的选项
+type JSONOptions struct {
+	// 附件（图片与嵌入文件）所在的目录。为空时附件以 base64 内联在 JSON 中；
+	// 否则导出时附件按内容的 sha256 命名写入该目录，JSON 中只引用文件名，导入时从该目录读取
+	AttachmentDir string
+}
+
+// JSONDocument 整个文档的 JSON 形式
+type JSONDocument struct {
+	Schema    string      `json:"$schema"`
+	Version   int         `json:"version"`
+	Bookmarks []int32     `json:"bookmarks"`
+	Nodes     []*JSONNode `json:"nodes"` // 顶层节点，按顺序排列
+}
+
+// JSONNode 节点及其内容与子节点
+type JSONNode struct {
+	Id            int32       `json:"id"`
+	Name          string      `json:"name"`
+	Syntax        string      `json:"syntax"`
+	IsRichText    bool        `json:"isRichText"`
+	IsBold        bool        `json:"isBold"`
+	IsCustomColor bool        `json:"isCustomColor"`
+	Color         uint32      `json:"color"`
+	IsReadOnly    bool        `json:"isReadOnly"`
+	Icon          uint32      `json:"icon"`
+	Tags          string      `json:"tags,omitempty"`
+	MasterId      int32       `json:"masterId,omitempty"` // 共享节点的源节点ID
+	CreateTime    time.Time   `json:"createTime"`
+	UpdateTime    time.Time   `json:"updateTime"`
+	Content       JSONContent `json:"content,omitempty"` // 富文本节点的内容
+	Code          string      `json:"code,omitempty"`    // 代码与纯文本节点的内容
+	Children      []*JSONNode `json:"children,omitempty"`
+}
+
+// JSONElement 富文本内容中的元素，具体类型由 type 字段区分：
+// *JSONText、*JSONCodeBox、*JSONGrid、*JSONPng、*JSONEmbFile、*JSONAnchor
+type JSONElement interface {
+	jsonElement()
+}
+
+// JSONContent 按顺序排列的富文本元素；锚定元素的偏移量由它之前的文本长度决定
+type JSONContent []JSONElement
+
+// JSONText 一段带样式的文本；换行包含在文本中
+type JSONText struct {
+	Type string `json:"type"`
+	XmlRichText
+}
+
+// JSONCodeBox 代码框
+type JSONCodeBox struct {
+	Type              string `json:"type"`
+	Justification     string `json:"justification,omitempty"`
+	Code              string `json:"code"`
+	Language          string `json:"language"`
+	Width             int32  `json:"width"`
+	Height            int32  `json:"height"`
+	IsWidthPixel      bool   `json:"isWidthPixel"`
+	IsHighlightBraces bool   `json:"isHighlightBraces"`
+	IsShowLineNumber  bool   `json:"isShowLineNumber"`
+}
+
+// JSONGrid 表格，Rows 的第一行为表头
+type JSONGrid struct {
+	Type          string     `json:"type"`
+	Justification string     `json:"justification,omitempty"`
+	Rows          [][]string `json:"rows"`
+	ColWidths     []int      `json:"colWidths,omitempty"`
+	IsLight       bool       `json:"isLight,omitempty"`
+	MinColWidth   int32      `json:"minColWidth"`
+	MaxColWidth   int32      `json:"maxColWidth"`
+}
+
+// JSONAttachment 附件数据：Data 内联（base64），或者 Ref 引用附件目录中的文件；
+// Data 为指针，空附件也输出 "data": ""
+type JSONAttachment struct {
+	Data   *[]byte `json:"data,omitempty"`
+	Ref    string  `json:"ref,omitempty"`
+	Sha256 string  `json:"sha256"`
+}
+
+// JSONPng 图片
+type JSONPng struct {
+	Type          string `json:"type"`
+	Justification string `json:"justification,omitempty"`
+	Link          string `json:"link,omitempty"`
+	JSONAttachment
+}
+
+// JSONEmbFile 嵌入文件
+type JSONEmbFile struct {
+	Type          string `json:"type"`
+	Justification string `json:"justification,omitempty"`
+	Filename      string `json:"filename"`
+	Time          int64  `json:"time,omitempty"`
+	JSONAttachment
+}
+
+// JSONAnchor 锚
+type JSONAnchor struct {
+	Type          string `json:"type"`
+	Justification string `json:"justification,omitempty"`
+	Name          string `json:"name"`
+}
+
+func (*JSONText) jsonElement()    {}
+func (*JSONCodeBox) jsonElement() {}
+func (*JSONGrid) jsonElement()    {}
+func (*JSONPng) jsonElement()     {}
+func (*JSONEmbFile) jsonElement() {}
+func (*JSONAnchor) jsonElement()  {}
+
+// UnmarshalJSON 根据 type 字段解析为对应的元素类型
+func (c *JSONContent) UnmarshalJSON(data []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return err
+	}
+	ret := make(JSONContent, 0, len(raws))
+	for i, raw := range raws {
+		var head struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(raw, &head); err != nil {
+			return err
+		}
+		var e JSONElement
+		switch head.Type {
+		case CtDocElementText:
+			e = &JSONText{}
+		case CtDocElementCodeBox:
+			e = &JSONCodeBox{}
+		case CtDocElementTable:
+			e = &JSONGrid{}
+		case CtDocElementPng:
+			e = &JSONPng{}
+		case CtDocElementEmbFile:
+			e = &JSONEmbFile{}
+		case CtDocElementAnchor:
+			e = &JSONAnchor{}
+		default:
+			return fmt.Errorf("content[%d]: unknown element type %q", i, head.Type)
+		}
+		if err := json.Unmarshal(raw, e); err != nil {
+			return fmt.Errorf("content[%d]: %w", i, err)
+		}
+		ret = append(ret, e)
+	}
+	*c = ret
+	return nil
+}
+
+// ExportJSON 将整个文档导出为一个 JSON，格式见 DocumentJSONSchema
+func (r Handle) ExportJSON(w io.Writer, opts JSONOptions) error {
+	raw, err := r.loadRawDocument()
+	if err != nil {
+		return err
+	}
+	doc, err := newJSONDocument(raw, opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func newJSONDocument(raw *rawDocument, opts JSONOptions) (*JSONDocument, error) {
+	if opts.AttachmentDir != "" {
+		if err := os.MkdirAll(opts.AttachmentDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	doc := &JSONDocument{
+		Schema:    DocumentJSONSchemaId,
+		Version:   DocumentJSONVersion,
+		Bookmarks: append([]int32{}, raw.bookmarks...),
+	}
+	visited := map[int32]bool{}
+	var walk func(fatherId int32) ([]*JSONNode, error)
+	walk = func(fatherId int32) ([]*JSONNode, error) {
+		var ret []*JSONNode
+		for _, n := range raw.children(fatherId) {
+			if visited[n.node.NodeId] {
+				continue
+			}
+			visited[n.node.NodeId] = true
+			jn, err := newJSONNode(n, opts)
+			if err != nil {
+				return nil, err
+			}
+			if jn.Children, err = walk(n.node.NodeId); err != nil {
+				return nil, err
+			}
+			ret = append(ret, jn)
+		}
+		return ret, nil
+	}
+	var err error
+	if doc.Nodes, err = walk(0); err != nil {
+		return nil, err
+	}
+	// 从顶层无法到达的节点也放到顶层，不丢失数据：先是父节点不存在的节点，
+	// 然后是父节点形成环的节点（从环上 ID 最小的节点开始，环上其余的节点成为它的子孙）
+	for _, orphansOnly := range []bool{true, false} {
+		for _, id := range raw.sortedIds() {
+			if visited[id] {
+				continue
+			}
+			n := raw.nodes[id]
+			if _, ok := raw.nodes[n.pos.FatherId]; ok && orphansOnly {
+				continue
+			}
+			visited[id] = true
+			jn, err := newJSONNode(n, opts)
+			if err != nil {
+				return nil, err
+			}
+			if jn.Children, err = walk(id); err != nil {
+				return nil, err
+			}
+			doc.Nodes = append(doc.Nodes, jn)
+		}
+	}
+	return doc, nil
+}
+
+func newJSONNode(n *rawNode, opts JSONOptions) (*JSONNode, error) {
+	jn := &JSONNode{
+		Id:            n.node.NodeId,
+		Name:          n.node.Name,
+		Syntax:        n.node.Syntax,
+		IsRichText:    n.node.IsRichtxt&0b0001 != 0,
+		IsBold:        n.node.IsRichtxt&0b0010 != 0,
+		IsCustomColor: n.node.IsRichtxt&0b0100 != 0,
+		Color:         uint32(n.node.IsRichtxt >> 3),
+		IsReadOnly:    n.node.IsRo&0b1 != 0,
+		Icon:          uint32(n.node.IsRo >> 1),
+		Tags:          n.node.Tags,
+		MasterId:      n.pos.MasterId,
+		CreateTime:    time.Unix(int64(n.node.TsCreation), 0).UTC(),
+		UpdateTime:    time.Unix(int64(n.node.TsLastsave), 0).UTC(),
+	}
+	if !jn.IsRichText {
+		jn.Code = n.node.Txt
+		return jn, nil
+	}
+	var x XmlDocument
+	if err := xml.Unmarshal([]byte(n.node.Txt), &x); err != nil {
+		return nil, fmt.Errorf("node %d: %w", n.node.NodeId, err)
+	}
+	widgets, err := newJSONWidgets(n, opts)
+	if err != nil {
+		return nil, fmt.Errorf("node %d: %w", n.node.NodeId, err)
+	}
+	// 在锚定元素的偏移量处拆分文本
+	var chars int32
+	next := 0
+	for _, rt := range x.RichTexts {
+		runes := []rune(rt.Text)
+		for len(runes) > 0 && next < len(widgets) && widgets[next].offset < chars+int32(len(runes)) {
+			split := widgets[next].offset - chars
+			if split > 0 {
+				left := rt
+				left.Text = string(runes[:split])
+				jn.Content = append(jn.Content, &JSONText{Type: CtDocElementText, XmlRichText: left})
+				runes = runes[split:]
+				chars += split
+			}
+			jn.Content = append(jn.Content, widgets[next].element)
+			chars++
+			next++
+		}
+		if len(runes) > 0 || rt.Text == "" {
+			t := rt
+			t.Text = string(runes)
+			jn.Content = append(jn.Content, &JSONText{Type: CtDocElementText, XmlRichText: t})
+			chars += int32(len(runes))
+		}
+	}
+	for ; next < len(widgets); next++ {
+		jn.Content = append(jn.Content, widgets[next].element)
+	}
+	return jn, nil
+}
+
+type jsonWidget struct {
+	offset  int32
+	element JSONElement
+}
+
+// newJSONWidgets 节点的锚定元素，按偏移量排序
+func newJSONWidgets(n *rawNode, opts JSONOptions) ([]jsonWidget, error) {
+	var ret []jsonWidget
+	for _, c := range n.codeBoxes {
+		ret = append(ret, jsonWidget{c.Offset, &JSONCodeBox{
+			Type:              CtDocElementCodeBox,
+			Justification:     c.Justification,
+			Code:              c.Txt,
+			Language:          c.Syntax,
+			Width:             c.Width,
+			Height:            c.Height,
+			IsWidthPixel:      c.IsWidthPixel != 0,
+			IsHighlightBraces: c.DoHighlightBraces != 0,
+			IsShowLineNumber:  c.DoShowLineNumber != 0,
+		}})
+	}
+	for _, g := range n.grids {
+		rows, colWidths, isLight, err := parseGrid(g.Txt)
+		if err != nil {
+			return nil, fmt.Errorf("table at %d: %w", g.Offset, err)
+		}
+		ret = append(ret, jsonWidget{g.Offset, &JSONGrid{
+			Type:          CtDocElementTable,
+			Justification: g.Justification,
+			Rows:          rows,
+			ColWidths:     colWidths,
+			IsLight:       isLight,
+			MinColWidth:   g.ColMin,
+			MaxColWidth:   g.ColMax,
+		}})
+	}
+	for _, img := range n.images {
+		switch {
+		case img.Anchor != "":
+			ret = append(ret, jsonWidget{img.Offset, &JSONAnchor{
+				Type:          CtDocElementAnchor,
+				Justification: img.Justification,
+				Name:          img.Anchor,
+			}})
+		case img.Filename != "":
+			a, err := newJSONAttachment(img.Png, filepath.Ext(img.Filename), opts)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, jsonWidget{img.Offset, &JSONEmbFile{
+				Type:           CtDocElementEmbFile,
+				Justification:  img.Justification,
+				Filename:       img.Filename,
+				Time:           int64(img.Time),
+				JSONAttachment: a,
+			}})
+		default:
+			a, err := newJSONAttachment(img.Png, ".png", opts)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, jsonWidget{img.Offset, &JSONPng{
+				Type:           CtDocElementPng,
+				Justification:  img.Justification,
+				Link:           img.Link,
+				JSONAttachment: a,
+			}})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].offset < ret[j].offset
+	})
+	return ret, nil
+}
+
+func newJSONAttachment(data []byte, ext string, opts JSONOptions) (JSONAttachment, error) {
+	a := JSONAttachment{Sha256: fmt.Sprintf("%x", sha256.Sum256(data))}
+	if opts.AttachmentDir == "" {
+		if data == nil {
+			data = []byte{}
+		}
+		a.Data = &data
+		return a, nil
+	}
+	a.Ref = a.Sha256 + ext
+	p := filepath.Join(opts.AttachmentDir, a.Ref)
+	// 内容相同的附件只写一次
+	if _, err := os.Stat(p); err == nil {
+		return a, nil
+	}
+	return a, os.WriteFile(p, data, 0644)
+}
+
+// ImportJSON 读取 ExportJSON 导出的 JSON，写入新的 ctb 文档
+func ImportJSON(rd io.Reader, outPath string, opts JSONOptions) error {
+	var doc JSONDocument
+	if err := json.NewDecoder(rd).Decode(&doc); err != nil {
+		return err
+	}
+	if doc.Version != DocumentJSONVersion {
+		return fmt.Errorf("unsupported document version %d", doc.Version)
+	}
+	raw := newRawDocument()
+	var walk func(nodes []*JSONNode, fatherId int32) error
+	walk = func(nodes []*JSONNode, fatherId int32) error {
+		for i, jn := range nodes {
+			if _, ok := raw.nodes[jn.Id]; ok || jn.Id <= 0 {
+				return fmt.Errorf("invalid or duplicate node id %d", jn.Id)
+			}
+			n, err := newRawNodeFromJSON(jn, opts)
+			if err != nil {
+				return fmt.Errorf("node %d: %w", jn.Id, err)
+			}
+			n.pos = tChildren{NodeId: jn.Id, FatherId: fatherId, Sequence: int32(i + 1), MasterId: jn.MasterId}
+			raw.nodes[jn.Id] = n
+			if err := walk(jn.Children, jn.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(doc.Nodes, 0); err != nil {
+		return err
+	}
+	for _, id := range doc.Bookmarks {
+		if _, ok := raw.nodes[id]; ok {
+			raw.bookmarks = append(raw.bookmarks, id)
+		}
+	}
+	return writeRawDocument(outPath, raw)
+}
+
+func newRawNodeFromJSON(jn *JSONNode, opts JSONOptions) (*rawNode, error) {
+	n := &rawNode{node: tNode{
+		NodeId:     jn.Id,
+		Name:       jn.Name,
+		Syntax:     jn.Syntax,
+		Tags:       jn.Tags,
+		IsRo:       int32(jn.Icon)<<1 | boolToInt32(jn.IsReadOnly),
+		IsRichtxt:  int32(jn.Color)<<3 | boolToInt32(jn.IsCustomColor)<<2 | boolToInt32(jn.IsBold)<<1 | boolToInt32(jn.IsRichText),
+		TsCreation: int32(jn.CreateTime.Unix()),
+		TsLastsave: int32(jn.UpdateTime.Unix()),
+	}}
+	if !jn.IsRichText {
+		n.node.Txt = jn.Code
+		return n, nil
+	}
+	var (
+		runs  []XmlRichText
+		chars int32
+	)
+	for _, e := range jn.Content {
+		switch e := e.(type) {
+		case *JSONText:
+			runs = append(runs, e.XmlRichText)
+			chars += int32(utf8.RuneCountInString(e.Text))
+			continue
+		case *JSONCodeBox:
+			n.codeBoxes = append(n.codeBoxes, tCodeBox{
+				Offset:            chars,
+				Justification:     e.Justification,
+				Txt:               e.Code,
+				Syntax:            e.Language,
+				Width:             e.Width,
+				Height:            e.Height,
+				IsWidthPixel:      boolToInt32(e.IsWidthPixel),
+				DoHighlightBraces: boolToInt32(e.IsHighlightBraces),
+				DoShowLineNumber:  boolToInt32(e.IsShowLineNumber),
+			})
+		case *JSONGrid:
+			n.grids = append(n.grids, tGrid{
+				Offset:        chars,
+				Justification: e.Justification,
+				Txt:           marshalGrid(e.Rows, e.ColWidths, e.IsLight),
+				ColMin:        e.MinColWidth,
+				ColMax:        e.MaxColWidth,
+			})
+		case *JSONPng:
+			data, err := e.JSONAttachment.load(opts)
+			if err != nil {
+				return nil, err
+			}
+			n.images = append(n.images, tImage{Offset: chars, Justification: e.Justification, Png: data, Link: e.Link})
+		case *JSONEmbFile:
+			data, err := e.JSONAttachment.load(opts)
+			if err != nil {
+				return nil, err
+			}
+			n.images = append(n.images, tImage{Offset: chars, Justification: e.Justification, Png: data, Filename: e.Filename, Time: int32(e.Time)})
+		case *JSONAnchor:
+			n.images = append(n.images, tImage{Offset: chars, Justification: e.Justification, Anchor: e.Name})
+		}
+		chars++
+	}
+	n.node.Txt = marshalXmlDocument(&XmlDocument{RichTexts: runs})
+	return n, nil
+}
+
+// load 读取内联或引用的附件数据
+func (a JSONAttachment) load(opts JSONOptions) ([]byte, error) {
+	if a.Ref == "" {
+		if a.Data == nil {
+			return nil, errors.New("attachment has neither data nor ref")
+		}
+		return *a.Data, nil
+	}
+	if a.Ref != filepath.Base(a.Ref) || a.Ref == ".." {
+		return nil, fmt.Errorf("invalid attachment reference %q", a.Ref)
+	}
+	if opts.AttachmentDir == "" {
+		return nil, errors.New("attachment " + a.Ref + " is referenced but no attachment directory is given")
+	}
+	return os.ReadFile(filepath.Join(opts.AttachmentDir, a.Ref))
+}
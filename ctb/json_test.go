@@ -0,0 +1,87 @@
+package ctb
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	src := sampleDocument()
+	// 空附件
+	src.nodes[5].images = []tImage{{Offset: 0, Justification: "left", Png: nil, Filename: "empty.txt", Time: 1700000000}}
+	for _, attachmentDir := range []string{"", "attachments"} {
+		t.Run("attachment dir "+attachmentDir, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := JSONOptions{}
+			if attachmentDir != "" {
+				opts.AttachmentDir = filepath.Join(dir, attachmentDir)
+			}
+			doc, err := newJSONDocument(src, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := json.NewEncoder(&buf).Encode(doc); err != nil {
+				t.Fatal(err)
+			}
+			if attachmentDir == "" && !strings.Contains(buf.String(), `"filename":"empty.txt","time":1700000000,"data":"","sha256"`) {
+				t.Errorf("empty attachment has no data:\n%s", buf.String())
+			}
+			out := filepath.Join(dir, "out.ctb")
+			if err := ImportJSON(&buf, out, opts); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadRawDocumentFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := compareRawDocuments(src, got); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestExportJSONUnreachableNodes(t *testing.T) {
+	doc := newRawDocument()
+	now := time.Unix(1700000000, 0)
+	for _, n := range []struct{ id, fatherId int32 }{
+		{1, 3}, {2, 0}, {3, 1}, {4, 3}, {5, 9},
+	} {
+		doc.nodes[n.id] = newRawNode(n.id, n.fatherId, n.id, "", now)
+	}
+	jd, err := newJSONDocument(doc, JSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree func(nodes []*JSONNode) []interface{}
+	tree = func(nodes []*JSONNode) []interface{} {
+		var ret []interface{}
+		for _, n := range nodes {
+			ret = append(ret, n.Id)
+			if len(n.Children) > 0 {
+				ret = append(ret, tree(n.Children))
+			}
+		}
+		return ret
+	}
+	// 父节点不存在的节点 5 与环 1 → 3 → 1 都放到顶层
+	want := []interface{}{int32(2), int32(5), int32(1), []interface{}{int32(3), []interface{}{int32(4)}}}
+	if got := tree(jd.Nodes); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree %v, want %v", got, want)
+	}
+}
+
+func TestImportJSONMissingAttachment(t *testing.T) {
+	const doc = `{"version": 1, "bookmarks": [], "nodes": [{"id": 1, "name": "a", "syntax": "custom-colors", "isRichText": true,
+		"content": [{"type": "image-embfile", "filename": "x", "sha256": "00"}]}]}`
+	err := ImportJSON(strings.NewReader(doc), filepath.Join(t.TempDir(), "out.ctb"), JSONOptions{})
+	if err == nil || !strings.Contains(err.Error(), "neither data nor ref") {
+		t.Errorf("error %v, want an error about missing data", err)
+	}
+}
@@ -0,0 +1,243 @@
+package ctb
+
+import (
+	"strings"
+)
+
+type editOp int
+
+const (
+	opEqual editOp = iota
+	opDelete
+	opInsert
+)
+
+// edit 编辑脚本中的一步，a/b 分别是旧、新序列中的下标（不适用时为 -1）
+type edit struct {
+	op editOp
+	a  int
+	b  int
+}
+
+// diffSeq 使用 Myers 算法计算两个序列之间的最短编辑脚本。
+// 采用线性空间的分治版本：内存与序列长度成正比，不随编辑距离增长
+func diffSeq(n, m int, eq func(i, j int) bool) []edit {
+	d := &myersDiff{eq: eq}
+	d.compare(0, n, 0, m)
+	return d.edits
+}
+
+type myersDiff struct {
+	eq    func(i, j int) bool
+	edits []edit
+}
+
+// compare 比较 a[a0:a1] 与 b[b0:b1]，编辑脚本追加到 d.edits
+func (d *myersDiff) compare(a0, a1, b0, b1 int) {
+	// 去掉公共前缀与后缀
+	for a0 < a1 && b0 < b1 && d.eq(a0, b0) {
+		d.edits = append(d.edits, edit{opEqual, a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a1-suffix > a0 && b1-suffix > b0 && d.eq(a1-1-suffix, b1-1-suffix) {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.edits = append(d.edits, edit{opInsert, -1, j})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.edits = append(d.edits, edit{opDelete, i, -1})
+		}
+	default:
+		x, y := d.midpoint(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		d.compare(x, a1, y, b1)
+	}
+	for i := 0; i < suffix; i++ {
+		d.edits = append(d.edits, edit{opEqual, a1 + i, b1 + i})
+	}
+}
+
+// midpoint 从两端同时搜索，返回最短编辑路径经过的一个中间点；
+// 两个序列都不为空且首尾不同，所以这个点既不是起点也不是终点
+func (d *myersDiff) midpoint(a0, a1, b0, b1 int) (int, int) {
+	n, m := a1-a0, b1-b0
+	max := (n + m + 1) / 2
+	delta := n - m
+	off := max + 1
+	// vf[off+k]、vb[off+k] 分别是正向、反向搜索在对角线 k 上到达的最远距离
+	vf := make([]int, 2*max+3)
+	vb := make([]int, 2*max+3)
+	for D := 0; D <= max; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.eq(a0+x, b0+y) {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			// 反向搜索的对角线为 delta-k
+			if kr := delta - k; delta%2 != 0 && kr >= -(D-1) && kr <= D-1 && x+vb[off+kr] >= n {
+				return a0 + x, b0 + y
+			}
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.eq(a1-1-x, b1-1-y) {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if kf := delta - k; delta%2 == 0 && kf >= -D && kf <= D && x+vf[off+kf] >= n {
+				return a1 - x, b1 - y
+			}
+		}
+	}
+	// 不会到达这里：编辑距离不超过 n+m
+	return a1, b0
+}
+
+// pairEdits 遍历编辑脚本，把相邻的删除与插入两两配对为修改，其余的作为删除或插入
+func pairEdits(edits []edit, onChange func(a, b int), onDelete func(a int), onInsert func(b int)) {
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			i++
+			continue
+		}
+		var dels, ins []int
+		for ; i < len(edits) && edits[i].op != opEqual; i++ {
+			if edits[i].op == opDelete {
+				dels = append(dels, edits[i].a)
+			} else {
+				ins = append(ins, edits[i].b)
+			}
+		}
+		for len(dels) > 0 && len(ins) > 0 {
+			onChange(dels[0], ins[0])
+			dels, ins = dels[1:], ins[1:]
+		}
+		for _, a := range dels {
+			onDelete(a)
+		}
+		for _, b := range ins {
+			onInsert(b)
+		}
+	}
+}
+
+// DiffLine 行级差异中的一行，Op 为 " "（不变）、"-"（删除）或 "+"（新增）
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffHunk 一段带上下文的行级差异，行号从 1 开始
+type DiffHunk struct {
+	OldStart int        `json:"oldStart"`
+	OldLines int        `json:"oldLines"`
+	NewStart int        `json:"newStart"`
+	NewLines int        `json:"newLines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+const diffContextLines = 3
+
+// diffTextHunks 按行比较两段文本，返回带上下文的差异块；文本相同时返回 nil
+func diffTextHunks(oldText, newText string) []DiffHunk {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+	edits := diffSeq(len(a), len(b), func(i, j int) bool {
+		return a[i] == b[j]
+	})
+	var (
+		hunks   []DiffHunk
+		cur     *DiffHunk
+		lastChg = -1 // 上一个变化在 edits 中的位置
+	)
+	for i, e := range edits {
+		if e.op == opEqual {
+			continue
+		}
+		if cur == nil || i-lastChg-1 > 2*diffContextLines {
+			// 开始新的差异块：补齐上一个块的后置上下文
+			if cur != nil {
+				hunks = append(hunks, closeHunk(cur, edits, lastChg, a, b))
+			}
+			cur = &DiffHunk{}
+			start := i - diffContextLines
+			if start < 0 {
+				start = 0
+			}
+			for j := start; j < i; j++ {
+				appendHunkLine(cur, edits[j], a, b)
+			}
+		} else {
+			for j := lastChg + 1; j < i; j++ {
+				appendHunkLine(cur, edits[j], a, b)
+			}
+		}
+		appendHunkLine(cur, e, a, b)
+		lastChg = i
+	}
+	if cur != nil {
+		hunks = append(hunks, closeHunk(cur, edits, lastChg, a, b))
+	}
+	return hunks
+}
+
+func closeHunk(h *DiffHunk, edits []edit, lastChg int, a, b []string) DiffHunk {
+	for j := lastChg + 1; j < len(edits) && j <= lastChg+diffContextLines; j++ {
+		appendHunkLine(h, edits[j], a, b)
+	}
+	return *h
+}
+
+func appendHunkLine(h *DiffHunk, e edit, a, b []string) {
+	// 记录块的起始行号
+	if h.OldLines == 0 && h.NewLines == 0 {
+		switch e.op {
+		case opEqual:
+			h.OldStart, h.NewStart = e.a+1, e.b+1
+		case opDelete:
+			h.OldStart, h.NewStart = e.a+1, 0
+		case opInsert:
+			h.OldStart, h.NewStart = 0, e.b+1
+		}
+	}
+	if h.OldStart == 0 && e.a >= 0 {
+		h.OldStart = e.a + 1
+	}
+	if h.NewStart == 0 && e.b >= 0 {
+		h.NewStart = e.b + 1
+	}
+	switch e.op {
+	case opEqual:
+		h.Lines = append(h.Lines, DiffLine{Op: " ", Text: a[e.a]})
+		h.OldLines++
+		h.NewLines++
+	case opDelete:
+		h.Lines = append(h.Lines, DiffLine{Op: "-", Text: a[e.a]})
+		h.OldLines++
+	case opInsert:
+		h.Lines = append(h.Lines, DiffLine{Op: "+", Text: b[e.b]})
+		h.NewLines++
+	}
+}
@@ -0,0 +1,207 @@
+package ctb
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lcsLength 用动态规划计算最长公共子序列的长度，作为最短编辑脚本的参照
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] > dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+// checkEdits 检查编辑脚本能把 a 变为 b，并且是最短的
+func checkEdits(t *testing.T, a, b []string, edits []edit) {
+	t.Helper()
+	i, j, equal := 0, 0, 0
+	for _, e := range edits {
+		switch e.op {
+		case opEqual:
+			if e.a != i || e.b != j || a[i] != b[j] {
+				t.Fatalf("diff(%q, %q): invalid equal step %+v", a, b, e)
+			}
+			i++
+			j++
+			equal++
+		case opDelete:
+			if e.a != i || e.b != -1 {
+				t.Fatalf("diff(%q, %q): invalid delete step %+v", a, b, e)
+			}
+			i++
+		case opInsert:
+			if e.b != j || e.a != -1 {
+				t.Fatalf("diff(%q, %q): invalid insert step %+v", a, b, e)
+			}
+			j++
+		}
+	}
+	if i != len(a) || j != len(b) {
+		t.Fatalf("diff(%q, %q): script stops at (%d, %d)", a, b, i, j)
+	}
+	if want := lcsLength(a, b); equal != want {
+		t.Fatalf("diff(%q, %q): %d unchanged elements, want %d", a, b, equal, want)
+	}
+}
+
+func diffStrings(a, b []string) []edit {
+	return diffSeq(len(a), len(b), func(i, j int) bool {
+		return a[i] == b[j]
+	})
+}
+
+func TestDiffSeq(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string // 每一步：= 不变，- 删除，+ 新增
+	}{
+		{"both empty", "", "", ""},
+		{"insert all", "", "abc", "+++"},
+		{"delete all", "abc", "", "---"},
+		{"identical", "abc", "abc", "==="},
+		{"insert middle", "ac", "abc", "=+="},
+		{"delete middle", "abc", "ac", "=-="},
+		{"replace one", "abc", "axc", "=-+="},
+		{"replace all", "ab", "xy", "--++"},
+		{"common prefix and suffix", "abxyzcd", "abzcd", "==--==="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+			edits := diffStrings(a, b)
+			checkEdits(t, a, b, edits)
+			var sb strings.Builder
+			for _, e := range edits {
+				sb.WriteByte("=-+"[e.op])
+			}
+			if sb.String() != tt.want {
+				t.Errorf("got %s, want %s", sb.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSeqRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		s := make([]string, r.Intn(16))
+		for i := range s {
+			s[i] = string(rune('a' + r.Intn(4)))
+		}
+		return s
+	}
+	for i := 0; i < 5000; i++ {
+		a, b := random(), random()
+		checkEdits(t, a, b, diffStrings(a, b))
+	}
+}
+
+func TestDiffSeqLarge(t *testing.T) {
+	// 两段完全不同的长文本：编辑距离等于总长度，按编辑距离平方分配内存时需要数 GB
+	const n = 5000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = "old " + strconv.Itoa(i)
+		b[i] = "new " + strconv.Itoa(i)
+	}
+	edits := diffStrings(a, b)
+	if len(edits) != 2*n {
+		t.Fatalf("%d steps, want %d", len(edits), 2*n)
+	}
+}
+
+func TestDiffTextHunks(t *testing.T) {
+	lines := func(from, to int) string {
+		var s []string
+		for i := from; i <= to; i++ {
+			s = append(s, "line "+string(rune('a'+i-1)))
+		}
+		return strings.Join(s, "\n")
+	}
+	tests := []struct {
+		name     string
+		old, new string
+		want     []DiffHunk
+	}{
+		{"identical", "a\nb", "a\nb", nil},
+		{
+			"change with context",
+			lines(1, 10),
+			strings.Replace(lines(1, 10), "line e", "line E", 1),
+			[]DiffHunk{{
+				OldStart: 2, OldLines: 7, NewStart: 2, NewLines: 7,
+				Lines: []DiffLine{
+					{" ", "line b"}, {" ", "line c"}, {" ", "line d"},
+					{"-", "line e"}, {"+", "line E"},
+					{" ", "line f"}, {" ", "line g"}, {" ", "line h"},
+				},
+			}},
+		},
+		{
+			"insert at start",
+			"a\nb",
+			"x\na\nb",
+			[]DiffHunk{{
+				OldStart: 1, OldLines: 2, NewStart: 1, NewLines: 3,
+				Lines: []DiffLine{{"+", "x"}, {" ", "a"}, {" ", "b"}},
+			}},
+		},
+		{
+			"delete at end",
+			"a\nb\nc",
+			"a\nb",
+			[]DiffHunk{{
+				OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 2,
+				Lines: []DiffLine{{" ", "a"}, {" ", "b"}, {"-", "c"}},
+			}},
+		},
+		{
+			"distant changes in separate hunks",
+			lines(1, 20),
+			strings.Replace(strings.Replace(lines(1, 20), "line b", "B", 1), "line s", "S", 1),
+			[]DiffHunk{
+				{
+					OldStart: 1, OldLines: 5, NewStart: 1, NewLines: 5,
+					Lines: []DiffLine{
+						{" ", "line a"}, {"-", "line b"}, {"+", "B"},
+						{" ", "line c"}, {" ", "line d"}, {" ", "line e"},
+					},
+				},
+				{
+					OldStart: 16, OldLines: 5, NewStart: 16, NewLines: 5,
+					Lines: []DiffLine{
+						{" ", "line p"}, {" ", "line q"}, {" ", "line r"},
+						{"-", "line s"}, {"+", "S"}, {" ", "line t"},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffTextHunks(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package ctb
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// 链接的类型，即 link 属性的第一个单词
+const (
+	CtLinkWeb    = "webs"
+	CtLinkFile   = "file"
+	CtLinkFolder = "fold"
+	CtLinkNode   = "node"
+)
+
+// CtLink 解析后的链接
+type CtLink struct {
+	Kind   string
+	Target string // 网址或者本地路径
+	NodeId int32  // 内部链接指向的节点
+	Anchor string // 内部链接指向的锚，可以为空
+}
+
+// ParseLink 解析富文本的 link 属性，如 "webs https://..."、"node 12 anchor"、"file base64(路径)"
+func ParseLink(link string) (CtLink, bool) {
+	kind, target, _ := strings.Cut(link, " ")
+	switch kind {
+	case CtLinkWeb:
+		return CtLink{Kind: kind, Target: target}, target != ""
+	case CtLinkFile, CtLinkFolder:
+		path, err := base64.StdEncoding.DecodeString(target)
+		if err != nil {
+			return CtLink{}, false
+		}
+		return CtLink{Kind: kind, Target: string(path)}, len(path) > 0
+	case CtLinkNode:
+		id, anchor, _ := strings.Cut(target, " ")
+		nodeId, err := strconv.ParseInt(id, 10, 32)
+		if err != nil {
+			return CtLink{}, false
+		}
+		return CtLink{Kind: kind, NodeId: int32(nodeId), Anchor: anchor}, true
+	}
+	return CtLink{}, false
+}
+
+// String 链接的可读形式：网址、本地路径，或者 "node 12#anchor"
+func (l CtLink) String() string {
+	if l.Kind != CtLinkNode {
+		return l.Target
+	}
+	s := "node " + strconv.Itoa(int(l.NodeId))
+	if l.Anchor != "" {
+		s += "#" + l.Anchor
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package ctb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openMemoryDB 打开内存数据库。内存数据库只属于创建它的连接，连接池在连接出错或超时后换用的新连接上只有一个空数据库，
+// 所以所有操作都固定在同一个连接上；这个连接出错后查询会返回错误，而不是悄悄变成空文档
+func openMemoryDB() (*gorm.DB, error) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	db, err := gorm.Open(sqlite.Dialector{Conn: memoryConn{conn, sqlDB}}, &gorm.Config{
+		Logger: dbLogger(),
+	})
+	if err != nil {
+		_ = conn.Close()
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// memoryConn 内存数据库固定使用的连接
+type memoryConn struct {
+	*sql.Conn
+	db *sql.DB
+}
+
+// GetDBConn 供 gorm.DB.DB() 返回连接所属的连接池
+func (c memoryConn) GetDBConn() (*sql.DB, error) {
+	return c.db, nil
+}
+
+// sqliteHeader SQLite 数据库文件的开头
+const sqliteHeader = "SQLite format 3\x00"
+
+// openDBFromBytes 把 ctb 文件的内容载入内存数据库，不经过磁盘
+func openDBFromBytes(data []byte) (*gorm.DB, error) {
+	// WAL 模式的数据库不能直接在内存中打开，改为普通的日志模式（文件头第 18、19 字节）
+	if len(data) > 19 && data[18] == 2 && data[19] == 2 {
+		data = append([]byte(nil), data...)
+		data[18], data[19] = 1, 1
+	}
+	db, err := openMemoryDB()
+	if err != nil {
+		return nil, err
+	}
+	err = db.ConnPool.(memoryConn).Raw(func(dc interface{}) error {
+		c, ok := dc.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected sqlite driver connection %T", dc)
+		}
+		return c.Deserialize(data, "main")
+	})
+	if err == nil {
+		// Deserialize 不检查内容，这里读一次确认是 SQLite 数据库
+		err = db.Exec("SELECT COUNT(*) FROM sqlite_master").Error
+	}
+	if err != nil {
+		closeDB(db)
+		return nil, fmt.Errorf("load database: %w", err)
+	}
+	return db, nil
+}
+
+// openDBFromDocument 把文档写入新的内存数据库
+func openDBFromDocument(doc *rawDocument) (*gorm.DB, error) {
+	db, err := openMemoryDB()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRawDocumentDB(db, doc); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,234 @@
+package ctb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// sampleBytes sampleDocument 的 ctb 文件内容；wal 为 true 时文件使用 WAL 日志模式
+func sampleBytes(t *testing.T, wal bool) []byte {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "doc.ctb")
+	if err := writeRawDocument(p, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if wal {
+		h, err := OpenFile(p, OpenOptions{JournalMode: "WAL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkSample 确认 h 打开的是 sampleDocument
+func checkSample(t *testing.T, h *Handle) {
+	t.Helper()
+	got, err := h.loadRawDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareRawDocuments(sampleDocument(), got); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenBytes(t *testing.T) {
+	var ctd bytes.Buffer
+	if err := writeCTD(&ctd, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	wal := sampleBytes(t, true)
+	if wal[18] != 2 || wal[19] != 2 {
+		t.Fatalf("not a WAL database: %v", wal[18:20])
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"ctb", sampleBytes(t, false)},
+		{"ctb in WAL mode", wal},
+		{"ctd", ctd.Bytes()},
+		{"ctd with BOM", append([]byte("\ufeff\n"), ctd.Bytes()...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte(nil), tt.data...)
+			h, err := OpenBytes(data, OpenOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+			// 打开后修改 data 不影响文档
+			for i := range data {
+				data[i] = 0
+			}
+			checkSample(t, h)
+			if h.CtbFilepath != "" {
+				t.Errorf("CtbFilepath = %q", h.CtbFilepath)
+			}
+		})
+	}
+	if !bytes.Equal(wal[18:20], []byte{2, 2}) {
+		t.Error("OpenBytes modified the WAL header of its argument")
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"text", []byte("hello")},
+		{"damaged ctb", append([]byte(sqliteHeader), bytes.Repeat([]byte{0xff}, 200)...)},
+		{"damaged ctd", []byte("<cherrytree><node")},
+	} {
+		if h, err := OpenBytes(tt.data, OpenOptions{}); err == nil {
+			h.Close()
+			t.Errorf("%s: opened", tt.name)
+		}
+	}
+}
+
+func TestOpenBytesReadOnly(t *testing.T) {
+	for _, opts := range []OpenOptions{{ReadOnly: true}, {Immutable: true}} {
+		h, err := OpenBytes(sampleBytes(t, false), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.db.Exec("DELETE FROM node").Error; err == nil {
+			t.Errorf("%+v: document was modified", opts)
+		}
+		checkSample(t, h)
+		h.Close()
+	}
+	// 不是只读时可以修改内存中的文档
+	h, err := OpenBytes(sampleBytes(t, false), OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if err := h.db.Exec("DELETE FROM node").Error; err != nil {
+		t.Fatal(err)
+	}
+	if count, err := h.GetTotalNodesCount(); err != nil || count != 0 {
+		t.Errorf("GetTotalNodesCount() = %d, %v", count, err)
+	}
+}
+
+// TestOpenBytesPinnedConnection 内存文档的所有查询（包括并发的查询）都在同一个连接上，关闭后查询返回错误而不是空文档
+func TestOpenBytesPinnedConnection(t *testing.T) {
+	h, err := OpenBytes(sampleBytes(t, false), OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := h.GetNodeById(1); err != nil {
+					errs <- err
+				}
+				if _, err := h.GetSubNodesById(0); err != nil {
+					errs <- err
+				}
+				if _, err := h.GetNodeContentById(1, nil); err != nil {
+					errs <- err
+				}
+				if _, err := h.SearchNodes("code"); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := sqlDB.Stats().OpenConnections; n != 1 {
+		t.Errorf("%d open connections", n)
+	}
+	checkSample(t, h)
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if n := sqlDB.Stats().OpenConnections; n != 0 {
+		t.Errorf("%d open connections after Close", n)
+	}
+	if _, err := h.GetNodeById(1); err == nil {
+		t.Error("query after Close succeeded")
+	}
+	if count, err := h.GetTotalNodesCount(); err == nil {
+		t.Errorf("GetTotalNodesCount() after Close = %d", count)
+	}
+}
+
+func TestOpenReaderAt(t *testing.T) {
+	data := sampleBytes(t, false)
+	// 只读取 size 字节，之后的数据被忽略
+	padded := append(append([]byte("prefix"), data...), "suffix"...)
+	h, err := OpenReaderAt(bytes.NewReader(padded[len("prefix"):]), int64(len(data)), OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	checkSample(t, h)
+
+	if h, err := OpenReaderAt(bytes.NewReader(data), 10, OpenOptions{}); err == nil {
+		h.Close()
+		t.Error("opened the first 10 bytes of a document")
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	var ctd bytes.Buffer
+	if err := writeCTD(&ctd, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"notes/doc.ctb":  {Data: sampleBytes(t, false)},
+		"notes/doc.ctd":  {Data: ctd.Bytes()},
+		"notes/text.txt": {Data: []byte("hello")},
+	}
+	for _, name := range []string{"notes/doc.ctb", "notes/doc.ctd"} {
+		h, err := OpenFS(fsys, name, OpenOptions{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSample(t, h)
+		if h.CtbFilepath != name {
+			t.Errorf("CtbFilepath = %q", h.CtbFilepath)
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"notes/missing.ctb", "notes/text.txt"} {
+		if h, err := OpenFS(fsys, name, OpenOptions{}); err == nil {
+			h.Close()
+			t.Errorf("%s: opened", name)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package ctb
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MergeConflictContent      = "content"
+	MergeConflictName         = "name"
+	MergeConflictTags         = "tags"
+	MergeConflictAttributes   = "attributes"
+	MergeConflictPosition     = "position"
+	MergeConflictDeleteModify = "delete-modify" // 一方删除了节点，另一方修改了它（或在它下面添加了节点）
+	MergeConflictCycle        = "cycle"
+)
+
+// MergeOptions 三方合并选项
+type MergeOptions struct {
+	// DuplicateConflicts 为 true 时，内容冲突的节点保留 ours 的版本，并紧随其后插入一个带冲突标记、
+	// 包含 theirs 版本的副本节点；为 false 时只在合并结果中报告冲突
+	DuplicateConflicts bool
+}
+
+// MergeConflict 合并冲突，发生冲突时总是保留 ours 的版本（删除与修改冲突时保留被修改的版本）
+type MergeConflict struct {
+	NodeId      int32  `json:"nodeId"`
+	Kind        string `json:"kind"`
+	Message     string `json:"message"`
+	DuplicateId int32  `json:"duplicateId,omitempty"` // 包含 theirs 版本的副本节点
+}
+
+// MergeResult 合并结果
+type MergeResult struct {
+	Conflicts  []MergeConflict `json:"conflicts,omitempty"`
+	Renumbered map[int32]int32 `json:"renumbered,omitempty"` // 双方新增节点ID相同时，theirs 中节点的新ID
+}
+
+// MergeDocuments 以 base 为共同祖先，三方合并 ours 与 theirs 的节点树和节点内容，写入 outPath
+func MergeDocuments(base, ours, theirs *Handle, outPath string, opts MergeOptions) (*MergeResult, error) {
+	b, err := base.loadRawDocument()
+	if err != nil {
+		return nil, err
+	}
+	o, err := ours.loadRawDocument()
+	if err != nil {
+		return nil, err
+	}
+	t, err := theirs.loadRawDocument()
+	if err != nil {
+		return nil, err
+	}
+	merged, result := mergeRawDocuments(b, o, t, opts)
+	if err := writeRawDocument(outPath, merged); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type merger struct {
+	base, ours, theirs *rawDocument
+	out                *rawDocument
+	result             *MergeResult
+	nextId             int32
+	contentConflicts   []int32
+}
+
+func mergeRawDocuments(base, ours, theirs *rawDocument, opts MergeOptions) (*rawDocument, *MergeResult) {
+	m := &merger{
+		base:   base,
+		ours:   ours,
+		theirs: theirs,
+		out:    newRawDocument(),
+		result: &MergeResult{},
+	}
+	for _, d := range []*rawDocument{base, ours, theirs} {
+		if id := d.maxId(); id >= m.nextId {
+			m.nextId = id + 1
+		}
+	}
+	m.renumberTheirs()
+	ids := map[int32]bool{}
+	for _, d := range []*rawDocument{m.base, m.ours, m.theirs} {
+		for id := range d.nodes {
+			ids[id] = true
+		}
+	}
+	for _, id := range sortedKeys(ids) {
+		m.mergeNode(id)
+	}
+	m.restoreMissingFathers()
+	m.breakCycles()
+	m.mergeSiblingOrder()
+	if opts.DuplicateConflicts {
+		m.duplicateConflicts()
+	}
+	m.mergeBookmarks()
+	m.out.normalizeSequences()
+	return m.out, m.result
+}
+
+func (m *merger) conflict(id int32, kind, format string, args ...interface{}) {
+	m.result.Conflicts = append(m.result.Conflicts, MergeConflict{
+		NodeId:  id,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// renumberTheirs 双方都新增了同一个ID但内容不同（CherryTree 总是用最大ID+1），为 theirs 中的节点分配新ID
+func (m *merger) renumberTheirs() {
+	remap := map[int32]int32{}
+	for _, id := range m.theirs.sortedIds() {
+		if _, ok := m.base.nodes[id]; ok {
+			continue
+		}
+		if on, ok := m.ours.nodes[id]; ok && !rawNodeEqual(on, m.theirs.nodes[id]) {
+			remap[id] = m.nextId
+			m.nextId++
+		}
+	}
+	if len(remap) == 0 {
+		return
+	}
+	m.result.Renumbered = remap
+	m.theirs = m.theirs.renumbered(remap)
+}
+
+func (m *merger) mergeNode(id int32) {
+	bn, on, tn := m.base.nodes[id], m.ours.nodes[id], m.theirs.nodes[id]
+	switch {
+	case bn == nil && on != nil:
+		// ours 新增（theirs 同时新增的同ID节点已经被重新编号或者完全相同）
+		m.out.nodes[id] = on.clone()
+	case bn == nil:
+		m.out.nodes[id] = tn.clone()
+	case on == nil && tn == nil:
+		// 双方都删除了
+	case on == nil:
+		if rawNodeModified(bn, tn) {
+			m.conflict(id, MergeConflictDeleteModify, "node %q was deleted in ours but modified in theirs, keeping theirs", tn.node.Name)
+			m.out.nodes[id] = tn.clone()
+		}
+	case tn == nil:
+		if rawNodeModified(bn, on) {
+			m.conflict(id, MergeConflictDeleteModify, "node %q was deleted in theirs but modified in ours, keeping ours", on.node.Name)
+			m.out.nodes[id] = on.clone()
+		}
+	default:
+		m.out.nodes[id] = m.mergeExisting(bn, on, tn)
+	}
+}
+
+// mergeExisting 三方都存在的节点：名称、标签、属性、位置与内容分别合并
+func (m *merger) mergeExisting(b, o, t *rawNode) *rawNode {
+	id := o.node.NodeId
+	out := o.clone()
+	fromTheirs := false
+	pick := func(kind string, base, ours, theirs string) bool {
+		switch {
+		case ours == theirs || theirs == base:
+			return false
+		case ours == base:
+			fromTheirs = true
+			return true
+		default:
+			m.conflict(id, kind, "%s changed in both: ours %q, theirs %q", kind, ours, theirs)
+			return false
+		}
+	}
+	if pick(MergeConflictName, b.node.Name, o.node.Name, t.node.Name) {
+		out.node.Name = t.node.Name
+	}
+	if pick(MergeConflictTags, b.node.Tags, o.node.Tags, t.node.Tags) {
+		out.node.Tags = t.node.Tags
+	}
+	// 只读与图标
+	if pick(MergeConflictAttributes, strconv.Itoa(int(b.node.IsRo)), strconv.Itoa(int(o.node.IsRo)), strconv.Itoa(int(t.node.IsRo))) {
+		out.node.IsRo = t.node.IsRo
+	}
+	// 加粗与标题颜色（is_richtxt 的最低位表示富文本，属于内容）
+	style := func(n *rawNode) string {
+		return strconv.Itoa(int(n.node.IsRichtxt >> 1))
+	}
+	if pick(MergeConflictAttributes, style(b), style(o), style(t)) {
+		out.node.IsRichtxt = t.node.IsRichtxt&^1 | out.node.IsRichtxt&1
+	}
+	// 只合并父节点；插入或删除兄弟节点时 CherryTree 会重新编号 sequence，兄弟节点的顺序由 mergeSiblingOrder 按相对顺序合并
+	father := func(n *rawNode) string {
+		return strconv.Itoa(int(n.pos.FatherId))
+	}
+	if pick(MergeConflictPosition, father(b), father(o), father(t)) {
+		out.pos.FatherId = t.pos.FatherId
+	}
+	cb, co, ct := rawNodeContentKey(b), rawNodeContentKey(o), rawNodeContentKey(t)
+	switch {
+	case co == ct || ct == cb:
+	case co == cb:
+		out.node.Txt = t.node.Txt
+		out.node.Syntax = t.node.Syntax
+		out.node.IsRichtxt = out.node.IsRichtxt&^1 | t.node.IsRichtxt&1
+		out.codeBoxes = append([]tCodeBox(nil), t.codeBoxes...)
+		out.grids = append([]tGrid(nil), t.grids...)
+		out.images = append([]tImage(nil), t.images...)
+		fromTheirs = true
+	default:
+		m.conflict(id, MergeConflictContent, "content of node %q changed in both", o.node.Name)
+		m.contentConflicts = append(m.contentConflicts, id)
+	}
+	if fromTheirs && t.node.TsLastsave > out.node.TsLastsave {
+		out.node.TsLastsave = t.node.TsLastsave
+	}
+	return out
+}
+
+// restoreMissingFathers 一方删除了子树、另一方却在其中修改或添加了节点时，恢复被删除的父节点
+func (m *merger) restoreMissingFathers() {
+	for changed := true; changed; {
+		changed = false
+		for _, id := range m.out.sortedIds() {
+			fatherId := m.out.nodes[id].pos.FatherId
+			if fatherId == 0 {
+				continue
+			}
+			if _, ok := m.out.nodes[fatherId]; ok {
+				continue
+			}
+			for _, d := range []*rawDocument{m.ours, m.theirs, m.base} {
+				if f, ok := d.nodes[fatherId]; ok {
+					m.out.nodes[fatherId] = f.clone()
+					m.conflict(fatherId, MergeConflictDeleteModify, "node %q was deleted but node %d under it was kept, restoring it", f.node.Name, id)
+					changed = true
+					break
+				}
+			}
+			if _, ok := m.out.nodes[fatherId]; !ok {
+				m.out.nodes[id].pos.FatherId = 0
+				changed = true
+			}
+		}
+	}
+}
+
+// breakCycles 双方交叉移动节点可能形成环，把环上 ID 最小的节点移到顶层，环上其余的节点与子孙节点跟随它移动
+func (m *merger) breakCycles() {
+	for _, id := range m.out.sortedIds() {
+		seen := map[int32]bool{}
+		for cur := m.out.nodes[id].pos.FatherId; cur != 0 && !seen[cur]; cur = m.out.nodes[cur].pos.FatherId {
+			if cur == id {
+				m.out.nodes[id].pos.FatherId = 0
+				m.conflict(id, MergeConflictCycle, "moving node %q in both versions formed a cycle, moved it to the top level", m.out.nodes[id].node.Name)
+				break
+			}
+			// 祖先链进入了不包含 id 的环，这个环由环上的节点自己处理
+			seen[cur] = true
+		}
+	}
+}
+
+// mergeSiblingOrder 三方合并每组兄弟节点的顺序：以 ours 的顺序为准，theirs 中新增、移入或者相对顺序改变了
+// （ours 没有改变）的节点放到 theirs 中它前面最近的兄弟节点之后；双方都改变了同一个节点的顺序时保留 ours
+func (m *merger) mergeSiblingOrder() {
+	fathers := map[int32]bool{0: true}
+	for _, n := range m.out.nodes {
+		fathers[n.pos.FatherId] = true
+	}
+	for _, fatherId := range sortedKeys(fathers) {
+		in := map[int32]bool{}
+		for _, n := range m.out.children(fatherId) {
+			in[n.node.NodeId] = true
+		}
+		// siblings 合并结果中在 fatherId 下的节点在 d 中的顺序
+		siblings := func(d *rawDocument) []int32 {
+			var ret []int32
+			for _, id := range childIds(d, fatherId) {
+				if in[id] {
+					ret = append(ret, id)
+				}
+			}
+			return ret
+		}
+		base, ours, theirs := siblings(m.base), siblings(m.ours), siblings(m.theirs)
+		oursMoved, theirsMoved := reorderedSiblings(base, ours), reorderedSiblings(base, theirs)
+		inOurs := idSet(ours)
+		pending := map[int32]bool{}
+		for _, id := range theirs {
+			if !inOurs[id] || theirsMoved[id] && !oursMoved[id] {
+				pending[id] = true
+			} else if theirsMoved[id] && oursMoved[id] && previousIn(ours, id, idSet(theirs)) != previousIn(theirs, id, inOurs) {
+				m.conflict(id, MergeConflictPosition, "node %q was reordered in both, keeping the order of ours", m.out.nodes[id].node.Name)
+			}
+		}
+		var order []int32
+		for _, id := range ours {
+			if !pending[id] {
+				order = append(order, id)
+			}
+		}
+		placed := idSet(order)
+		for i, id := range theirs {
+			if !pending[id] {
+				continue
+			}
+			at := 0
+			for j := i - 1; j >= 0; j-- {
+				if placed[theirs[j]] {
+					at = indexOf(order, theirs[j]) + 1
+					break
+				}
+			}
+			order = append(order[:at], append([]int32{id}, order[at:]...)...)
+			placed[id] = true
+		}
+		// 不在任何一方这个父节点下的节点（恢复的父节点、为断开环而移到顶层的节点）放在最后
+		for _, n := range m.out.children(fatherId) {
+			if !placed[n.node.NodeId] {
+				order = append(order, n.node.NodeId)
+			}
+		}
+		for i, id := range order {
+			m.out.nodes[id].pos.Sequence = int32(i + 1)
+		}
+	}
+}
+
+// reorderedSiblings base 与 side 中都有的兄弟节点里，相对顺序改变了的节点
+func reorderedSiblings(base, side []int32) map[int32]bool {
+	inBase, inSide := idSet(base), idSet(side)
+	var x, y []int32
+	for _, id := range base {
+		if inSide[id] {
+			x = append(x, id)
+		}
+	}
+	for _, id := range side {
+		if inBase[id] {
+			y = append(y, id)
+		}
+	}
+	return idSet(reorderedIds(x, y))
+}
+
+// previousIn list 中 id 之前最近的、属于 set 的节点，没有时为 0
+func previousIn(list []int32, id int32, set map[int32]bool) int32 {
+	for i := indexOf(list, id) - 1; i >= 0; i-- {
+		if set[list[i]] {
+			return list[i]
+		}
+	}
+	return 0
+}
+
+func indexOf(list []int32, id int32) int {
+	for i, v := range list {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func idSet(ids []int32) map[int32]bool {
+	ret := map[int32]bool{}
+	for _, id := range ids {
+		ret[id] = true
+	}
+	return ret
+}
+
+// duplicateConflicts 为内容冲突的节点插入包含 theirs 版本的副本
+func (m *merger) duplicateConflicts() {
+	for _, id := range m.contentConflicts {
+		orig, ok := m.out.nodes[id]
+		if !ok {
+			continue
+		}
+		dup := m.theirs.nodes[id].clone()
+		dup.node.NodeId = m.nextId
+		dup.node.Name = orig.node.Name + " (theirs)"
+		dup.pos = tChildren{NodeId: m.nextId, FatherId: orig.pos.FatherId, Sequence: orig.pos.Sequence}
+		marker := fmt.Sprintf(">>>>>>> CONFLICT: theirs version of node %d %q, ours is kept in the original node\n", id, orig.node.Name)
+		if err := dup.prependText(marker); err != nil {
+			m.conflict(id, MergeConflictContent, "cannot write conflict markers: %v", err)
+			continue
+		}
+		m.out.nodes[m.nextId] = dup
+		for i := range m.result.Conflicts {
+			if c := &m.result.Conflicts[i]; c.NodeId == id && c.Kind == MergeConflictContent {
+				c.DuplicateId = m.nextId
+			}
+		}
+		m.nextId++
+	}
+}
+
+// mergeBookmarks 书签按集合三方合并：保留双方都有的，以及任意一方新增的
+func (m *merger) mergeBookmarks() {
+	inBase := map[int32]bool{}
+	for _, id := range m.base.bookmarks {
+		inBase[id] = true
+	}
+	inTheirs := map[int32]bool{}
+	for _, id := range m.theirs.bookmarks {
+		inTheirs[id] = true
+	}
+	added := map[int32]bool{}
+	keep := func(id int32) {
+		if _, ok := m.out.nodes[id]; ok && !added[id] {
+			added[id] = true
+			m.out.bookmarks = append(m.out.bookmarks, id)
+		}
+	}
+	for _, id := range m.ours.bookmarks {
+		if inTheirs[id] || !inBase[id] {
+			keep(id)
+		}
+	}
+	for _, id := range m.theirs.bookmarks {
+		if !inBase[id] {
+			keep(id)
+		}
+	}
+}
+
+func sortedKeys(set map[int32]bool) []int32 {
+	ids := make([]int32, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// clone 深拷贝
+func (n *rawNode) clone() *rawNode {
+	c := *n
+	c.codeBoxes = append([]tCodeBox(nil), n.codeBoxes...)
+	c.grids = append([]tGrid(nil), n.grids...)
+	c.images = append([]tImage(nil), n.images...)
+	return &c
+}
+
+// prependText 在节点内容的开头插入一段文本，锚定元素的偏移量随之后移
+func (n *rawNode) prependText(text string) error {
+	if n.node.IsRichtxt&1 == 0 {
+		n.node.Txt = text + n.node.Txt
+		return nil
+	}
+	var doc XmlDocument
+	if err := xml.Unmarshal([]byte(n.node.Txt), &doc); err != nil {
+		return err
+	}
+	doc.RichTexts = append([]XmlRichText{{Text: text}}, doc.RichTexts...)
+	n.node.Txt = marshalXmlDocument(&doc)
+	shift := int32(utf8.RuneCountInString(text))
+	for i := range n.codeBoxes {
+		n.codeBoxes[i].Offset += shift
+	}
+	for i := range n.grids {
+		n.grids[i].Offset += shift
+	}
+	for i := range n.images {
+		n.images[i].Offset += shift
+	}
+	return nil
+}
+
+// rawNodeContentKey 节点内容（正文、类型与所有锚定元素）的摘要
+func rawNodeContentKey(n *rawNode) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q|%q|%d\n", n.node.Syntax, n.node.Txt, n.node.IsRichtxt&1)
+	for _, c := range n.codeBoxes {
+		c.NodeId = 0
+		fmt.Fprintf(h, "%#v\n", c)
+	}
+	for _, g := range n.grids {
+		g.NodeId = 0
+		fmt.Fprintf(h, "%#v\n", g)
+	}
+	for _, img := range n.images {
+		img.NodeId = 0
+		fmt.Fprintf(h, "%#v\n", img)
+	}
+	return string(h.Sum(nil))
+}
+
+// rawNodeModified 节点的名称、属性或内容相对 base 是否有变化（不考虑位置）
+func rawNodeModified(base, n *rawNode) bool {
+	return base.node.Name != n.node.Name || base.node.Tags != n.node.Tags || base.node.IsRo != n.node.IsRo ||
+		base.node.IsRichtxt != n.node.IsRichtxt || rawNodeContentKey(base) != rawNodeContentKey(n)
+}
+
+func rawNodeEqual(a, b *rawNode) bool {
+	return !rawNodeModified(a, b) && a.pos.FatherId == b.pos.FatherId
+}
+
+// 节点内部链接形如 "node 12" 或 "node 12 anchor"
+var (
+	richTextNodeLinkPattern = regexp.MustCompile(`link="node (\d+)`)
+	imageNodeLinkPattern    = regexp.MustCompile(`^node (\d+)`)
+)
+
+// renumbered 返回按 remap 修改节点ID后的副本，父节点、书签以及指向这些节点的内部链接一并修改
+func (d *rawDocument) renumbered(remap map[int32]int32) *rawDocument {
+	mapId := func(id int32) int32 {
+		if n, ok := remap[id]; ok {
+			return n
+		}
+		return id
+	}
+	mapLinks := func(pattern *regexp.Regexp, s string) string {
+		return pattern.ReplaceAllStringFunc(s, func(link string) string {
+			i := strings.LastIndexByte(link, ' ') + 1
+			id, err := strconv.ParseInt(link[i:], 10, 32)
+			if err != nil {
+				return link
+			}
+			return link[:i] + strconv.Itoa(int(mapId(int32(id))))
+		})
+	}
+	ret := newRawDocument()
+	for id, n := range d.nodes {
+		c := n.clone()
+		newId := mapId(id)
+		c.node.NodeId = newId
+		c.pos.NodeId = newId
+		c.pos.FatherId = mapId(c.pos.FatherId)
+		if c.node.IsRichtxt&1 != 0 {
+			c.node.Txt = mapLinks(richTextNodeLinkPattern, c.node.Txt)
+		}
+		for i := range c.images {
+			c.images[i].Link = mapLinks(imageNodeLinkPattern, c.images[i].Link)
+		}
+		ret.nodes[newId] = c
+	}
+	for _, id := range d.bookmarks {
+		ret.bookmarks = append(ret.bookmarks, mapId(id))
+	}
+	return ret
+}
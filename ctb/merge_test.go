@@ -0,0 +1,275 @@
+package ctb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// mergeNode 测试用的纯文本节点
+type mergeNode struct {
+	id, fatherId, sequence int32
+	name, text             string
+}
+
+func mergeDoc(nodes ...mergeNode) *rawDocument {
+	doc := newRawDocument()
+	for _, n := range nodes {
+		raw := newRawNode(n.id, n.fatherId, n.sequence, n.name, time.Unix(1700000000, 0))
+		raw.node.Syntax = CtNodeSyntaxPlainText
+		raw.node.IsRichtxt = 0
+		raw.node.Txt = n.text
+		doc.nodes[n.id] = raw
+	}
+	return doc
+}
+
+// mergeSummary 合并结果中各节点的名称、父节点与文本
+func mergeSummary(doc *rawDocument) []mergeNode {
+	var ret []mergeNode
+	for _, id := range doc.sortedIds() {
+		n := doc.nodes[id]
+		ret = append(ret, mergeNode{id, n.pos.FatherId, 0, n.node.Name, n.node.Txt})
+	}
+	return ret
+}
+
+func conflictKinds(result *MergeResult) map[int32][]string {
+	ret := map[int32][]string{}
+	for _, c := range result.Conflicts {
+		ret[c.NodeId] = append(ret[c.NodeId], c.Kind)
+	}
+	for _, kinds := range ret {
+		sort.Strings(kinds)
+	}
+	return ret
+}
+
+func TestMergeRawDocuments(t *testing.T) {
+	base := []mergeNode{
+		{1, 0, 1, "a", "one"},
+		{2, 0, 2, "b", "two"},
+		{3, 1, 1, "c", "three"},
+	}
+	tests := []struct {
+		name          string
+		ours, theirs  []mergeNode
+		want          []mergeNode
+		wantConflicts map[int32][]string
+		wantRenumber  map[int32]int32
+	}{
+		{
+			name:   "unchanged",
+			ours:   base,
+			theirs: base,
+			want:   []mergeNode{{1, 0, 0, "a", "one"}, {2, 0, 0, "b", "two"}, {3, 1, 0, "c", "three"}},
+		},
+		{
+			name:   "independent changes",
+			ours:   []mergeNode{{1, 0, 1, "A", "one"}, {2, 0, 2, "b", "two"}, {3, 1, 1, "c", "three"}},
+			theirs: []mergeNode{{1, 0, 1, "a", "one"}, {2, 0, 2, "b", "TWO"}, {3, 1, 1, "c", "three"}},
+			want:   []mergeNode{{1, 0, 0, "A", "one"}, {2, 0, 0, "b", "TWO"}, {3, 1, 0, "c", "three"}},
+		},
+		{
+			name:          "content changed in both keeps ours",
+			ours:          []mergeNode{{1, 0, 1, "a", "ours"}, {2, 0, 2, "b", "two"}, {3, 1, 1, "c", "three"}},
+			theirs:        []mergeNode{{1, 0, 1, "a", "theirs"}, {2, 0, 2, "b", "two"}, {3, 1, 1, "c", "three"}},
+			want:          []mergeNode{{1, 0, 0, "a", "ours"}, {2, 0, 0, "b", "two"}, {3, 1, 0, "c", "three"}},
+			wantConflicts: map[int32][]string{1: {MergeConflictContent}},
+		},
+		{
+			name:          "deleted in ours, modified in theirs",
+			ours:          []mergeNode{{1, 0, 1, "a", "one"}, {3, 1, 1, "c", "three"}},
+			theirs:        []mergeNode{{1, 0, 1, "a", "one"}, {2, 0, 2, "b", "changed"}, {3, 1, 1, "c", "three"}},
+			want:          []mergeNode{{1, 0, 0, "a", "one"}, {2, 0, 0, "b", "changed"}, {3, 1, 0, "c", "three"}},
+			wantConflicts: map[int32][]string{2: {MergeConflictDeleteModify}},
+		},
+		{
+			name:   "deleted in theirs, unchanged in ours",
+			ours:   base,
+			theirs: []mergeNode{{1, 0, 1, "a", "one"}, {3, 1, 1, "c", "three"}},
+			want:   []mergeNode{{1, 0, 0, "a", "one"}, {3, 1, 0, "c", "three"}},
+		},
+		{
+			name:         "same id added in both",
+			ours:         append(append([]mergeNode(nil), base...), mergeNode{4, 0, 3, "ours new", ""}),
+			theirs:       append(append([]mergeNode(nil), base...), mergeNode{4, 0, 3, "theirs new", ""}),
+			want:         []mergeNode{{1, 0, 0, "a", "one"}, {2, 0, 0, "b", "two"}, {3, 1, 0, "c", "three"}, {4, 0, 0, "ours new", ""}, {5, 0, 0, "theirs new", ""}},
+			wantRenumber: map[int32]int32{4: 5},
+		},
+		{
+			// ours 把 a 移到 b 下，theirs 把 b 移到 a 下；只有环上 ID 最小的 a 移到顶层
+			name:          "cycle",
+			ours:          []mergeNode{{1, 2, 1, "a", "one"}, {2, 0, 2, "b", "two"}, {3, 1, 1, "c", "three"}},
+			theirs:        []mergeNode{{1, 0, 1, "a", "one"}, {2, 1, 2, "b", "two"}, {3, 1, 1, "c", "three"}},
+			want:          []mergeNode{{1, 0, 0, "a", "one"}, {2, 1, 0, "b", "two"}, {3, 1, 0, "c", "three"}},
+			wantConflicts: map[int32][]string{1: {MergeConflictCycle}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, result := mergeRawDocuments(mergeDoc(base...), mergeDoc(tt.ours...), mergeDoc(tt.theirs...), MergeOptions{})
+			if got := mergeSummary(merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged %+v\nwant %+v", got, tt.want)
+			}
+			if tt.wantConflicts == nil {
+				tt.wantConflicts = map[int32][]string{}
+			}
+			if got := conflictKinds(result); !reflect.DeepEqual(got, tt.wantConflicts) {
+				t.Errorf("conflicts %v, want %v", result.Conflicts, tt.wantConflicts)
+			}
+			if !reflect.DeepEqual(result.Renumbered, tt.wantRenumber) {
+				t.Errorf("renumbered %v, want %v", result.Renumbered, tt.wantRenumber)
+			}
+		})
+	}
+}
+
+func TestMergeCycleKeepsDescendants(t *testing.T) {
+	// 节点 1 在节点 2 下，ID 比环上的节点都小；环断开后它仍然在节点 2 下
+	base := mergeDoc(
+		mergeNode{1, 2, 1, "child", ""},
+		mergeNode{2, 0, 1, "a", ""},
+		mergeNode{3, 0, 2, "b", ""},
+	)
+	ours := mergeDoc(
+		mergeNode{1, 2, 1, "child", ""},
+		mergeNode{2, 3, 1, "a", ""},
+		mergeNode{3, 0, 2, "b", ""},
+	)
+	theirs := mergeDoc(
+		mergeNode{1, 2, 1, "child", ""},
+		mergeNode{2, 0, 1, "a", ""},
+		mergeNode{3, 2, 2, "b", ""},
+	)
+	merged, result := mergeRawDocuments(base, ours, theirs, MergeOptions{})
+	fathers := map[int32]int32{}
+	for id, n := range merged.nodes {
+		fathers[id] = n.pos.FatherId
+	}
+	if want := map[int32]int32{1: 2, 2: 0, 3: 2}; !reflect.DeepEqual(fathers, want) {
+		t.Errorf("fathers %v, want %v", fathers, want)
+	}
+	if want := map[int32][]string{2: {MergeConflictCycle}}; !reflect.DeepEqual(conflictKinds(result), want) {
+		t.Errorf("conflicts %v, want %v", result.Conflicts, want)
+	}
+}
+
+func TestMergeDuplicateConflicts(t *testing.T) {
+	base := mergeDoc(mergeNode{1, 0, 1, "a", "base"})
+	ours := mergeDoc(mergeNode{1, 0, 1, "a", "ours"})
+	theirs := mergeDoc(mergeNode{1, 0, 1, "a", "theirs"})
+	merged, result := mergeRawDocuments(base, ours, theirs, MergeOptions{DuplicateConflicts: true})
+	if len(result.Conflicts) != 1 || result.Conflicts[0].DuplicateId != 2 {
+		t.Fatalf("conflicts %+v, want one content conflict duplicated as node 2", result.Conflicts)
+	}
+	dup := merged.nodes[2]
+	if dup == nil || dup.node.Name != "a (theirs)" || dup.pos.FatherId != 0 {
+		t.Fatalf("duplicate node %+v", dup)
+	}
+	if want := ">>>>>>> CONFLICT: theirs version of node 1 \"a\", ours is kept in the original node\ntheirs"; dup.node.Txt != want {
+		t.Errorf("duplicate text %q, want %q", dup.node.Txt, want)
+	}
+	if merged.nodes[1].node.Txt != "ours" {
+		t.Errorf("original text %q, want %q", merged.nodes[1].node.Txt, "ours")
+	}
+}
+
+// siblingsOf 按顺序排列在 fatherId 下的节点，sequence 为 1..n
+func siblingsOf(fatherId int32, ids ...int32) []mergeNode {
+	var ret []mergeNode
+	for i, id := range ids {
+		ret = append(ret, mergeNode{id, fatherId, int32(i + 1), fmt.Sprint("n", id), ""})
+	}
+	return ret
+}
+
+func TestMergeSiblingOrder(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs []mergeNode
+		want               map[int32][]int32 // 父节点ID -> 子节点ID
+		wantConflicts      map[int32][]string
+	}{
+		{
+			name:   "both insert above an untouched sibling",
+			base:   siblingsOf(0, 1, 2, 3),
+			ours:   siblingsOf(0, 4, 1, 2, 3),
+			theirs: siblingsOf(0, 5, 6, 1, 2, 3),
+			want:   map[int32][]int32{0: {5, 6, 4, 1, 2, 3}},
+		},
+		{
+			name:   "both insert between different siblings",
+			base:   siblingsOf(0, 1, 2, 3),
+			ours:   siblingsOf(0, 1, 4, 2, 3),
+			theirs: siblingsOf(0, 1, 2, 5, 3),
+			want:   map[int32][]int32{0: {1, 4, 2, 5, 3}},
+		},
+		{
+			name:   "deleted in theirs, reordered in ours",
+			base:   siblingsOf(0, 1, 2, 3),
+			ours:   siblingsOf(0, 1, 3, 2),
+			theirs: siblingsOf(0, 2, 3),
+			want:   map[int32][]int32{0: {3, 2}},
+		},
+		{
+			name:   "reordered in theirs, inserted in ours",
+			base:   siblingsOf(0, 1, 2, 3),
+			ours:   siblingsOf(0, 1, 2, 3, 4),
+			theirs: siblingsOf(0, 3, 1, 2),
+			want:   map[int32][]int32{0: {3, 1, 2, 4}},
+		},
+		{
+			name:   "same reorder in both",
+			base:   siblingsOf(0, 1, 2, 3, 4),
+			ours:   siblingsOf(0, 2, 3, 1, 4),
+			theirs: siblingsOf(0, 2, 3, 1, 4),
+			want:   map[int32][]int32{0: {2, 3, 1, 4}},
+		},
+		{
+			name:          "different reorders of the same node keep ours",
+			base:          siblingsOf(0, 1, 2, 3, 4),
+			ours:          siblingsOf(0, 2, 3, 1, 4),
+			theirs:        siblingsOf(0, 2, 3, 4, 1),
+			want:          map[int32][]int32{0: {2, 3, 1, 4}},
+			wantConflicts: map[int32][]string{1: {MergeConflictPosition}},
+		},
+		{
+			name:   "moved to another parent in theirs",
+			base:   siblingsOf(0, 1, 2, 3),
+			ours:   siblingsOf(0, 4, 1, 2, 3),
+			theirs: append(siblingsOf(0, 1, 3), siblingsOf(1, 2)...),
+			want:   map[int32][]int32{0: {4, 1, 3}, 1: {2}},
+		},
+		{
+			name:          "moved to different parents in both keeps ours",
+			base:          siblingsOf(0, 1, 2, 3),
+			ours:          append(siblingsOf(0, 1, 2), siblingsOf(1, 3)...),
+			theirs:        append(siblingsOf(0, 1, 2), siblingsOf(2, 3)...),
+			want:          map[int32][]int32{0: {1, 2}, 1: {3}},
+			wantConflicts: map[int32][]string{3: {MergeConflictPosition}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, result := mergeRawDocuments(mergeDoc(tt.base...), mergeDoc(tt.ours...), mergeDoc(tt.theirs...), MergeOptions{})
+			got := map[int32][]int32{}
+			for _, n := range merged.nodes {
+				if _, ok := got[n.pos.FatherId]; !ok {
+					got[n.pos.FatherId] = childIds(merged, n.pos.FatherId)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("children %v, want %v", got, tt.want)
+			}
+			if tt.wantConflicts == nil {
+				tt.wantConflicts = map[int32][]string{}
+			}
+			if got := conflictKinds(result); !reflect.DeepEqual(got, tt.wantConflicts) {
+				t.Errorf("conflicts %v, want %v", result.Conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
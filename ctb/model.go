@@ -1,7 +1,11 @@
 package ctb
 
 import (
-	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -17,16 +21,18 @@ const (
 
 // CtNode Node data just without content
 type CtNode struct {
-	Id            int32  `json:"id"`            //
-	Name          string `json:"name"`          //
-	IsBold        bool   `json:"isBold"`        //
-	IsCustomColor bool   `json:"isCustomColor"` //
-	Color         uint32 `json:"color"`         // 节点标题的颜色（如果自定义的话），使用低3字节表示RGB
-	IsReadOnly    bool   `json:"isReadOnly"`    //
-	Icon          uint32 `json:"icon"`          // 图标的ID，cherrytree有一批编号过的图标
-	IsRichText    bool   `json:"isRichText"`    //
-	Syntax        string `json:"syntax"`        // 节点类型，custom-colors表示富文本（判断富文本应该通过IsRichText成员），plain-text表示纯文本，其它表示代码页对应的语言
-	HasChildren   bool   `json:"hasChildren"`   //
+	Id            int32     `json:"id"`            //
+	Name          string    `json:"name"`          //
+	IsBold        bool      `json:"isBold"`        //
+	IsCustomColor bool      `json:"isCustomColor"` //
+	Color         uint32    `json:"color"`         // 节点标题的颜色（如果自定义的话），使用低3字节表示RGB
+	IsReadOnly    bool      `json:"isReadOnly"`    //
+	Icon          uint32    `json:"icon"`          // 图标的ID，cherrytree有一批编号过的图标
+	IsRichText    bool      `json:"isRichText"`    //
+	Syntax        string    `json:"syntax"`        // 节点类型，custom-colors表示富文本（判断富文本应该通过IsRichText成员），plain-text表示纯文本，其它表示代码页对应的语言
+	HasChildren   bool      `json:"hasChildren"`   //
+	CreateTime    time.Time `json:"createTime"`    // 节点创建时间（ts_creation）
+	UpdateTime    time.Time `json:"updateTime"`    // 节点最后保存时间（ts_lastsave）
 }
 
 func NewCtNode(pt *ptNodeMeta, hasChildren bool) *CtNode {
@@ -41,6 +47,8 @@ func NewCtNode(pt *ptNodeMeta, hasChildren bool) *CtNode {
 		Icon:          uint32(pt.IsRo >> 1),      // 其余位表示图标ID
 		Syntax:        pt.Syntax,
 		HasChildren:   hasChildren,
+		CreateTime:    time.Unix(int64(pt.TsCreation), 0),
+		UpdateTime:    time.Unix(int64(pt.TsLastsave), 0),
 	}
 }
 
@@ -49,6 +57,8 @@ type CtNodeContent struct {
 
 	IsRichText bool `json:"isRichText"` // 富文本或代码页（包含纯文本）
 	// 富文本的内容
+	Lines CtRichText `json:"-"`
+	// 富文本的内容，与 Lines 相同，元素为 *CtText 或 CtAnchoredWidget；保留用于兼容
 	RichTexts *[][]interface{} `json:"richTexts,omitempty"`
 
 	// 代码页语言
@@ -62,6 +72,7 @@ type CtNodeContent struct {
 
 // CtAnchoredWidget 附件类元素
 type CtAnchoredWidget interface {
+	CtElement
 	GetOffset() int32
 }
 
@@ -135,32 +146,122 @@ func NewCtCodeBox(t *tCodeBox) *CtCodeBox {
 // CtTable 表格
 type CtTable struct {
 	_CtAnchoredWidgetMixin
-	Data        [][]string `json:"data"`
-	MinColWidth int32      `json:"minColWidth"`
-	MaxColWidth int32      `json:"maxColWidth"`
+	// 表格的全部行，第一行为表头（与 Header 相同）
+	Data        [][]string      `json:"data"`
+	Header      []string        `json:"header"`
+	Columns     []CtTableColumn `json:"columns"`
+	IsLight     bool            `json:"isLight"` // 使用轻量的表格控件显示
+	MinColWidth int32           `json:"minColWidth"`
+	MaxColWidth int32           `json:"maxColWidth"`
+	// ParseCtTable 补齐了单元格的行：Data 中的下标 → grid 中原有的单元格数
+	Padded map[int]int `json:"padded,omitempty"`
+}
+
+// CtTableColumn 表格中一列的属性
+type CtTableColumn struct {
+	Width int `json:"width"` // 列宽，0 表示在 MinColWidth 与 MaxColWidth 之间自动调整
 }
 
+// NewCtTable 解析 grid 表的 txt，见 ParseCtTable；grid 的 XML 损坏时记录警告并返回没有任何行的表格
 func NewCtTable(t *tGrid) *CtTable {
-	u := XmlGrid{}
-	err := xml.Unmarshal([]byte(t.Txt), &u)
+	ret, err := ParseCtTable(t)
+	if err != nil {
+		log.Warnf("Ignored the content of a damaged table at offset %d of node %d: %v", t.Offset, t.NodeId, err)
+		return &CtTable{
+			_CtAnchoredWidgetMixin: _CtAnchoredWidgetMixin{
+				Type:          CtDocElementTable,
+				Offset:        t.Offset,
+				Justification: t.Justification,
+			},
+			MinColWidth: t.ColMin,
+			MaxColWidth: t.ColMax,
+		}
+	}
+	return ret
+}
+
+// ParseCtTable 解析 grid 表的 txt，XML 损坏时返回错误。CherryTree 把表头存放在最后一行，这里把它移到第一行；
+// 单元格比最长的一行少的行在末尾补上空单元格，所以每一行的单元格数都相同；补齐的行记录在 Padded 中，Validate 会报告它们
+func ParseCtTable(t *tGrid) (*CtTable, error) {
+	rows, colWidths, isLight, err := parseGrid(t.Txt)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("table at offset %d: %w", t.Offset, err)
+	}
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
 	}
-	u.Rows = append(u.Rows[len(u.Rows)-1:], u.Rows[:len(u.Rows)-1]...)
-	var data [][]string
-	for _, r := range u.Rows {
-		data = append(data, r.Cells)
+	var padded map[int]int
+	for i, row := range rows {
+		if len(row) < cols {
+			if padded == nil {
+				padded = map[int]int{}
+			}
+			padded[i] = len(row)
+			rows[i] = append(row, make([]string, cols-len(row))...)
+		}
 	}
-	return &CtTable{
+	ret := &CtTable{
 		_CtAnchoredWidgetMixin: _CtAnchoredWidgetMixin{
 			Type:          CtDocElementTable,
 			Offset:        t.Offset,
 			Justification: t.Justification,
 		},
-		Data:        data,
+		Data:        rows,
+		IsLight:     isLight,
 		MinColWidth: t.ColMin,
 		MaxColWidth: t.ColMax,
+		Padded:      padded,
+	}
+	if len(rows) > 0 {
+		ret.Header = rows[0]
+		ret.Columns = make([]CtTableColumn, cols)
+		for i := range ret.Columns {
+			if i < len(colWidths) {
+				ret.Columns[i].Width = colWidths[i]
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Body 表头以外的行
+func (t *CtTable) Body() [][]string {
+	if len(t.Data) == 0 {
+		return nil
+	}
+	return t.Data[1:]
+}
+
+// ColumnCount 列数，即表头的单元格数
+func (t *CtTable) ColumnCount() int {
+	return len(t.Header)
+}
+
+// Validate 检查每一行的单元格数是否与表头一致；ParseCtTable 补齐过的行按 grid 中原有的单元格数检查
+func (t *CtTable) Validate() error {
+	if len(t.Data) == 0 {
+		return errors.New("table has no rows")
+	}
+	cols := len(t.Data[0])
+	if n, ok := t.Padded[0]; ok {
+		cols = n
+	}
+	if cols == 0 {
+		return errors.New("table has no columns")
+	}
+	for i, row := range t.Data {
+		n, ok := t.Padded[i]
+		if !ok {
+			n = len(row)
+		}
+		if n != cols {
+			return fmt.Errorf("row %d has %d cells, expected %d", i, n, cols)
+		}
 	}
+	return nil
 }
 
 // CtPng 图片
@@ -0,0 +1,97 @@
+package ctb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCtTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		txt        string
+		wantData   [][]string
+		wantWidths []int
+		wantPadded map[int]int
+		wantErr    string // Validate 的错误
+	}{
+		{
+			name:       "header stored last",
+			txt:        `<table col_widths="10,0" is_light="1"><row><cell>a</cell><cell>b</cell></row><row><cell>c</cell><cell>d</cell></row><row><cell>h1</cell><cell>h2</cell></row></table>`,
+			wantData:   [][]string{{"h1", "h2"}, {"a", "b"}, {"c", "d"}},
+			wantWidths: []int{10, 0},
+		},
+		{
+			name:       "header only",
+			txt:        `<table><row><cell>h</cell></row></table>`,
+			wantData:   [][]string{{"h"}},
+			wantWidths: []int{0},
+		},
+		{
+			name:       "short body row is padded",
+			txt:        `<table col_widths="0,0,0"><row><cell>a</cell></row><row><cell>h1</cell><cell>h2</cell><cell>h3</cell></row></table>`,
+			wantData:   [][]string{{"h1", "h2", "h3"}, {"a", "", ""}},
+			wantWidths: []int{0, 0, 0},
+			wantPadded: map[int]int{1: 1},
+			wantErr:    "row 1 has 1 cells, expected 3",
+		},
+		{
+			name:       "short header is padded",
+			txt:        `<table><row><cell>a</cell><cell>b</cell></row><row><cell>h1</cell></row></table>`,
+			wantData:   [][]string{{"h1", ""}, {"a", "b"}},
+			wantWidths: []int{0, 0},
+			wantPadded: map[int]int{0: 1},
+			wantErr:    "row 1 has 2 cells, expected 1",
+		},
+		{
+			name:     "no rows",
+			txt:      `<table></table>`,
+			wantData: nil,
+			wantErr:  "table has no rows",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := ParseCtTable(&tGrid{Txt: xmlHeader + tt.txt, Offset: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table.Data, tt.wantData) {
+				t.Errorf("data %q, want %q", table.Data, tt.wantData)
+			}
+			if len(tt.wantData) > 0 && !reflect.DeepEqual(table.Header, tt.wantData[0]) {
+				t.Errorf("header %q, want %q", table.Header, tt.wantData[0])
+			}
+			var widths []int
+			for _, c := range table.Columns {
+				widths = append(widths, c.Width)
+			}
+			if !reflect.DeepEqual(widths, tt.wantWidths) {
+				t.Errorf("column widths %v, want %v", widths, tt.wantWidths)
+			}
+			if !reflect.DeepEqual(table.Padded, tt.wantPadded) {
+				t.Errorf("padded %v, want %v", table.Padded, tt.wantPadded)
+			}
+			err = table.Validate()
+			if gotErr := errString(err); gotErr != tt.wantErr {
+				t.Errorf("Validate() = %q, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestParseCtTableDamaged(t *testing.T) {
+	if _, err := ParseCtTable(&tGrid{Txt: "<table><row>", Offset: 3}); err == nil {
+		t.Error("no error for a damaged table")
+	}
+	table := NewCtTable(&tGrid{Txt: "<table><row>", Offset: 3, ColMin: 40})
+	if len(table.Data) != 0 || table.Offset != 3 || table.MinColWidth != 40 {
+		t.Errorf("NewCtTable returned %+v, want an empty table", table)
+	}
+}
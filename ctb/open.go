@@ -0,0 +1,149 @@
+package ctb
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OpenOptions 打开文档的方式
+type OpenOptions struct {
+	// 只读打开（SQLite 的 mode=ro），不会修改文档，文件不存在时也不会创建
+	ReadOnly bool
+	// 假定文件在打开期间不会被任何程序修改（SQLite 的 immutable=1）：不加锁，也不读写日志文件，
+	// 所以不会妨碍 CherryTree 保存；文件实际被修改时可能读到错误的内容。隐含 ReadOnly
+	Immutable bool
+	// 文档被其他程序（例如正在保存的 CherryTree）锁住时最多等待的时间，0 表示驱动的默认值（5 秒）
+	BusyTimeout time.Duration
+	// 日志模式（PRAGMA journal_mode）：DELETE、TRUNCATE、PERSIST、MEMORY、WAL 或 OFF，为空时不改变。
+	// 切换日志模式会修改文件，所以只读打开时不允许设置
+	JournalMode string
+}
+
+var journalModes = map[string]bool{"DELETE": true, "TRUNCATE": true, "PERSIST": true, "MEMORY": true, "WAL": true, "OFF": true}
+
+// dsn 带打开参数的 SQLite URI 文件名
+func (o OpenOptions) dsn(filepath string) (string, error) {
+	var params []string
+	if o.ReadOnly || o.Immutable {
+		params = append(params, "mode=ro")
+	}
+	if o.Immutable {
+		params = append(params, "immutable=1")
+	}
+	if o.BusyTimeout > 0 {
+		params = append(params, fmt.Sprintf("_busy_timeout=%d", o.BusyTimeout.Milliseconds()))
+	}
+	if o.JournalMode != "" {
+		mode := strings.ToUpper(o.JournalMode)
+		if !journalModes[mode] {
+			return "", fmt.Errorf("invalid journal mode %q", o.JournalMode)
+		}
+		if o.ReadOnly || o.Immutable {
+			return "", fmt.Errorf("journal mode cannot be set on a read-only document")
+		}
+		params = append(params, "_journal_mode="+mode)
+	}
+	// 驱动把普通文件名中 ? 之后的部分当作参数，这样的文件名也要使用 URI 形式
+	if len(params) == 0 && !strings.Contains(filepath, "?") {
+		return filepath, nil
+	}
+	// URI 文件名中的 ?、# 与 % 需要转义
+	name := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(filepath)
+	if len(params) == 0 {
+		return "file:" + name, nil
+	}
+	return "file:" + name + "?" + strings.Join(params, "&"), nil
+}
+
+// OpenFile 按 opts 打开 ctb 文档；与 NewHandle 不同，失败时返回错误
+func OpenFile(filepath string, opts OpenOptions) (*Handle, error) {
+	dsn, err := opts.dsn(filepath)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDB(dsn)
+	if err == nil {
+		// sqlite 打开文件是延迟进行的，这里读一次以便尽早发现文件不存在或者不是数据库
+		err = db.Exec("SELECT COUNT(*) FROM sqlite_master").Error
+		if err != nil {
+			closeDB(db)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %v: %w", filepath, err)
+	}
+	return &Handle{db: db, CtbFilepath: filepath}, nil
+}
+
+// OpenBytes 打开内存中的 ctb 或 ctd 文档。文档载入 SQLite 内存数据库，不会写入磁盘，
+// 之后修改 data 也不影响打开的文档；opts 中只有 ReadOnly 与 Immutable（两者效果相同）有意义
+func OpenBytes(data []byte, opts OpenOptions) (*Handle, error) {
+	var db *gorm.DB
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte(sqliteHeader)):
+		db, err = openDBFromBytes(data)
+	case bytes.HasPrefix(bytes.TrimLeft(data, "\ufeff \t\r\n"), []byte("<")):
+		var doc *rawDocument
+		if doc, err = readCTD(bytes.NewReader(data)); err == nil {
+			db, err = openDBFromDocument(doc)
+		}
+	default:
+		return nil, fmt.Errorf("not a ctb or ctd document")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.ReadOnly || opts.Immutable {
+		if err := db.Exec("PRAGMA query_only = ON").Error; err != nil {
+			closeDB(db)
+			return nil, err
+		}
+	}
+	return &Handle{db: db}, nil
+}
+
+// OpenReaderAt 从 io.ReaderAt（例如对象存储的分段读取）中读出 size 字节的文档并打开，见 OpenBytes
+func OpenReaderAt(r io.ReaderAt, size int64, opts OpenOptions) (*Handle, error) {
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	return OpenBytes(data, opts)
+}
+
+// OpenFS 打开 fs.FS（例如 embed.FS）中的文档，见 OpenBytes
+func OpenFS(fsys fs.FS, name string, opts OpenOptions) (*Handle, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	h, err := OpenBytes(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open %v: %w", name, err)
+	}
+	h.CtbFilepath = name
+	return h, nil
+}
+
+// closeDB 关闭数据库。内存数据库固定使用的连接不会被连接池关闭，需要先关闭它；重复关闭没有影响
+func closeDB(db *gorm.DB) error {
+	if c, ok := db.ConnPool.(memoryConn); ok {
+		if err := c.Close(); err != nil && !errors.Is(err, sql.ErrConnDone) {
+			return err
+		}
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
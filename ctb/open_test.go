@@ -0,0 +1,173 @@
+package ctb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenOptionsDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		opts OpenOptions
+		path string
+		want string
+		err  string
+	}{
+		{"default", OpenOptions{}, "/a/b.ctb", "/a/b.ctb", ""},
+		{"read-only", OpenOptions{ReadOnly: true}, "/a/b.ctb", "file:/a/b.ctb?mode=ro", ""},
+		{"immutable", OpenOptions{Immutable: true}, "/a/b.ctb", "file:/a/b.ctb?mode=ro&immutable=1", ""},
+		{"immutable and read-only", OpenOptions{ReadOnly: true, Immutable: true}, "b.ctb", "file:b.ctb?mode=ro&immutable=1", ""},
+		{"busy timeout", OpenOptions{BusyTimeout: 1500 * time.Millisecond}, "b.ctb", "file:b.ctb?_busy_timeout=1500", ""},
+		{"read-only busy timeout", OpenOptions{ReadOnly: true, BusyTimeout: time.Minute}, "b.ctb", "file:b.ctb?mode=ro&_busy_timeout=60000", ""},
+		{"journal mode", OpenOptions{JournalMode: "wal"}, "b.ctb", "file:b.ctb?_journal_mode=WAL", ""},
+		{"journal mode and busy timeout", OpenOptions{JournalMode: "Delete", BusyTimeout: time.Second}, "b.ctb", "file:b.ctb?_busy_timeout=1000&_journal_mode=DELETE", ""},
+		{"escaped", OpenOptions{ReadOnly: true}, "/a?#%/b.ctb", "file:/a%3f%23%25/b.ctb?mode=ro", ""},
+		{"question mark", OpenOptions{}, "/a?b.ctb", "file:/a%3fb.ctb", ""},
+		{"percent", OpenOptions{}, "/a%b.ctb", "/a%b.ctb", ""},
+		{"invalid journal mode", OpenOptions{JournalMode: "fast"}, "b.ctb", "", `invalid journal mode "fast"`},
+		{"journal mode on read-only", OpenOptions{ReadOnly: true, JournalMode: "WAL"}, "b.ctb", "", "read-only"},
+		{"journal mode on immutable", OpenOptions{Immutable: true, JournalMode: "WAL"}, "b.ctb", "", "read-only"},
+	}
+	for _, tt := range tests {
+		got, err := tt.opts.dsn(tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: dsn = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// pragma 读取 PRAGMA 的值
+func pragma(t *testing.T, h *Handle, name string) string {
+	t.Helper()
+	var v string
+	if err := h.db.Raw("PRAGMA " + name).Row().Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	// 路径中包含 URI 文件名需要转义的字符
+	p := filepath.Join(dir, "a?#%b.ctb")
+	if err := writeRawDocument(filepath.Join(dir, "a.ctb"), sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "a.ctb"), p); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("read-only", func(t *testing.T) {
+		h, err := OpenFile(p, OpenOptions{ReadOnly: true, BusyTimeout: 1500 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		if n, err := h.GetNodeById(2); err != nil || n.Name != "code" {
+			t.Errorf("GetNodeById(2) = %+v, %v", n, err)
+		}
+		if v := pragma(t, h, "busy_timeout"); v != "1500" {
+			t.Errorf("busy_timeout = %s", v)
+		}
+		if err := h.db.Exec("DELETE FROM node").Error; err == nil {
+			t.Error("a read-only document was modified")
+		}
+	})
+	t.Run("immutable", func(t *testing.T) {
+		h, err := OpenFile(p, OpenOptions{Immutable: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		if count, err := h.GetTotalNodesCount(); err != nil || count != int64(len(sampleDocument().nodes)) {
+			t.Errorf("GetTotalNodesCount() = %d, %v", count, err)
+		}
+		if err := h.db.Exec("DELETE FROM node").Error; err == nil {
+			t.Error("an immutable document was modified")
+		}
+	})
+	t.Run("journal mode", func(t *testing.T) {
+		h, err := OpenFile(p, OpenOptions{JournalMode: "wal"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := pragma(t, h, "journal_mode"); v != "wal" {
+			t.Errorf("journal_mode = %s", v)
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// 日志模式保存在文件中
+		h, err = OpenFile(p, OpenOptions{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		if v := pragma(t, h, "journal_mode"); v != "wal" {
+			t.Errorf("journal_mode after reopening = %s", v)
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		missing := filepath.Join(dir, "missing.ctb")
+		for _, opts := range []OpenOptions{{ReadOnly: true}, {Immutable: true}} {
+			if h, err := OpenFile(missing, opts); err == nil {
+				h.Close()
+				t.Errorf("%+v: opened a missing document", opts)
+			}
+			if _, err := os.Stat(missing); !os.IsNotExist(err) {
+				t.Fatalf("%+v: opening a missing document created it: %v", opts, err)
+			}
+		}
+	})
+	t.Run("not a database", func(t *testing.T) {
+		text := filepath.Join(dir, "text.ctb")
+		if err := os.WriteFile(text, []byte(strings.Repeat("not a database\n", 100)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if h, err := OpenFile(text, OpenOptions{ReadOnly: true}); err == nil {
+			h.Close()
+			t.Error("opened a text file")
+		}
+	})
+	t.Run("invalid options", func(t *testing.T) {
+		if _, err := OpenFile(p, OpenOptions{JournalMode: "fast"}); err == nil {
+			t.Error("opened with an invalid journal mode")
+		}
+	})
+	t.Run("default options", func(t *testing.T) {
+		h, err := OpenFile(p, OpenOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		if n, err := h.GetNodeById(1); err != nil || n.Id != 1 {
+			t.Errorf("GetNodeById(1) = %+v, %v", n, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+			t.Errorf("the file name was cut at ?: %v", err)
+		}
+	})
+	t.Run("close twice", func(t *testing.T) {
+		h, err := OpenFile(p, OpenOptions{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Close(); err != nil {
+			t.Errorf("second Close: %v", err)
+		}
+		if _, err := h.GetNodeById(1); err == nil {
+			t.Error("query after Close succeeded")
+		}
+	})
+}
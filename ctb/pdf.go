@@ -0,0 +1,736 @@
+package ctb
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-pdf/fpdf"
+	log "github.com/sirupsen/logrus"
+)
+
+// PDFOptions PDF 导出的选项
+type PDFOptions struct {
+	// 同时导出所有下级节点
+	WithChildren bool
+	// 纸张大小，如 "A4"、"Letter"；为空表示 A4
+	PageSize string
+	// 文档标题，显示在目录页上；为空时使用第一个节点的名称
+	Title string
+	// 不生成目录页
+	NoTOC bool
+	// TrueType 字体文件。不指定时使用 PDF 内置的 Helvetica 与 Courier 字体，只能显示西欧字符，
+	// 中文等其他文字需要指定包含这些字符的字体
+	Fonts PDFFonts
+}
+
+// PDFFonts TrueType 字体文件的路径；粗体、斜体与等宽字体未指定时使用常规字体
+type PDFFonts struct {
+	Regular    string
+	Bold       string
+	Italic     string
+	BoldItalic string
+	Mono       string
+}
+
+const (
+	pdfMargin       = 20.0 // 页边距（毫米）
+	pdfFontSize     = 11.0 // 正文字号（磅）
+	pdfCodeFontSize = 9.0
+	pdfLineSpacing  = 1.4
+	pdfPtToMm       = 25.4 / 72
+	pdfPxToMm       = 25.4 / 96
+	pdfCellPadding  = 1.5
+	pdfTextFamily   = "ct-text"
+	pdfMonoFamily   = "ct-mono"
+)
+
+// pdfScales 富文本字号对应的磅值
+var pdfScales = map[string]float64{
+	"h1": 24, "h2": 20, "h3": 17, "h4": 15, "h5": 13, "h6": 12, "small": 9,
+}
+
+// ExportPDF 将节点（id 为 0 时为整个文档）导出为 PDF：节点名称作为标题，并加入目录页与 PDF 书签；
+// 富文本保留字号、粗体、斜体、下划线、删除线与文字颜色，代码框使用等宽字体并高亮，表格绘制边框，图片按页宽缩放
+func (r Handle) ExportPDF(w io.Writer, id int32, opts PDFOptions) error {
+	entries, err := r.subtree(id, opts.WithChildren)
+	if err != nil {
+		return err
+	}
+	nodes := make([]pdfNode, 0, len(entries))
+	for _, e := range entries {
+		c, err := r.GetNodeContentById(e.node.Id, nil)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, pdfNode{treeEntry: e, content: c})
+	}
+	fonts, err := opts.Fonts.load()
+	if err != nil {
+		return err
+	}
+	// 目录中的页码要到排版之后才知道：先排版一次得到每个节点所在的页，再按这些页码重新排版
+	var pages map[int32]int
+	for pass := 0; pass < 2; pass++ {
+		pw := newPDFWriter(nodes, opts, fonts, pages)
+		if err := pw.write(); err != nil {
+			return err
+		}
+		if pass == 1 || opts.NoTOC {
+			return pw.pdf.Output(w)
+		}
+		pages = pw.pages
+	}
+	return nil
+}
+
+type pdfNode struct {
+	treeEntry
+	content *CtNodeContent
+}
+
+type pdfWriter struct {
+	pdf      *fpdf.Fpdf
+	opts     PDFOptions
+	nodes    []pdfNode
+	tr       func(string) string
+	mono     string
+	tocPages map[int32]int // 上一次排版得到的页码
+	pages    map[int32]int
+	exported map[int32]bool
+	links    map[string]int // "节点ID" 或 "节点ID#锚" → fpdf 的内部链接
+	images   int
+	lineMax  float64 // 当前行中最大的行高
+	inLine   bool    // 当前行已经写入了文本
+	inBlock  bool    // 当前行在代码框、表格或图片之后还没有写入文本
+	node     *pdfNode
+}
+
+// load 读取字体文件，依次为常规、粗体、斜体、粗斜体与等宽字体；没有指定字体时返回 nil
+func (f PDFFonts) load() ([][]byte, error) {
+	if f.Regular == "" {
+		return nil, nil
+	}
+	var ret [][]byte
+	cache := map[string][]byte{}
+	for _, file := range []string{f.Regular, f.Bold, f.Italic, f.BoldItalic, f.Mono} {
+		if file == "" {
+			file = f.Regular
+		}
+		if _, ok := cache[file]; !ok {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			cache[file] = data
+		}
+		ret = append(ret, cache[file])
+	}
+	return ret, nil
+}
+
+func newPDFWriter(nodes []pdfNode, opts PDFOptions, fonts [][]byte, tocPages map[int32]int) *pdfWriter {
+	size := opts.PageSize
+	if size == "" {
+		size = "A4"
+	}
+	pdf := fpdf.New("P", "mm", size, "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pw := &pdfWriter{
+		pdf:      pdf,
+		opts:     opts,
+		nodes:    nodes,
+		tocPages: tocPages,
+		pages:    map[int32]int{},
+		exported: map[int32]bool{},
+		links:    map[string]int{},
+		mono:     "Courier",
+	}
+	for _, n := range nodes {
+		pw.exported[n.node.Id] = true
+	}
+	if fonts != nil {
+		for i, style := range []string{"", "B", "I", "BI"} {
+			pdf.AddUTF8FontFromBytes(pdfTextFamily, style, fonts[i])
+			pdf.AddUTF8FontFromBytes(pdfMonoFamily, style, fonts[4])
+		}
+		pw.mono = pdfMonoFamily
+		pw.tr = func(s string) string { return s }
+	} else {
+		// 内置字体使用 cp1252 编码，无法表示的字符显示为 "?"
+		tr := pdf.UnicodeTranslatorFromDescriptor("")
+		pw.tr = func(s string) string {
+			return tr(strings.Map(func(c rune) rune {
+				if c >= 0x80 && tr(string(c)) == "." {
+					return '?'
+				}
+				return c
+			}, s))
+		}
+	}
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin + 5)
+		pw.setFont("", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 5, strconv.Itoa(pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	return pw
+}
+
+// family 正文字体
+func (p *pdfWriter) family() string {
+	if p.mono == pdfMonoFamily {
+		return pdfTextFamily
+	}
+	return "Helvetica"
+}
+
+func (p *pdfWriter) setFont(style string, size float64) {
+	p.pdf.SetFont(p.family(), style, size)
+}
+
+// lineHeight 字号对应的行高（毫米）
+func lineHeight(size float64) float64 {
+	return size * pdfPtToMm * pdfLineSpacing
+}
+
+func (p *pdfWriter) contentWidth() float64 {
+	w, _ := p.pdf.GetPageSize()
+	return w - 2*pdfMargin
+}
+
+// ensureSpace 当前页剩余的高度不足 h 时换页
+func (p *pdfWriter) ensureSpace(h float64) {
+	_, pageH := p.pdf.GetPageSize()
+	if p.pdf.GetY()+h > pageH-pdfMargin && p.pdf.GetY() > pdfMargin+0.1 {
+		p.pdf.AddPage()
+	}
+}
+
+// link 节点（及锚）对应的内部链接
+func (p *pdfWriter) link(id int32, anchor string) int {
+	key := strconv.Itoa(int(id))
+	if anchor != "" {
+		key += "#" + anchor
+	}
+	l, ok := p.links[key]
+	if !ok {
+		l = p.pdf.AddLink()
+		p.links[key] = l
+	}
+	return l
+}
+
+func (p *pdfWriter) write() error {
+	if err := p.pdf.Error(); err != nil {
+		return err
+	}
+	if !p.opts.NoTOC && len(p.nodes) > 0 {
+		p.toc()
+	}
+	for i := range p.nodes {
+		n := &p.nodes[i]
+		if err := p.writeNode(n, i == 0 || n.depth == 0); err != nil {
+			return fmt.Errorf("node %d: %w", n.node.Id, err)
+		}
+		if err := p.pdf.Error(); err != nil {
+			return fmt.Errorf("node %d: %w", n.node.Id, err)
+		}
+	}
+	if len(p.nodes) == 0 {
+		p.pdf.AddPage()
+	}
+	return p.pdf.Error()
+}
+
+// toc 目录页：标题与每个节点的名称、页码，点击可以跳转
+func (p *pdfWriter) toc() {
+	pdf := p.pdf
+	pdf.AddPage()
+	title := p.opts.Title
+	if title == "" {
+		title = p.nodes[0].node.Name
+	}
+	p.setFont("B", 22)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.MultiCell(0, lineHeight(22), p.tr(title), "", "L", false)
+	pdf.Ln(4)
+	p.setFont("B", 14)
+	pdf.CellFormat(0, lineHeight(14), "Contents", "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	h := lineHeight(pdfFontSize)
+	for _, n := range p.nodes {
+		style := ""
+		if n.depth == 0 {
+			style = "B"
+		}
+		p.setFont(style, pdfFontSize)
+		page := "?"
+		if pg, ok := p.tocPages[n.node.Id]; ok {
+			page = strconv.Itoa(pg)
+		}
+		indent := 6 * float64(n.depth)
+		numWidth := 14.0
+		link := p.link(n.node.Id, "")
+		pdf.SetX(pdfMargin + indent)
+		name := p.fit(n.node.Name, p.contentWidth()-indent-numWidth-2)
+		pdf.CellFormat(p.contentWidth()-indent-numWidth, h, name, "", 0, "L", false, link, "")
+		pdf.CellFormat(numWidth, h, page, "", 1, "R", false, link, "")
+	}
+}
+
+// fit 截断过长的单行文本，返回经过 tr 转换的文本
+func (p *pdfWriter) fit(s string, width float64) string {
+	if p.pdf.GetStringWidth(p.tr(s)) <= width {
+		return p.tr(s)
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && p.pdf.GetStringWidth(p.tr(string(runes)+"...")) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return p.tr(string(runes) + "...")
+}
+
+// writeNode 节点的标题与内容；newPage 为 true 时从新的一页开始
+func (p *pdfWriter) writeNode(n *pdfNode, newPage bool) error {
+	pdf := p.pdf
+	p.node = n
+	if newPage {
+		pdf.AddPage()
+	} else {
+		pdf.Ln(6)
+	}
+	size := 18 - 2*float64(n.depth)
+	if size < pdfFontSize+1 {
+		size = pdfFontSize + 1
+	}
+	p.ensureSpace(lineHeight(size) + lineHeight(pdfFontSize))
+	p.pages[n.node.Id] = pdf.PageNo()
+	pdf.SetLink(p.link(n.node.Id, ""), -1, -1)
+	p.setFont("B", size)
+	pdf.Bookmark(p.tr(n.node.Name), n.depth, -1)
+	if c, ok := parseColor(fmt.Sprintf("#%06x", n.node.Color)); ok && n.node.IsCustomColor {
+		pdf.SetTextColor(int(c.r), int(c.g), int(c.b))
+	} else {
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.MultiCell(0, lineHeight(size), p.tr(n.node.Name), "", "L", false)
+	pdf.Ln(2)
+
+	c := n.content
+	if !c.IsRichText {
+		if c.Language == CtNodeSyntaxPlainText {
+			p.setFont("", pdfFontSize)
+			pdf.SetTextColor(0, 0, 0)
+			pdf.MultiCell(0, lineHeight(pdfFontSize), p.tr(c.Code), "", "L", false)
+			return nil
+		}
+		return p.code(c.Code, c.Language, false)
+	}
+	p.lineMax, p.inLine, p.inBlock = 0, false, false
+	err := c.Lines.Walk(CtVisitorFuncs{
+		Text: func(t *CtText) error {
+			p.text(t)
+			return nil
+		},
+		CodeBox: func(cb *CtCodeBox) error {
+			p.endLine()
+			return p.code(cb.Code, cb.Language, cb.IsShowLineNumber)
+		},
+		Table: func(t *CtTable) error {
+			p.endLine()
+			p.table(t)
+			return nil
+		},
+		Png: func(img *CtPng) error {
+			p.endLine()
+			p.image(img)
+			return nil
+		},
+		EmbFile: func(f *CtEmbFile) error {
+			p.placeholder(DefaultPlaceholder(f))
+			return nil
+		},
+		Anchor: func(a *CtAnchor) error {
+			pdf.SetLink(p.link(n.node.Id, a.Name), -1, -1)
+			return nil
+		},
+		LineBreak: func() error {
+			switch {
+			case p.inLine:
+				pdf.Ln(p.lineMax)
+			case !p.inBlock:
+				pdf.Ln(lineHeight(pdfFontSize))
+			}
+			p.lineMax, p.inLine, p.inBlock = 0, false, false
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.endLine()
+	return nil
+}
+
+// endLine 结束当前行，用于在代码框、表格与图片之前换行
+func (p *pdfWriter) endLine() {
+	if p.inLine {
+		p.pdf.Ln(p.lineMax)
+	}
+	// 块元素之后的换行不再产生空行
+	p.lineMax, p.inLine, p.inBlock = 0, false, true
+}
+
+// text 按富文本样式写入一段文本，自动折行
+func (p *pdfWriter) text(t *CtText) {
+	pdf := p.pdf
+	style := ""
+	if t.Weight == "heavy" {
+		style += "B"
+	}
+	if t.Style == "italic" {
+		style += "I"
+	}
+	if t.Underline != "" {
+		style += "U"
+	}
+	if t.Strikethrough == "true" {
+		style += "S"
+	}
+	size := pdfFontSize
+	if s, ok := pdfScales[t.Scale]; ok {
+		size = s
+		if strings.HasPrefix(t.Scale, "h") && !strings.Contains(style, "B") {
+			style = "B" + style
+		}
+	}
+	link, ok := ParseLink(t.Link)
+	if ok && !strings.Contains(style, "U") {
+		style += "U"
+	}
+	family := p.family()
+	if t.Family == "monospace" {
+		family = p.mono
+	}
+	pdf.SetFont(family, style, size)
+	switch c, isColor := parseColor(t.Foreground); {
+	case isColor:
+		pdf.SetTextColor(int(c.r), int(c.g), int(c.b))
+	case ok:
+		pdf.SetTextColor(0, 0, 0xee)
+	default:
+		pdf.SetTextColor(0, 0, 0)
+	}
+	h := lineHeight(size)
+	if h > p.lineMax {
+		p.lineMax = h
+	}
+	p.inLine, p.inBlock = true, false
+	txt := p.tr(t.Text)
+	switch {
+	case t.Scale == "sup" || t.Scale == "sub":
+		offset := size * 0.35
+		if t.Scale == "sub" {
+			offset = -offset
+		}
+		pdf.SubWrite(lineHeight(pdfFontSize), txt, size*0.7, offset, 0, "")
+	case ok && link.Kind == CtLinkNode && p.exported[link.NodeId]:
+		pdf.WriteLinkID(h, txt, p.link(link.NodeId, link.Anchor))
+	case ok && link.Kind == CtLinkWeb:
+		pdf.WriteLinkString(h, txt, link.Target)
+	default:
+		pdf.Write(h, txt)
+	}
+}
+
+// placeholder 附件等无法显示的元素
+func (p *pdfWriter) placeholder(s string) {
+	p.setFont("I", pdfFontSize)
+	p.pdf.SetTextColor(0, 0x8a, 0x8c)
+	h := lineHeight(pdfFontSize)
+	if h > p.lineMax {
+		p.lineMax = h
+	}
+	p.inLine, p.inBlock = true, false
+	p.pdf.Write(h, p.tr(s))
+}
+
+// pdfSegment 一行中颜色相同的一段代码
+type pdfSegment struct {
+	text  string
+	style ansiStyle
+}
+
+// code 浅灰色背景上的等宽代码，按语言高亮，过长的行折行
+func (p *pdfWriter) code(code, language string, lineNumbers bool) error {
+	pdf := p.pdf
+	tokens, err := HighlightCode(strings.ReplaceAll(code, "\t", "    "), language, HighlightOptions{})
+	if err != nil {
+		return err
+	}
+	lines := splitTokenLines(tokens)
+	pdf.SetFont(p.mono, "", pdfCodeFontSize)
+	h := pdfCodeFontSize * pdfPtToMm * 1.3
+	left, width := pdfMargin, p.contentWidth()
+	gutter := 0.0
+	numWidth := len(strconv.Itoa(len(lines)))
+	if lineNumbers {
+		gutter = pdf.GetStringWidth(strings.Repeat("0", numWidth)) + 2*pdfCellPadding
+	}
+	avail := width - gutter - 2*pdfCellPadding
+	pdf.SetFillColor(245, 245, 245)
+	pdf.Ln(1)
+	for i, line := range lines {
+		// 按宽度拆分为多行
+		rows := [][]pdfSegment{nil}
+		used := 0.0
+		for _, t := range line {
+			style := tokenStyles[t.Kind]
+			for _, c := range t.Text {
+				s := p.tr(string(c))
+				cw := pdf.GetStringWidth(s)
+				if used+cw > avail && used > 0 {
+					rows = append(rows, nil)
+					used = 0
+				}
+				row := &rows[len(rows)-1]
+				if n := len(*row); n > 0 && (*row)[n-1].style == style {
+					(*row)[n-1].text += s
+				} else {
+					*row = append(*row, pdfSegment{s, style})
+				}
+				used += cw
+			}
+		}
+		for j, row := range rows {
+			p.ensureSpace(h)
+			y := pdf.GetY()
+			pdf.Rect(left, y, width, h, "F")
+			pdf.SetXY(left+pdfCellPadding, y)
+			if lineNumbers {
+				pdf.SetFont(p.mono, "", pdfCodeFontSize)
+				pdf.SetTextColor(136, 136, 136)
+				num := ""
+				if j == 0 {
+					num = fmt.Sprintf("%*d", numWidth, i+1)
+				}
+				pdf.CellFormat(gutter, h, num, "", 0, "L", false, 0, "")
+			}
+			for _, seg := range row {
+				style := ""
+				if seg.style.bold {
+					style = "B"
+				}
+				pdf.SetFont(p.mono, style, pdfCodeFontSize)
+				if c := seg.style.fg; c != nil {
+					pdf.SetTextColor(int(c.r), int(c.g), int(c.b))
+				} else {
+					pdf.SetTextColor(0, 0, 0)
+				}
+				pdf.CellFormat(pdf.GetStringWidth(seg.text), h, seg.text, "", 0, "L", false, 0, "")
+			}
+			pdf.SetXY(left, y+h)
+		}
+	}
+	pdf.Ln(2)
+	return nil
+}
+
+// table 带边框的表格，列宽按内容分配，单元格内折行，跨页时重复表头
+func (p *pdfWriter) table(t *CtTable) {
+	pdf := p.pdf
+	cols := t.ColumnCount()
+	if cols == 0 {
+		return
+	}
+	size := pdfFontSize - 1
+	h := lineHeight(size)
+	width := p.contentWidth()
+	widths := make([]float64, cols)
+	for r, row := range t.Data {
+		style := ""
+		if r == 0 {
+			style = "B"
+		}
+		p.setFont(style, size)
+		for i := 0; i < cols && i < len(row); i++ {
+			for _, l := range strings.Split(row[i], "\n") {
+				if w := pdf.GetStringWidth(p.tr(l)) + 2*pdfCellPadding; w > widths[i] {
+					widths[i] = w
+				}
+			}
+		}
+	}
+	total := 0.0
+	for i := range widths {
+		if widths[i] < 8 {
+			widths[i] = 8
+		}
+		total += widths[i]
+	}
+	if total > width {
+		// 超出页宽时，比平均宽度窄的列保持不变，其余的列按比例缩小
+		fair := width / float64(cols)
+		narrow, wide := 0.0, 0.0
+		for _, w := range widths {
+			if w <= fair {
+				narrow += w
+			} else {
+				wide += w
+			}
+		}
+		for i, w := range widths {
+			if w > fair {
+				widths[i] = w * (width - narrow) / wide
+			}
+		}
+	}
+	drawRow := func(row []string, header bool) {
+		style := ""
+		if header {
+			style = "B"
+		}
+		p.setFont(style, size)
+		cells := make([][]string, cols)
+		lines := 1
+		for i := 0; i < cols; i++ {
+			if i < len(row) {
+				cells[i] = p.wrap(row[i], widths[i]-2*pdfCellPadding)
+			}
+			if len(cells[i]) > lines {
+				lines = len(cells[i])
+			}
+		}
+		rowH := float64(lines)*h + pdfCellPadding
+		p.ensureSpace(rowH)
+		x, y := pdfMargin, pdf.GetY()
+		pdf.SetDrawColor(160, 160, 160)
+		pdf.SetFillColor(235, 235, 235)
+		pdf.SetTextColor(0, 0, 0)
+		for i := 0; i < cols; i++ {
+			if header {
+				pdf.Rect(x, y, widths[i], rowH, "FD")
+			} else {
+				pdf.Rect(x, y, widths[i], rowH, "D")
+			}
+			for j, l := range cells[i] {
+				pdf.SetXY(x+pdfCellPadding, y+pdfCellPadding/2+float64(j)*h)
+				pdf.CellFormat(widths[i]-2*pdfCellPadding, h, l, "", 0, "L", false, 0, "")
+			}
+			x += widths[i]
+		}
+		pdf.SetXY(pdfMargin, y+rowH)
+	}
+	pdf.Ln(1)
+	for r, row := range t.Data {
+		_, pageH := pdf.GetPageSize()
+		if r > 0 && pdf.GetY()+h+pdfCellPadding > pageH-pdfMargin {
+			pdf.AddPage()
+			drawRow(t.Data[0], true)
+		}
+		drawRow(row, r == 0)
+	}
+	pdf.Ln(2)
+}
+
+// wrap 按宽度折行（返回经过 tr 转换的文本），在空白处或宽字符之间断行，过长的单词强制截断
+func (p *pdfWriter) wrap(s string, width float64) []string {
+	var ret []string
+	for _, para := range strings.Split(s, "\n") {
+		var line, word []rune
+		flush := func() {
+			ret = append(ret, p.tr(strings.TrimRightFunc(string(line), unicode.IsSpace)))
+			line = nil
+		}
+		fits := func(runes []rune) bool {
+			return p.pdf.GetStringWidth(p.tr(string(runes))) <= width
+		}
+		addWord := func() {
+			if len(word) == 0 {
+				return
+			}
+			if !fits(append(line[:len(line):len(line)], word...)) && len(line) > 0 {
+				flush()
+			}
+			for _, c := range word {
+				if len(line) > 0 && !fits(append(line[:len(line):len(line)], c)) {
+					flush()
+				}
+				if len(line) == 0 && unicode.IsSpace(c) {
+					continue
+				}
+				line = append(line, c)
+			}
+			word = nil
+		}
+		for _, c := range para {
+			switch {
+			case unicode.IsSpace(c):
+				word = append(word, c)
+				addWord()
+			case runeWidth(c) == 2:
+				addWord()
+				word = append(word, c)
+				addWord()
+			default:
+				word = append(word, c)
+			}
+		}
+		addWord()
+		flush()
+	}
+	return ret
+}
+
+// image 图片，宽度超过页宽或高度超过页高时等比缩小
+func (p *pdfWriter) image(img *CtPng) {
+	pdf := p.pdf
+	data, w, h, err := pdfPng(img.Data)
+	if err != nil {
+		log.Warnf("node %d: cannot decode image at offset %d: %v", p.node.node.Id, img.Offset, err)
+		p.placeholder(DefaultPlaceholder(img))
+		return
+	}
+	p.images++
+	name := fmt.Sprintf("image%d", p.images)
+	opts := fpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader(name, opts, bytes.NewReader(data))
+	width, height := float64(w)*pdfPxToMm, float64(h)*pdfPxToMm
+	_, pageH := pdf.GetPageSize()
+	maxW, maxH := p.contentWidth(), pageH-2*pdfMargin-10
+	if width > maxW {
+		width, height = maxW, height*maxW/width
+	}
+	if height > maxH {
+		width, height = width*maxH/height, maxH
+	}
+	p.ensureSpace(height)
+	y := pdf.GetY()
+	pdf.ImageOptions(name, pdfMargin, y, width, height, false, opts, 0, "")
+	pdf.SetY(y + height + 2)
+}
+
+// pdfPng 将图片转换为 8 位、非隔行扫描的 PNG（fpdf 不支持 16 位与隔行扫描的 PNG）
+func pdfPng(data []byte) ([]byte, int, int, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), b.Dx(), b.Dy(), nil
+}
@@ -0,0 +1,95 @@
+package ctb
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	pdfPageCount    = regexp.MustCompile(`/Type /Pages\s*/Kids \[[^\]]*\]\s*/Count (\d+)`)
+	pdfOutlineTitle = regexp.MustCompile(`<</Title \(((?:[^()\\]|\\.)*)\)`)
+)
+
+// pdfSummary PDF 的页数与书签标题
+func pdfSummary(t *testing.T, data []byte) (int, []string) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.HasSuffix(bytes.TrimSpace(data), []byte("%%EOF")) {
+		t.Fatalf("not a PDF file: %.20q", data)
+	}
+	m := pdfPageCount.FindSubmatch(data)
+	if m == nil {
+		t.Fatal("no page tree")
+	}
+	pages, _ := strconv.Atoi(string(m[1]))
+	var titles []string
+	for _, m := range pdfOutlineTitle.FindAllSubmatch(data, -1) {
+		titles = append(titles, string(m[1]))
+	}
+	return pages, titles
+}
+
+func TestExportPDF(t *testing.T) {
+	h := openDocument(t, sampleDocument())
+	tests := []struct {
+		name   string
+		id     int32
+		opts   PDFOptions
+		pages  int
+		titles []string
+	}{
+		// 目录页，然后每个顶层节点从新的一页开始
+		{"document", 0, PDFOptions{}, 3, []string{`rich <"&'>`, "code", "empty rich", ""}},
+		{"document without toc", 0, PDFOptions{NoTOC: true, PageSize: "Letter"}, 2, []string{`rich <"&'>`, "code", "empty rich", ""}},
+		{"subtree", 1, PDFOptions{WithChildren: true, Title: "Book"}, 2, []string{`rich <"&'>`, "code", "empty rich"}},
+		{"node", 1, PDFOptions{NoTOC: true}, 1, []string{`rich <"&'>`}},
+		{"leaf with children", 2, PDFOptions{WithChildren: true, NoTOC: true}, 1, []string{"code"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := h.ExportPDF(&buf, tt.id, tt.opts); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		pages, titles := pdfSummary(t, buf.Bytes())
+		if pages != tt.pages {
+			t.Errorf("%s: %d pages, want %d", tt.name, pages, tt.pages)
+		}
+		if !reflect.DeepEqual(titles, tt.titles) {
+			t.Errorf("%s: bookmarks %q, want %q", tt.name, titles, tt.titles)
+		}
+	}
+	// 内置字体无法表示的字符显示为 "?"
+	var buf bytes.Buffer
+	if err := h.ExportPDF(&buf, 1, PDFOptions{NoTOC: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "中文") {
+		t.Error("CJK text written with a built-in font")
+	}
+}
+
+func TestExportPDFErrors(t *testing.T) {
+	h := openDocument(t, sampleDocument())
+	if err := h.ExportPDF(&bytes.Buffer{}, 99, PDFOptions{}); !IsNotFound(err) {
+		t.Errorf("missing node: %v", err)
+	}
+	if err := h.ExportPDF(&bytes.Buffer{}, 0, PDFOptions{PageSize: "Bogus"}); err == nil || !strings.Contains(err.Error(), "page size") {
+		t.Errorf("invalid page size: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.ttf")
+	if err := h.ExportPDF(&bytes.Buffer{}, 0, PDFOptions{Fonts: PDFFonts{Regular: missing}}); err == nil {
+		t.Error("missing font file")
+	}
+	// 空文档也是有效的 PDF
+	var buf bytes.Buffer
+	if err := openDocument(t, newRawDocument()).ExportPDF(&buf, 0, PDFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if pages, titles := pdfSummary(t, buf.Bytes()); pages != 1 || titles != nil {
+		t.Errorf("empty document: %d pages, bookmarks %q", pages, titles)
+	}
+}
@@ -0,0 +1,172 @@
+package ctb
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languageAliases 常见的语言名称（Markdown 代码块的 info string 等）到 CherryTree（GtkSourceView）语言ID的映射
+var languageAliases = map[string]string{
+	"bash":        "sh",
+	"shell":       "sh",
+	"zsh":         "sh",
+	"console":     "sh",
+	"shellscript": "sh",
+	"js":          "js",
+	"javascript":  "js",
+	"node":        "js",
+	"ts":          "typescript",
+	"py":          "python",
+	"golang":      "go",
+	"c++":         "cpp",
+	"cc":          "cpp",
+	"cxx":         "cpp",
+	"h":           "c",
+	"c#":          "c-sharp",
+	"cs":          "c-sharp",
+	"csharp":      "c-sharp",
+	"yml":         "yaml",
+	"md":          "markdown",
+	"rb":          "ruby",
+	"rs":          "rust",
+	"kt":          "kotlin",
+	"ps1":         "powershell",
+	"ps":          "powershell",
+	"bat":         "dosbatch",
+	"cmd":         "dosbatch",
+	"batch":       "dosbatch",
+	"make":        "makefile",
+	"docker":      "dockerfile",
+	"htm":         "html",
+	"text":        CtNodeSyntaxPlainText,
+	"txt":         CtNodeSyntaxPlainText,
+	"plain":       CtNodeSyntaxPlainText,
+	"plaintext":   CtNodeSyntaxPlainText,
+}
+
+// NormalizeLanguage 将常见的语言名称转换为 CherryTree 使用的语言ID，空串表示纯文本
+func NormalizeLanguage(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return CtNodeSyntaxPlainText
+	}
+	if id, ok := languageAliases[name]; ok {
+		return id
+	}
+	return name
+}
+
+// extensionLanguages 文件扩展名到 CherryTree 语言ID的映射
+var extensionLanguages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".pyw":   "python",
+	".sh":    "sh",
+	".bash":  "sh",
+	".zsh":   "sh",
+	".js":    "js",
+	".mjs":   "js",
+	".cjs":   "js",
+	".ts":    "typescript",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".hh":    "cpp",
+	".cs":    "c-sharp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".scala": "scala",
+	".swift": "swift",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".php":   "php",
+	".pl":    "perl",
+	".pm":    "perl",
+	".lua":   "lua",
+	".r":     "r",
+	".sql":   "sql",
+	".html":  "html",
+	".htm":   "html",
+	".css":   "css",
+	".xml":   "xml",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".ini":   "ini",
+	".md":    "markdown",
+	".tex":   "latex",
+	".diff":  "diff",
+	".patch": "diff",
+	".cmake": "cmake",
+	".mk":    "makefile",
+	".ps1":   "powershell",
+	".bat":   "dosbatch",
+	".cmd":   "dosbatch",
+	".vb":    "vbnet",
+	".hs":    "haskell",
+	".erl":   "erlang",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".dart":  "dart",
+	".m":     "objc",
+	".awk":   "awk",
+}
+
+// filenameLanguages 没有扩展名的常见文件名
+var filenameLanguages = map[string]string{
+	"makefile":       "makefile",
+	"gnumakefile":    "makefile",
+	"dockerfile":     "dockerfile",
+	"cmakelists.txt": "cmake",
+}
+
+// LanguageFromFilename 根据文件名与扩展名推断 CherryTree 的语言ID，无法识别时返回空串
+func LanguageFromFilename(name string) string {
+	base := strings.ToLower(filepath.Base(name))
+	if lang, ok := filenameLanguages[base]; ok {
+		return lang
+	}
+	return extensionLanguages[filepath.Ext(base)]
+}
+
+// languageExtensions 有多个扩展名的语言使用的扩展名
+var languageExtensions = map[string]string{
+	"python":     ".py",
+	"python3":    ".py",
+	"sh":         ".sh",
+	"js":         ".js",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"perl":       ".pl",
+	"html":       ".html",
+	"yaml":       ".yaml",
+	"elixir":     ".ex",
+	"dosbatch":   ".bat",
+	"makefile":   ".mk",
+	"diff":       ".diff",
+	"dockerfile": ".dockerfile",
+	"markdown":   ".md",
+	"plain-text": ".txt",
+}
+
+// LanguageExtension CherryTree 语言ID对应的文件扩展名（包含 .），无法识别时为 ".txt"
+func LanguageExtension(lang string) string {
+	lang = NormalizeLanguage(lang)
+	if ext, ok := languageExtensions[lang]; ok {
+		return ext
+	}
+	ret := ""
+	for ext, l := range extensionLanguages {
+		if l == lang && (ret == "" || len(ext) < len(ret) || len(ext) == len(ret) && ext < ret) {
+			ret = ext
+		}
+	}
+	if ret == "" {
+		return ".txt"
+	}
+	return ret
+}
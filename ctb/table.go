@@ -32,12 +32,14 @@ func (n tNode) String() string {
 }
 
 type ptNodeMeta struct {
-	NodeId    int32
-	Name      string
-	Syntax    string
-	IsRo      int32
-	IsRichtxt int32
-	Level     int32
+	NodeId     int32
+	Name       string
+	Syntax     string
+	IsRo       int32
+	IsRichtxt  int32
+	Level      int32
+	TsCreation int32
+	TsLastsave int32
 }
 
 type ptNodeContent struct {
@@ -56,6 +58,7 @@ type tChildren struct {
 	NodeId   int32
 	FatherId int32
 	Sequence int32
+	MasterId int32 // 共享节点的源节点ID，旧版本的文档没有这一列
 }
 
 func (c tChildren) TableName() string {
@@ -106,3 +109,12 @@ type tCodeBox struct {
 func (c tCodeBox) TableName() string {
 	return "codebox"
 }
+
+type tBookmark struct {
+	NodeId   int32
+	Sequence int32
+}
+
+func (b tBookmark) TableName() string {
+	return "bookmark"
+}
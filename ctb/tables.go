@@ -0,0 +1,113 @@
+package ctb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// DocumentTable 文档中的一个表格及其所在的节点
+type DocumentTable struct {
+	NodeId int32    `json:"nodeId"`
+	Path   []string `json:"path"` // 从顶层节点到所在节点的名称
+	Table  *CtTable `json:"table"`
+}
+
+// GetAllTables 按节点树的顺序返回文档中所有的表格
+func (r Handle) GetAllTables() ([]DocumentTable, error) {
+	withGrid, err := r.selectNodeIdsWithWidget(&tGrid{})
+	if err != nil {
+		return nil, err
+	}
+	var ret []DocumentTable
+	err = r.walkNodes(0, nil, func(n *CtNode, path []string) error {
+		if !withGrid[n.Id] || !n.IsRichText {
+			return nil
+		}
+		c, err := r.GetNodeContentById(n.Id, nil)
+		if err != nil {
+			return err
+		}
+		for _, line := range c.Lines {
+			for _, e := range line {
+				if t, ok := e.(*CtTable); ok {
+					ret = append(ret, DocumentTable{NodeId: n.Id, Path: path, Table: t})
+				}
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// ExportTablesCSV 将所有表格写入目录 dir，每个表格一个 CSV 文件，文件名由节点路径与表格的偏移量组成，
+// 如 "Root_Inventory_12.csv"；返回写入的文件路径
+func (r Handle) ExportTablesCSV(dir string) ([]string, error) {
+	tables, err := r.GetAllTables()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	names := uniqueNames{}
+	var files []string
+	for _, t := range tables {
+		name := names.next(widgetFileName(t.Path, t.NodeId, t.Table.Offset), func(name string, n int) string {
+			return fmt.Sprintf("%s~%d", name, n)
+		})
+		p := filepath.Join(dir, name+".csv")
+		if err := writeFile(p, t.Table.WriteCSV); err != nil {
+			return files, err
+		}
+		files = append(files, p)
+	}
+	return files, nil
+}
+
+// ExportTablesXLSX 将所有表格写入一个 xlsx 工作簿，每个表格一个工作表，工作表以节点路径与表格的偏移量命名，
+// 如 "Root>Inventory@12"；名称过长时保留末尾部分
+func (r Handle) ExportTablesXLSX(w io.Writer) error {
+	tables, err := r.GetAllTables()
+	if err != nil {
+		return err
+	}
+	names := uniqueNames{}
+	var sheets []xlsxSheet
+	for _, t := range tables {
+		name := names.next(xlsxSheetName(fmt.Sprintf("%s@%d", strings.Join(t.Path, ">"), t.Table.Offset)), func(name string, n int) string {
+			suffix := fmt.Sprintf("~%d", n)
+			runes := []rune(name)
+			if keep := xlsxMaxSheetName - utf8.RuneCountInString(suffix); len(runes) > keep {
+				runes = runes[:keep]
+			}
+			return string(runes) + suffix
+		})
+		sheet := xlsxSheet{name: name, rows: t.Table.Data}
+		for _, c := range t.Table.Columns {
+			sheet.colWidths = append(sheet.colWidths, c.Width)
+		}
+		sheets = append(sheets, sheet)
+	}
+	if len(sheets) == 0 {
+		// 工作簿至少要有一个工作表
+		sheets = append(sheets, xlsxSheet{name: "Sheet1"})
+	}
+	return writeXlsx(w, sheets)
+}
+
+// writeFile 创建文件并写入内容
+func writeFile(p string, write func(w io.Writer) error) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,522 @@
+package ctb
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// TerminalOptions 终端渲染的选项
+type TerminalOptions struct {
+	// 终端宽度（列数），文本按此宽度折行；0 表示 80
+	Width int
+	// 使用 24 位真彩色，否则使用 256 色
+	TrueColor bool
+	// 不输出任何 ANSI 样式，只保留文本、表格与边框
+	NoColor bool
+	// 反色显示的链接或附件，为 TerminalPage.Items 的下标加 1；0 表示不显示
+	Selected int
+}
+
+// TerminalPage 渲染好的节点内容，以及其中可以操作的链接、附件与锚所在的行
+type TerminalPage struct {
+	Lines   []string       // 带 ANSI 样式的行，不含换行符
+	Items   []TerminalItem // 链接与附件，按出现的顺序
+	Anchors map[string]int // 锚的名称 → 所在行
+}
+
+// TerminalItem 内容中的一个链接（相邻且链接相同的文本合为一个）或者图片、附件
+type TerminalItem struct {
+	Line   int
+	Link   string           // 链接，原始的 link 属性
+	Widget CtAnchoredWidget // *CtPng 或 *CtEmbFile
+}
+
+const defaultTerminalWidth = 80
+
+// termCell 终端中的一个字符及其样式
+type termCell struct {
+	r      rune
+	style  ansiStyle
+	glue   bool // 不允许在此处折行的空白
+	item   int  // 所属的 TerminalItem，下标加 1
+	anchor int  // 所属的锚，下标加 1
+}
+
+type termLine []termCell
+
+var (
+	linkStyle        = ansiStyle{fg: rgb(0x0000ee), underline: true}
+	placeholderStyle = ansiStyle{fg: rgb(0x008a8c), dim: true}
+	frameStyle       = ansiStyle{dim: true}
+)
+
+// RenderTerminal 将节点内容渲染为带 ANSI 样式的终端文本：
+// 文本样式与颜色、标题、折行，表格用制表符绘制，代码框加边框并高亮，图片与附件显示为占位符
+func RenderTerminal(w io.Writer, c *CtNodeContent, opts TerminalOptions) error {
+	page, err := RenderTerminalPage(c, opts)
+	if err != nil {
+		return err
+	}
+	for _, l := range page.Lines {
+		if _, err := io.WriteString(w, l+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderTerminalPage 与 RenderTerminal 相同，按行返回结果，并给出链接、附件与锚所在的行，供交互界面使用
+func RenderTerminalPage(c *CtNodeContent, opts TerminalOptions) (*TerminalPage, error) {
+	if opts.Width <= 0 {
+		opts.Width = defaultTerminalWidth
+	}
+	r := &termRenderer{opts: opts}
+	if !c.IsRichText {
+		if err := r.codeBox(c.Code, c.Language, HighlightOptions{}, false); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, line := range c.Lines {
+			if err := r.line(line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	page := &TerminalPage{Items: r.items, Anchors: map[string]int{}}
+	seen := map[int]bool{}
+	for n, l := range r.out {
+		for _, c := range l {
+			if c.item > 0 && !seen[c.item] {
+				seen[c.item] = true
+				page.Items[c.item-1].Line = n
+			}
+			if c.anchor > 0 {
+				if _, ok := page.Anchors[r.anchors[c.anchor-1]]; !ok {
+					page.Anchors[r.anchors[c.anchor-1]] = n
+				}
+			}
+		}
+		page.Lines = append(page.Lines, r.format(l))
+	}
+	return page, nil
+}
+
+type termRenderer struct {
+	opts    TerminalOptions
+	out     []termLine
+	cur     termLine // 当前段落中尚未折行的内容
+	items   []TerminalItem
+	anchors []string
+}
+
+// line 渲染富文本中的一行；代码框与表格单独成块
+func (r *termRenderer) line(line CtLine) error {
+	for _, e := range line {
+		switch e := e.(type) {
+		case *CtText:
+			item := 0
+			if e.Link != "" {
+				// 与前一段文本的链接相同时属于同一个链接
+				if n := len(r.cur); n > 0 && r.cur[n-1].item > 0 && r.items[r.cur[n-1].item-1].Link == e.Link {
+					item = r.cur[n-1].item
+				} else {
+					r.items = append(r.items, TerminalItem{Link: e.Link})
+					item = len(r.items)
+				}
+			}
+			for _, c := range e.Text {
+				r.cur = append(r.cur, termCell{r: terminalRune(c), style: textStyle(e), item: item})
+			}
+		case *CtCodeBox:
+			r.flush(false)
+			if err := r.codeBox(e.Code, e.Language, HighlightOptionsOf(e), true); err != nil {
+				return err
+			}
+		case *CtTable:
+			r.flush(false)
+			r.table(e)
+		case CtAnchoredWidget:
+			cell := termCell{style: placeholderStyle, glue: true}
+			switch e := e.(type) {
+			case *CtAnchor:
+				r.anchors = append(r.anchors, e.Name)
+				cell.anchor = len(r.anchors)
+			default:
+				r.items = append(r.items, TerminalItem{Widget: e})
+				cell.item = len(r.items)
+			}
+			for _, c := range DefaultPlaceholder(e) {
+				cell.r = terminalRune(c)
+				r.cur = append(r.cur, cell)
+			}
+		}
+	}
+	r.flush(true)
+	return nil
+}
+
+// flush 折行输出当前段落；always 为 false 时空段落不输出
+func (r *termRenderer) flush(always bool) {
+	if len(r.cur) == 0 && !always {
+		return
+	}
+	r.out = append(r.out, wrapCells(r.cur, r.opts.Width)...)
+	r.cur = nil
+}
+
+// textStyle 富文本样式对应的终端样式
+func textStyle(t *CtText) ansiStyle {
+	var s ansiStyle
+	if c, ok := parseColor(t.Foreground); ok {
+		s.fg = &c
+	}
+	if c, ok := parseColor(t.Background); ok {
+		s.bg = &c
+	}
+	s.bold = t.Weight == "heavy"
+	s.italic = t.Style == "italic"
+	s.underline = t.Underline != ""
+	s.strike = t.Strikethrough == "true"
+	switch t.Scale {
+	case "h1", "h2":
+		s.bold, s.underline = true, true
+	case "h3", "h4", "h5", "h6":
+		s.bold = true
+	case "small", "sup", "sub":
+		s.dim = true
+	}
+	if t.Link != "" {
+		s.underline = true
+		if s.fg == nil {
+			s.fg = linkStyle.fg
+		}
+	}
+	return s
+}
+
+// codeBox 带边框的代码框；framed 为 false 时（代码节点）不加边框
+func (r *termRenderer) codeBox(code, language string, hl HighlightOptions, framed bool) error {
+	tokens, err := HighlightCode(code, language, hl)
+	if err != nil {
+		return err
+	}
+	var lines []termLine
+	tokenLines := splitTokenLines(tokens)
+	width := len(fmt.Sprint(len(tokenLines)))
+	for i, tl := range tokenLines {
+		var l termLine
+		if hl.ShowLineNumbers {
+			for _, c := range fmt.Sprintf("%*d │ ", width, i+1) {
+				l = append(l, termCell{r: c, style: frameStyle})
+			}
+		}
+		for _, t := range tl {
+			style := tokenStyles[t.Kind]
+			if t.Kind == TokenBrace && t.Pair == 0 {
+				style = unmatchedBraceStyle
+			}
+			for _, c := range t.Text {
+				l = append(l, termCell{r: terminalRune(c), style: style})
+			}
+		}
+		lines = append(lines, l)
+	}
+	if !framed {
+		for _, l := range lines {
+			r.out = append(r.out, hardWrapCells(expandTabs(l), r.opts.Width)...)
+		}
+		return nil
+	}
+	inner := r.opts.Width - 4
+	if inner < 1 {
+		inner = 1
+	}
+	title := []rune("─ " + NormalizeLanguage(language) + " ")
+	if len(title) > inner+2 {
+		title = title[:inner+2]
+	}
+	r.out = append(r.out, frameLine("╭"+string(title)+strings.Repeat("─", inner+2-len(title))+"╮"))
+	for _, l := range lines {
+		for _, wl := range hardWrapCells(expandTabs(l), inner) {
+			row := frameLine("│ ")
+			row = append(row, wl...)
+			row = append(row, frameLine(strings.Repeat(" ", inner-cellsWidth(wl))+" │")...)
+			r.out = append(r.out, row)
+		}
+	}
+	r.out = append(r.out, frameLine("╰"+strings.Repeat("─", inner+2)+"╯"))
+	return nil
+}
+
+// table 用制表符绘制表格，列宽超出终端宽度时按比例缩小并在单元格内折行
+func (r *termRenderer) table(t *CtTable) {
+	cols := t.ColumnCount()
+	if cols == 0 {
+		return
+	}
+	widths := make([]int, cols)
+	for _, row := range t.Data {
+		for i := 0; i < cols && i < len(row); i++ {
+			for _, l := range strings.Split(row[i], "\n") {
+				if w := TerminalTextWidth(l); w > widths[i] {
+					widths[i] = w
+				}
+			}
+		}
+	}
+	for i := range widths {
+		if widths[i] < 1 {
+			widths[i] = 1
+		}
+	}
+	// 每列占用 宽度+3（两侧空格与分隔线），再加最左侧的边框
+	avail := r.opts.Width - 1 - 3*cols
+	for total := sumInts(widths); total > avail && total > cols; total = sumInts(widths) {
+		widest := 0
+		for i := range widths {
+			if widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		widths[widest]--
+	}
+	rule := func(left, mid, right string) {
+		var sb strings.Builder
+		sb.WriteString(left)
+		for i, w := range widths {
+			if i > 0 {
+				sb.WriteString(mid)
+			}
+			sb.WriteString(strings.Repeat("─", w+2))
+		}
+		sb.WriteString(right)
+		r.out = append(r.out, frameLine(sb.String()))
+	}
+	rule("┌", "┬", "┐")
+	for ri, row := range t.Data {
+		style := ansiStyle{}
+		if ri == 0 {
+			style.bold = true
+		}
+		// 每个单元格折行后的内容
+		cells := make([][]termLine, cols)
+		height := 1
+		for i := 0; i < cols; i++ {
+			text := ""
+			if i < len(row) {
+				text = row[i]
+			}
+			for _, l := range strings.Split(text, "\n") {
+				var line termLine
+				for _, c := range l {
+					line = append(line, termCell{r: terminalRune(c), style: style})
+				}
+				cells[i] = append(cells[i], wrapCells(expandTabs(line), widths[i])...)
+			}
+			if len(cells[i]) > height {
+				height = len(cells[i])
+			}
+		}
+		for h := 0; h < height; h++ {
+			line := frameLine("│")
+			for i := 0; i < cols; i++ {
+				var content termLine
+				if h < len(cells[i]) {
+					content = cells[i][h]
+				}
+				line = append(line, termCell{r: ' '})
+				line = append(line, content...)
+				line = append(line, termLine(frameLine(strings.Repeat(" ", widths[i]-cellsWidth(content)+1)+"│"))...)
+			}
+			r.out = append(r.out, line)
+		}
+		if ri == 0 && len(t.Data) > 1 {
+			rule("├", "┼", "┤")
+		}
+	}
+	rule("└", "┴", "┘")
+}
+
+func sumInts(list []int) int {
+	total := 0
+	for _, i := range list {
+		total += i
+	}
+	return total
+}
+
+func frameLine(s string) termLine {
+	var l termLine
+	for _, c := range s {
+		l = append(l, termCell{r: terminalRune(c), style: frameStyle})
+	}
+	return l
+}
+
+// format 输出一行，只在样式变化时输出转义序列
+func (r *termRenderer) format(l termLine) string {
+	var sb strings.Builder
+	cur := ""
+	for _, c := range l {
+		seq := ""
+		if !r.opts.NoColor {
+			style := c.style
+			style.reverse = c.item > 0 && c.item == r.opts.Selected
+			seq = style.sgr(r.opts.TrueColor)
+		}
+		if seq != cur {
+			if cur != "" {
+				sb.WriteString(ansiReset)
+			}
+			sb.WriteString(seq)
+			cur = seq
+		}
+		sb.WriteRune(c.r)
+	}
+	if cur != "" {
+		sb.WriteString(ansiReset)
+	}
+	return sb.String()
+}
+
+// TerminalSafeText 将控制字符（Tab 除外）替换为 U+FFFD，文档中的文本不能向终端输出转义序列
+func TerminalSafeText(s string) string {
+	return strings.Map(terminalRune, s)
+}
+
+func terminalRune(r rune) rune {
+	if r != '\t' && unicode.IsControl(r) {
+		return utf8.RuneError
+	}
+	return r
+}
+
+// runeWidth 字符在终端中占用的列数：组合字符与格式字符为 0，
+// Unicode 东亚宽度为宽（W，包括大部分 emoji）或全角（F）的字符为 2
+func runeWidth(r rune) int {
+	if r == 0 || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// TerminalTextWidth 文本在终端中占用的列数
+func TerminalTextWidth(s string) int {
+	w := 0
+	for _, c := range s {
+		w += runeWidth(c)
+	}
+	return w
+}
+
+func cellsWidth(l termLine) int {
+	w := 0
+	for _, c := range l {
+		w += runeWidth(c.r)
+	}
+	return w
+}
+
+// expandTabs 将 Tab 展开为空格（制表位为 4）
+func expandTabs(l termLine) termLine {
+	var ret termLine
+	col := 0
+	for _, c := range l {
+		if c.r == '\t' {
+			for n := 4 - col%4; n > 0; n-- {
+				ret = append(ret, termCell{r: ' ', style: c.style})
+				col++
+			}
+			continue
+		}
+		ret = append(ret, c)
+		col += runeWidth(c.r)
+	}
+	return ret
+}
+
+// hardWrapCells 按宽度截断为多行，不考虑单词边界
+func hardWrapCells(l termLine, width int) []termLine {
+	var ret []termLine
+	var cur termLine
+	w := 0
+	for _, c := range l {
+		cw := runeWidth(c.r)
+		if w+cw > width && len(cur) > 0 {
+			ret = append(ret, cur)
+			cur, w = nil, 0
+		}
+		cur = append(cur, c)
+		w += cw
+	}
+	return append(ret, cur)
+}
+
+// wrapCells 按单词折行：在空格处或者宽字符之间断行，超过宽度的单词强制截断，行首的空格去掉
+func wrapCells(l termLine, width int) []termLine {
+	if width < 1 {
+		width = 1
+	}
+	l = expandTabs(l)
+	// 拆分为不可分割的单元：连续的非空白窄字符、单个空白、单个宽字符
+	var units []termLine
+	for i := 0; i < len(l); {
+		j := i + 1
+		if !isBreakSpace(l[i]) && runeWidth(l[i].r) < 2 {
+			for j < len(l) && !isBreakSpace(l[j]) && runeWidth(l[j].r) < 2 {
+				j++
+			}
+		}
+		units = append(units, l[i:j])
+		i = j
+	}
+	var ret []termLine
+	var cur termLine
+	w := 0
+	for _, u := range units {
+		uw := cellsWidth(u)
+		isSpace := isBreakSpace(u[0])
+		if w+uw > width {
+			if isSpace {
+				continue
+			}
+			if cur = trimRightCells(cur); len(cur) > 0 {
+				ret = append(ret, cur)
+			}
+			cur, w = nil, 0
+			// 比一整行还长的单词
+			for uw > width {
+				parts := hardWrapCells(u, width)
+				ret = append(ret, parts[:len(parts)-1]...)
+				u = parts[len(parts)-1]
+				uw = cellsWidth(u)
+			}
+		}
+		if isSpace && len(cur) == 0 && len(ret) > 0 {
+			continue
+		}
+		cur = append(cur, u...)
+		w += uw
+	}
+	return append(ret, trimRightCells(cur))
+}
+
+func isBreakSpace(c termCell) bool {
+	return unicode.IsSpace(c.r) && !c.glue
+}
+
+func trimRightCells(l termLine) termLine {
+	for len(l) > 0 && unicode.IsSpace(l[len(l)-1].r) {
+		l = l[:len(l)-1]
+	}
+	return l
+}
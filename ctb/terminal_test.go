@@ -0,0 +1,67 @@
+package ctb
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestRenderTerminalControlCharacters(t *testing.T) {
+	const evil = "hi\x1b]52;c;aGVsbG8=\x07\x1b[2J\u009b31m"
+	tests := []struct {
+		name    string
+		content *CtNodeContent
+	}{
+		{"rich text", &CtNodeContent{IsRichText: true, Lines: CtRichText{{
+			&CtText{XmlRichText: XmlRichText{Text: evil}},
+			&CtText{XmlRichText: XmlRichText{Text: evil, Link: "webs https://example.com"}},
+		}}}},
+		{"code node", &CtNodeContent{Language: "sh", Code: evil + "\n" + evil}},
+		{"code box", &CtNodeContent{IsRichText: true, Lines: CtRichText{{
+			&CtCodeBox{Code: evil, Language: "go\x1b[2J", IsShowLineNumber: true},
+		}}}},
+		{"table", &CtNodeContent{IsRichText: true, Lines: CtRichText{{
+			&CtTable{Data: [][]string{{evil, "b"}, {"c", evil}}, Header: []string{evil, "b"}},
+		}}}},
+		{"placeholders", &CtNodeContent{IsRichText: true, Lines: CtRichText{{
+			&CtEmbFile{Filename: evil}, &CtAnchor{Name: evil},
+		}}}},
+	}
+	for _, tt := range tests {
+		for _, noColor := range []bool{false, true} {
+			page, err := RenderTerminalPage(tt.content, TerminalOptions{Width: 40, NoColor: noColor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := strings.Join(page.Lines, "\n")
+			if !strings.Contains(out, "\ufffd]52;c;") {
+				t.Errorf("%s: control characters are not replaced:\n%q", tt.name, out)
+			}
+			// 去掉渲染器自己输出的 SGR 序列后不应再有任何控制字符
+			for _, c := range sgrPattern.ReplaceAllString(out, "") {
+				if c != '\n' && unicode.IsControl(c) {
+					t.Errorf("%s: output contains control character %U:\n%q", tt.name, c, out)
+					break
+				}
+			}
+		}
+	}
+}
+
+var sgrPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+func TestTerminalSafeText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain 中文", "plain 中文"},
+		{"a\tb", "a\tb"},
+		{"a\nb\r", "a\ufffdb\ufffd"},
+		{"\x1b[31mred\x1b[0m", "\ufffd[31mred\ufffd[0m"},
+		{"\u009b2J\x7f", "\ufffd2J\ufffd"},
+	}
+	for _, tt := range tests {
+		if got := TerminalSafeText(tt.in); got != tt.want {
+			t.Errorf("TerminalSafeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
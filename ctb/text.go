@@ -0,0 +1,173 @@
+package ctb
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PlainTextOptions 提取纯文本的选项
+type PlainTextOptions struct {
+	// 输出代码框的代码，否则输出占位符
+	IncludeCodeBoxes bool
+	// 输出表格的内容（单元格以 Tab 分隔，每行一行），否则输出占位符
+	IncludeTables bool
+	// 附件类元素的占位符，为 nil 时使用 DefaultPlaceholder；返回空串表示不输出
+	Placeholder func(e CtAnchoredWidget) string
+	// 在链接文本后面保留链接目标，如 "text <https://example.com>"，否则只保留链接文本
+	KeepLinkTargets bool
+}
+
+// DefaultPlaceholder 附件类元素默认的占位符，如 "[image: 640x480]"
+func DefaultPlaceholder(e CtAnchoredWidget) string {
+	switch e := e.(type) {
+	case *CtCodeBox:
+		return fmt.Sprintf("[code-box: %s]", e.Language)
+	case *CtTable:
+		return fmt.Sprintf("[table: %dx%d]", len(e.Data), e.ColumnCount())
+	case *CtPng:
+		return fmt.Sprintf("[image: %dx%d]", e.Width, e.Height)
+	case *CtEmbFile:
+		return fmt.Sprintf("[file: %s]", e.Filename)
+	case *CtAnchor:
+		return fmt.Sprintf("[anchor: %s]", e.Name)
+	}
+	return ""
+}
+
+// GetNodePlainText 节点内容的纯文本；代码与纯文本节点直接返回其内容
+func (r Handle) GetNodePlainText(id int32, opts PlainTextOptions) (string, error) {
+	c, err := r.GetNodeContentById(id, nil)
+	if err != nil {
+		return "", err
+	}
+	return plainText(c, opts), nil
+}
+
+// Summary 节点纯文本的前 n 个字符（不含代码框、表格与附件，连续的空白合并为一个空格），用于预览
+func (r Handle) Summary(id int32, n int) (string, error) {
+	text, err := r.GetNodePlainText(id, PlainTextOptions{
+		Placeholder: func(CtAnchoredWidget) string { return "" },
+	})
+	if err != nil {
+		return "", err
+	}
+	return summarize(text, n), nil
+}
+
+// summarize 合并空白后截取前 n 个字符
+func summarize(text string, n int) string {
+	var ret []rune
+	space := false
+	for _, c := range strings.TrimSpace(text) {
+		if len(ret) >= n {
+			break
+		}
+		if unicode.IsSpace(c) {
+			space = true
+			continue
+		}
+		if space {
+			ret = append(ret, ' ')
+			space = false
+			if len(ret) >= n {
+				break
+			}
+		}
+		ret = append(ret, c)
+	}
+	return strings.TrimRightFunc(string(ret), unicode.IsSpace)
+}
+
+// renderText 将节点内容渲染为纯文本，附件类元素以占位符表示
+func renderText(c *CtNodeContent) string {
+	return plainText(c, PlainTextOptions{})
+}
+
+func plainText(c *CtNodeContent, opts PlainTextOptions) string {
+	if !c.IsRichText {
+		return c.Code
+	}
+	placeholder := opts.Placeholder
+	if placeholder == nil {
+		placeholder = DefaultPlaceholder
+	}
+	var (
+		sb         strings.Builder
+		afterBlock bool // 刚输出了代码框或表格的内容，后面的文本需要另起一行
+	)
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if afterBlock && !strings.HasPrefix(s, "\n") {
+			sb.WriteByte('\n')
+		}
+		afterBlock = false
+		sb.WriteString(s)
+	}
+	// block 代码框与表格的内容单独成行
+	block := func(s string) {
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(s)
+		afterBlock = true
+	}
+	_ = c.Lines.Walk(CtVisitorFuncs{
+		Text: func(t *CtText) error {
+			write(t.Text)
+			if opts.KeepLinkTargets && t.Link != "" && t.Text != "" {
+				if target := linkTarget(t.Link); target != "" {
+					write(" <" + target + ">")
+				}
+			}
+			return nil
+		},
+		CodeBox: func(cb *CtCodeBox) error {
+			if opts.IncludeCodeBoxes {
+				block(cb.Code)
+				return nil
+			}
+			write(placeholder(cb))
+			return nil
+		},
+		Table: func(t *CtTable) error {
+			if opts.IncludeTables {
+				var rows []string
+				for _, row := range t.Data {
+					rows = append(rows, strings.Join(row, "\t"))
+				}
+				block(strings.Join(rows, "\n"))
+				return nil
+			}
+			write(placeholder(t))
+			return nil
+		},
+		Png: func(p *CtPng) error {
+			write(placeholder(p))
+			return nil
+		},
+		EmbFile: func(f *CtEmbFile) error {
+			write(placeholder(f))
+			return nil
+		},
+		Anchor: func(a *CtAnchor) error {
+			write(placeholder(a))
+			return nil
+		},
+		LineBreak: func() error {
+			write("\n")
+			return nil
+		},
+	})
+	return sb.String()
+}
+
+// linkTarget 将 CherryTree 的链接转换为可读的形式：网址原样返回，文件与目录解码为路径，节点链接为 "node ID#anchor"
+func linkTarget(link string) string {
+	if l, ok := ParseLink(link); ok {
+		return l.String()
+	}
+	return link
+}
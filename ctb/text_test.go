@@ -0,0 +1,92 @@
+package ctb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	text := func(s string) *CtText {
+		return &CtText{Type: CtDocElementText, XmlRichText: XmlRichText{Text: s}}
+	}
+	link := text("docs")
+	link.Link = "webs https://example.com"
+	c := &CtNodeContent{IsRichText: true, Lines: CtRichText{
+		{text("Title")},
+		{text("see "), link},
+		{&CtCodeBox{Code: "x := 1", Language: "go"}, text(" after")},
+		{&CtTable{Data: [][]string{{"a", "b"}, {"1", "2"}}, Header: []string{"a", "b"}}},
+		{&CtPng{Width: 2, Height: 1}, &CtEmbFile{Filename: "f.txt"}, &CtAnchor{Name: "here"}},
+	}}
+	tests := []struct {
+		name string
+		opts PlainTextOptions
+		want string
+	}{
+		{"default", PlainTextOptions{},
+			"Title\nsee docs\n[code-box: go] after\n[table: 2x2]\n[image: 2x1][file: f.txt][anchor: here]"},
+		{"code boxes and tables", PlainTextOptions{IncludeCodeBoxes: true, IncludeTables: true},
+			"Title\nsee docs\nx := 1\n after\na\tb\n1\t2\n[image: 2x1][file: f.txt][anchor: here]"},
+		{"link targets", PlainTextOptions{KeepLinkTargets: true},
+			"Title\nsee docs <https://example.com>\n[code-box: go] after\n[table: 2x2]\n[image: 2x1][file: f.txt][anchor: here]"},
+		{"no placeholders", PlainTextOptions{Placeholder: func(CtAnchoredWidget) string { return "" }},
+			"Title\nsee docs\n after\n\n"},
+		{"custom placeholders", PlainTextOptions{Placeholder: func(CtAnchoredWidget) string { return "*" }},
+			"Title\nsee docs\n* after\n*\n***"},
+	}
+	for _, tt := range tests {
+		if got := plainText(c, tt.opts); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+	// 代码与纯文本节点原样返回
+	code := &CtNodeContent{Language: "go", Code: "package main\n"}
+	if got := plainText(code, PlainTextOptions{IncludeCodeBoxes: true}); got != code.Code {
+		t.Errorf("code node: %q", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"  a  b\n\tc ", 10, "a b c"},
+		{"hello world", 5, "hello"},
+		{"hello world", 6, "hello"},
+		{"hello world", 7, "hello w"},
+		{"中文 文本", 3, "中文"},
+		{"中文 文本", 4, "中文 文"},
+		{"abc", 0, ""},
+		{" \n ", 5, ""},
+	}
+	for _, tt := range tests {
+		if got := summarize(tt.text, tt.n); got != tt.want {
+			t.Errorf("summarize(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestGetNodePlainText(t *testing.T) {
+	h := openDocument(t, sampleDocument())
+	got, err := h.GetNodePlainText(1, PlainTextOptions{IncludeCodeBoxes: true, IncludeTables: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"中文 heading\nlink ", "\treturn\n}", "h1\th2\n<a>\tb&c", "[image: 2x1]", "[file: file name.bin]", "  trailing  [anchor: here]"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("plain text does not contain %q:\n%s", want, got)
+		}
+	}
+	if got, err := h.GetNodePlainText(2, PlainTextOptions{}); err != nil || got != "print('<&>')\n\n" {
+		t.Errorf("code node: %q, %v", got, err)
+	}
+	// 代码框、表格与附件都不出现在摘要中
+	if got, err := h.Summary(1, 20); err != nil || got != "中文 heading link trai" {
+		t.Errorf("Summary(1, 20) = %q, %v", got, err)
+	}
+	if _, err := h.Summary(99, 10); !IsNotFound(err) {
+		t.Errorf("Summary of a missing node: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package ctb
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// walkNodes 先序遍历 fatherId 下的所有节点，兄弟节点按 sequence 排序；path 为从顶层节点到当前节点的名称
+func (r Handle) walkNodes(fatherId int32, path []string, fn func(n *CtNode, path []string) error) error {
+	list, err := r.GetSubNodesById(fatherId)
+	if err != nil {
+		return err
+	}
+	for _, n := range list {
+		p := append(path[:len(path):len(path)], n.Name)
+		if err := fn(n, p); err != nil {
+			return err
+		}
+		if n.HasChildren {
+			if err := r.walkNodes(n.Id, p, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// treeEntry 导出范围内的一个节点
+type treeEntry struct {
+	node  *CtNode
+	depth int // 在导出范围内的深度，最上层为 0
+}
+
+// subtree 按先序返回节点 id 及其所有下级节点；id 为 0 时返回整个文档，withChildren 为 false 时只返回节点本身
+func (r Handle) subtree(id int32, withChildren bool) ([]treeEntry, error) {
+	var ret []treeEntry
+	base := 0
+	if id != 0 {
+		n, err := r.GetNodeById(id)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, treeEntry{node: n})
+		if !withChildren || !n.HasChildren {
+			return ret, nil
+		}
+		base = 1
+	}
+	err := r.walkNodes(id, nil, func(n *CtNode, path []string) error {
+		ret = append(ret, treeEntry{node: n, depth: base + len(path) - 1})
+		return nil
+	})
+	return ret, err
+}
+
+// safeFileName 将节点名称转换为可以用作文件名的形式
+func safeFileName(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if unicode.IsControl(c) || strings.ContainsRune(`/\:*?"<>|`, c) {
+			return '_'
+		}
+		return c
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// maxFileNameBytes 由节点路径生成的文件名（不含序号与扩展名）的最大字节数；多数文件系统限制文件名为 255 字节
+const maxFileNameBytes = 200
+
+// pathFileName 由节点路径组成的文件名（不含扩展名），如 "Root_Child"；
+// 过长时只保留末尾部分，并加上节点ID以免与其他截断后的名称相同，如 "…Child_12"
+func pathFileName(path []string, id int32) string {
+	return limitFileName(joinFileName(path), "", fmt.Sprintf("_%d", id))
+}
+
+// widgetFileName 由节点路径与锚定元素的偏移量组成的文件名（不含扩展名），如 "Root_Child_34"；
+// 过长时与 pathFileName 一样截断，偏移量之前加上节点ID，如 "…Child_12_34"
+func widgetFileName(path []string, id, offset int32) string {
+	return limitFileName(joinFileName(path), fmt.Sprintf("_%d", offset), fmt.Sprintf("_%d_%d", id, offset))
+}
+
+func joinFileName(path []string) string {
+	parts := make([]string, 0, len(path))
+	for _, p := range path {
+		parts = append(parts, safeFileName(p))
+	}
+	return strings.Join(parts, "_")
+}
+
+// limitFileName name 加上 suffix 不超过 maxFileNameBytes 时直接相连；
+// 否则在 UTF-8 字符的边界上截掉 name 的开头，再加上 longSuffix
+func limitFileName(name, suffix, longSuffix string) string {
+	if len(name)+len(suffix) <= maxFileNameBytes {
+		return name + suffix
+	}
+	const ellipsis = "…"
+	start := len(name) - (maxFileNameBytes - len(ellipsis) - len(longSuffix))
+	for start < len(name) && !utf8.RuneStart(name[start]) {
+		start++
+	}
+	return ellipsis + name[start:] + longSuffix
+}
+
+// uniqueNames 为重复的名称加上序号
+type uniqueNames map[string]int
+
+func (u uniqueNames) next(name string, format func(name string, n int) string) string {
+	u[strings.ToLower(name)]++
+	n := u[strings.ToLower(name)]
+	if n == 1 {
+		return name
+	}
+	for {
+		candidate := format(name, n)
+		if u[strings.ToLower(candidate)] == 0 {
+			u[strings.ToLower(candidate)]++
+			return candidate
+		}
+		n++
+	}
+}
@@ -0,0 +1,304 @@
+package ctb
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchPollInterval = time.Second
+	defaultWatchDebounce     = 200 * time.Millisecond
+	// 重新打开后，旧连接延迟关闭，让仍在使用旧 Handle 的查询有机会完成
+	watchCloseGrace = 10 * time.Second
+	// 重新打开失败（例如 CherryTree 正在保存改名）后重试的最长间隔，间隔从 Debounce 的两倍开始逐次加倍
+	watchMaxRetryDelay = 30 * time.Second
+)
+
+// WatchOptions 监视选项
+type WatchOptions struct {
+	PollInterval time.Duration // 轮询间隔，仅在轮询模式下生效，默认 1s
+	Debounce     time.Duration // 文件变化后等待写入平息的时间，默认 200ms
+	ForcePolling bool          // 不使用 inotify，总是轮询
+	Open         OpenOptions   // 打开文档的方式，每次重新打开时都相同；总是只读打开（自动设置 ReadOnly），所以不能设置 JournalMode
+}
+
+// ChangeEvent 文档变化事件，依据各节点的 ts_lastsave 计算
+type ChangeEvent struct {
+	Added    []int32 `json:"added,omitempty"`
+	Removed  []int32 `json:"removed,omitempty"`
+	Modified []int32 `json:"modified,omitempty"`
+}
+
+func (e ChangeEvent) IsEmpty() bool {
+	return len(e.Added) == 0 && len(e.Removed) == 0 && len(e.Modified) == 0
+}
+
+// Watcher 监视 ctb 文件，文件被 CherryTree 改写后重新打开数据库连接并发出变化事件。
+// 使用者应当每次都通过 Handle() 获取当前的句柄，而不是长期持有某个 *Handle：
+// 被替换的句柄在一段时间后关闭，之后的查询会返回错误。
+type Watcher struct {
+	filepath string
+	opts     WatchOptions
+	notifier fileNotifier
+	events   chan ChangeEvent
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	mu       sync.RWMutex
+	handle   *Handle
+	stamps   map[int32]int32 // node_id -> ts_lastsave
+	onReload []func(h *Handle, e ChangeEvent)
+}
+
+// fileNotifier 文件变化通知源（inotify 或轮询）
+type fileNotifier interface {
+	C() <-chan struct{}
+	close() error
+}
+
+// NewWatcher 打开 ctb 文件并开始监视；Linux 上使用 inotify，不可用时退化为轮询
+func NewWatcher(filepath string, opts WatchOptions) (*Watcher, error) {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultWatchPollInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultWatchDebounce
+	}
+	// 监视的文件会被 CherryTree 改写；读写方式打开时，如果恰好在 CherryTree 保存改名的间隙重新打开，
+	// sqlite 会在原来的位置创建一个空数据库
+	opts.Open.ReadOnly = true
+	h, err := OpenFile(filepath, opts.Open)
+	if err != nil {
+		return nil, err
+	}
+	stamps, err := h.selectLastSaveTimes()
+	if err != nil {
+		_ = h.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		filepath: filepath,
+		opts:     opts,
+		events:   make(chan ChangeEvent, 16),
+		done:     make(chan struct{}),
+		handle:   h,
+		stamps:   stamps,
+	}
+	if !opts.ForcePolling {
+		w.notifier, err = newInotifyNotifier(filepath)
+		if err != nil {
+			log.Warnf("inotify is unavailable for %v, falling back to polling: %v", filepath, err)
+		}
+	}
+	if w.notifier == nil {
+		w.notifier = newPollNotifier(filepath, opts.PollInterval)
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w, nil
+}
+
+// Handle 返回当前有效的查询句柄
+func (w *Watcher) Handle() *Handle {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.handle
+}
+
+// Events 变化事件；事件通道带缓冲，消费不及时的事件会被丢弃
+func (w *Watcher) Events() <-chan ChangeEvent {
+	return w.events
+}
+
+// OnReload 注册重新打开后的回调（例如清空使用者自己的缓存），回调在监视协程中同步执行
+func (w *Watcher) OnReload(fn func(h *Handle, e ChangeEvent)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onReload = append(w.onReload, fn)
+}
+
+// Close 停止监视并关闭当前句柄；可以重复调用，之后的调用返回第一次的结果
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err := w.notifier.close()
+		w.wg.Wait()
+		close(w.events)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if cerr := w.handle.Close(); err == nil {
+			err = cerr
+		}
+		w.closeErr = err
+	})
+	return w.closeErr
+}
+
+func (w *Watcher) loop() {
+	defer w.wg.Done()
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+		retry   time.Duration // 上一次重试的间隔，0 表示上一次重新打开成功
+	)
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-w.notifier.C():
+			// 等待写入平息
+			if timer == nil {
+				timer = time.NewTimer(w.opts.Debounce)
+			} else {
+				// 定时器已经触发但还没有被读取时先取走，否则 Reset 之后会立即收到旧的触发
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(w.opts.Debounce)
+			}
+			timeout = timer.C
+		case <-timeout:
+			timeout = nil
+			err := w.reload()
+			if err == nil {
+				retry = 0
+				continue
+			}
+			// 不等下一次文件变化，过一段时间再试，否则可能一直使用旧的句柄
+			if retry = 2 * retry; retry == 0 {
+				retry = 2 * w.opts.Debounce
+			}
+			if retry > watchMaxRetryDelay {
+				retry = watchMaxRetryDelay
+			}
+			log.Warnf("An error occurred while reloading %v, retrying in %v: %v", w.filepath, retry, err)
+			// 定时器已经触发并且被读取，可以直接 Reset
+			timer.Reset(retry)
+			timeout = timer.C
+		}
+	}
+}
+
+// reload 重新打开数据库连接，与上一次的快照比较得到变化事件
+func (w *Watcher) reload() error {
+	h, err := OpenFile(w.filepath, w.opts.Open)
+	if err != nil {
+		return err
+	}
+	stamps, err := h.selectLastSaveTimes()
+	if err != nil {
+		_ = h.Close()
+		return err
+	}
+	w.mu.Lock()
+	old := w.handle
+	e := diffLastSaveTimes(w.stamps, stamps)
+	w.handle = h
+	w.stamps = stamps
+	callbacks := append([]func(*Handle, ChangeEvent){}, w.onReload...)
+	w.mu.Unlock()
+
+	time.AfterFunc(watchCloseGrace, func() {
+		_ = old.Close()
+	})
+	for _, fn := range callbacks {
+		fn(h, e)
+	}
+	if e.IsEmpty() {
+		return nil
+	}
+	select {
+	case w.events <- e:
+	default:
+		log.Warnf("Change event of %v dropped because nobody is receiving", w.filepath)
+	}
+	return nil
+}
+
+func diffLastSaveTimes(before, after map[int32]int32) ChangeEvent {
+	var e ChangeEvent
+	for id, ts := range after {
+		old, ok := before[id]
+		if !ok {
+			e.Added = append(e.Added, id)
+		} else if old != ts {
+			e.Modified = append(e.Modified, id)
+		}
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			e.Removed = append(e.Removed, id)
+		}
+	}
+	for _, ids := range [][]int32{e.Added, e.Removed, e.Modified} {
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+	}
+	return e
+}
+
+// pollNotifier 定期比较文件（以及 WAL 文件）的大小与修改时间
+type pollNotifier struct {
+	c    chan struct{}
+	done chan struct{}
+}
+
+func newPollNotifier(filepath string, interval time.Duration) *pollNotifier {
+	p := &pollNotifier{
+		c:    make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	stat := func() string {
+		var s string
+		for _, f := range []string{filepath, filepath + "-wal"} {
+			if fi, err := os.Stat(f); err == nil {
+				s += fmt.Sprintf("%d/%d;", fi.Size(), fi.ModTime().UnixNano())
+			}
+		}
+		return s
+	}
+	// 在返回前取得基准，否则紧接着的写入可能被当作基准而被漏掉
+	last := stat()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				if cur := stat(); cur != last {
+					last = cur
+					select {
+					case p.c <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return p
+}
+
+func (p *pollNotifier) C() <-chan struct{} {
+	return p.c
+}
+
+func (p *pollNotifier) close() error {
+	close(p.done)
+	return nil
+}
@@ -0,0 +1,65 @@
+package ctb
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyNotifier 监视文件所在目录，这样无论 CherryTree 是原地写入还是写临时文件后改名都能察觉
+type inotifyNotifier struct {
+	file *os.File
+	c    chan struct{}
+}
+
+func newInotifyNotifier(filepath string) (fileNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Dir(filepath)
+	mask := uint32(syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_DELETE)
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+	n := &inotifyNotifier{
+		file: os.NewFile(uintptr(fd), "inotify"), // 非阻塞 fd 会交给 runtime poller，Close 可以唤醒阻塞的 Read
+		c:    make(chan struct{}, 1),
+	}
+	go n.readEvents(path.Base(filepath))
+	return n, nil
+}
+
+func (n *inotifyNotifier) readEvents(name string) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		cnt, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= cnt; {
+			e := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(e.Len)]
+			offset += syscall.SizeofInotifyEvent + int(e.Len)
+			eventName := string(bytes.TrimRight(nameBytes, "\x00"))
+			if eventName != name && eventName != name+"-wal" {
+				continue
+			}
+			select {
+			case n.c <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (n *inotifyNotifier) C() <-chan struct{} {
+	return n.c
+}
+
+func (n *inotifyNotifier) close() error {
+	return n.file.Close()
+}
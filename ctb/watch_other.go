@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ctb
+
+import "errors"
+
+func newInotifyNotifier(string) (fileNotifier, error) {
+	return nil, errors.New("inotify is only supported on linux")
+}
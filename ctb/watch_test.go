@@ -0,0 +1,171 @@
+package ctb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffLastSaveTimes(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after map[int32]int32
+		want          ChangeEvent
+	}{
+		{"unchanged", map[int32]int32{1: 10, 2: 20}, map[int32]int32{1: 10, 2: 20}, ChangeEvent{}},
+		{"empty", nil, nil, ChangeEvent{}},
+		{"added", map[int32]int32{1: 10}, map[int32]int32{1: 10, 3: 30, 2: 20}, ChangeEvent{Added: []int32{2, 3}}},
+		{"removed", map[int32]int32{1: 10, 3: 30, 2: 20}, map[int32]int32{2: 20}, ChangeEvent{Removed: []int32{1, 3}}},
+		{"modified", map[int32]int32{1: 10, 2: 20, 3: 30}, map[int32]int32{1: 11, 2: 20, 3: 29}, ChangeEvent{Modified: []int32{1, 3}}},
+		{
+			"all",
+			map[int32]int32{1: 10, 2: 20, 3: 30},
+			map[int32]int32{1: 10, 2: 21, 4: 40},
+			ChangeEvent{Added: []int32{4}, Removed: []int32{3}, Modified: []int32{2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffLastSaveTimes(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.IsEmpty() != (tt.want.Added == nil && tt.want.Removed == nil && tt.want.Modified == nil) {
+				t.Errorf("IsEmpty() = %v", got.IsEmpty())
+			}
+		})
+	}
+}
+
+// changedDocument sampleDocument 修改节点 2、删除节点 5、添加节点 6 之后的版本
+func changedDocument() *rawDocument {
+	doc := sampleDocument()
+	doc.nodes[2].node.TsLastsave++
+	delete(doc.nodes, 5)
+	doc.nodes[6] = newRawNode(6, 0, 3, "new", time.Unix(1700000000, 0))
+	return doc
+}
+
+var wantChange = ChangeEvent{Added: []int32{6}, Removed: []int32{5}, Modified: []int32{2}}
+
+func newTestWatcher(t *testing.T, opts WatchOptions) (*Watcher, string) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "doc.ctb")
+	if err := writeRawDocument(p, sampleDocument()); err != nil {
+		t.Fatal(err)
+	}
+	opts.ForcePolling = true
+	opts.Debounce = 10 * time.Millisecond
+	w, err := NewWatcher(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = w.Close()
+	})
+	return w, p
+}
+
+func waitEvent(t *testing.T, w *Watcher) ChangeEvent {
+	t.Helper()
+	select {
+	case e := <-w.Events():
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("no change event")
+	}
+	return ChangeEvent{}
+}
+
+func TestWatcherReload(t *testing.T) {
+	w, p := newTestWatcher(t, WatchOptions{PollInterval: 10 * time.Millisecond})
+	old := w.Handle()
+	var mu sync.Mutex
+	var reloaded []ChangeEvent
+	w.OnReload(func(h *Handle, e ChangeEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		reloaded = append(reloaded, e)
+	})
+	// 与 CherryTree 一样写入临时文件后改名
+	if err := writeRawDocument(p, changedDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitEvent(t, w); !reflect.DeepEqual(e, wantChange) {
+		t.Errorf("event %+v, want %+v", e, wantChange)
+	}
+	mu.Lock()
+	if len(reloaded) != 1 || !reflect.DeepEqual(reloaded[0], wantChange) {
+		t.Errorf("reload callbacks %+v", reloaded)
+	}
+	mu.Unlock()
+	h := w.Handle()
+	if h == old {
+		t.Fatal("handle was not replaced")
+	}
+	if n, err := h.GetNodeById(6); err != nil || n.Name != "new" {
+		t.Errorf("new handle: node 6 %+v, %v", n, err)
+	}
+	// 旧句柄在一段时间内仍然可用
+	if _, err := old.GetNodeById(5); err != nil {
+		t.Errorf("old handle: %v", err)
+	}
+}
+
+func TestWatcherRetry(t *testing.T) {
+	// 轮询间隔很长，只有重试才能发现文件恢复了
+	w, p := newTestWatcher(t, WatchOptions{PollInterval: time.Hour})
+	notify := func() {
+		w.notifier.(*pollNotifier).c <- struct{}{}
+	}
+	// CherryTree 保存时的改名间隙：文件暂时不存在
+	if err := os.Rename(p, p+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	notify()
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("reloading a missing document created it: %v", err)
+	}
+	if err := writeRawDocument(p, changedDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitEvent(t, w); !reflect.DeepEqual(e, wantChange) {
+		t.Errorf("event %+v, want %+v", e, wantChange)
+	}
+	if n, err := w.Handle().GetNodeById(6); err != nil || n.Name != "new" {
+		t.Errorf("node 6 %+v, %v", n, err)
+	}
+}
+
+func TestWatcherClose(t *testing.T) {
+	w, _ := newTestWatcher(t, WatchOptions{PollInterval: 10 * time.Millisecond})
+	h := w.Handle()
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.Close()
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Close #%d: %v", i, err)
+		}
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("events channel is not closed")
+	}
+	if _, err := h.GetNodeById(1); err == nil {
+		t.Error("handle still works after Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close after Close: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package ctb
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// xlsxSheet 工作簿中的一个工作表，rows 的第一行为表头
+type xlsxSheet struct {
+	name      string
+	rows      [][]string
+	colWidths []int // 像素，0 表示默认宽度
+}
+
+const (
+	xlsxMainNs = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxRelNs  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	// 工作表名称的最大长度
+	xlsxMaxSheetName = 31
+)
+
+// xlsxNumber 可以安全地按数字写入单元格的字符串（不会丢失前导零等信息）
+var xlsxNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]{0,14})(\.[0-9]{1,15})?$`)
+
+// xlsxSheetName 去掉工作表名称中不允许的字符，过长时保留末尾（更具体的）部分
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if strings.ContainsRune(`\/?*[]:`, c) || c < 0x20 {
+			return '_'
+		}
+		return c
+	}, name)
+	name = strings.Trim(name, "'")
+	if utf8.RuneCountInString(name) > xlsxMaxSheetName {
+		runes := []rune(name)
+		name = "…" + string(runes[len(runes)-xlsxMaxSheetName+1:])
+	}
+	if name == "" {
+		name = "Sheet"
+	}
+	return name
+}
+
+// xlsxColumnName 列号（从 0 开始）对应的列名：A、B、...、Z、AA、...
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// writeXlsx 写入只包含内联字符串与数字的最小 xlsx 工作簿，表头加粗并冻结
+func writeXlsx(w io.Writer, sheets []xlsxSheet) error {
+	zw := zip.NewWriter(w)
+	write := func(name, content string) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+content)
+		return err
+	}
+
+	var types, workbook, rels strings.Builder
+	types.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	types.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	types.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	types.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	types.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(`<workbook xmlns="` + xlsxMainNs + `" xmlns:r="` + xlsxRelNs + `"><sheets>`)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlText(sheet.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, n, xlsxRelNs, n)
+		if err := write(fmt.Sprintf("xl/worksheets/sheet%d.xml", n), xlsxWorksheet(sheet)); err != nil {
+			return err
+		}
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/></Relationships>`, len(sheets)+1, xlsxRelNs)
+
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + xlsxRelNs + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		if err := write(part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xlsxStyles 两种单元格样式：0 默认，1 加粗（表头）
+const xlsxStyles = `<styleSheet xmlns="` + xlsxMainNs + `">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+func xlsxWorksheet(sheet xlsxSheet) string {
+	var sb strings.Builder
+	sb.WriteString(`<worksheet xmlns="` + xlsxMainNs + `">`)
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0">`)
+	if len(sheet.rows) > 1 {
+		sb.WriteString(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	}
+	sb.WriteString(`</sheetView></sheetViews>`)
+	var cols strings.Builder
+	for i, width := range sheet.colWidths {
+		if width > 0 {
+			// 列宽的单位约为 7 像素
+			fmt.Fprintf(&cols, `<col min="%d" max="%d" width="%.2f" customWidth="1"/>`, i+1, i+1, float64(width)/7+0.71)
+		}
+	}
+	if cols.Len() > 0 {
+		sb.WriteString("<cols>" + cols.String() + "</cols>")
+	}
+	sb.WriteString("<sheetData>")
+	for r, row := range sheet.rows {
+		fmt.Fprintf(&sb, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := fmt.Sprintf("%s%d", xlsxColumnName(c), r+1)
+			style := ""
+			if r == 0 {
+				style = ` s="1"`
+			}
+			if r > 0 && xlsxNumber.MatchString(cell) {
+				fmt.Fprintf(&sb, `<c r="%s"%s><v>%s</v></c>`, ref, style, cell)
+				continue
+			}
+			fmt.Fprintf(&sb, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlText(cell))
+		}
+		sb.WriteString("</row>")
+	}
+	sb.WriteString("</sheetData></worksheet>")
+	return sb.String()
+}
@@ -0,0 +1,145 @@
+package ctb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// tablesDocument 每个顶层节点一个表格，节点名称依次为 names
+func tablesDocument(names ...string) *rawDocument {
+	doc := newRawDocument()
+	for i, name := range names {
+		id := int32(i + 1)
+		n := newRawNode(id, 0, id, name, time.Unix(1700000000, 0))
+		var b richTextBuilder
+		b.grid([][]string{{"name", "qty"}, {name, "007"}, {"x", "1.5"}})
+		b.build(n)
+		doc.nodes[id] = n
+	}
+	return doc
+}
+
+// xlsxSheetNames 工作簿中按顺序排列的工作表名称
+func xlsxSheetNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("xl/workbook.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.NewDecoder(f).Decode(&workbook); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range workbook.Sheets {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestExportTablesXLSXSheetNames(t *testing.T) {
+	long := strings.Repeat("z", 40)
+	h := openDocument(t, tablesDocument("Root", "root", "ROOT", "a/b:c[1]?", "a_b_c_1__", "A"+long, "B"+long, "C"+long, "'quoted'"))
+	var buf bytes.Buffer
+	if err := h.ExportTablesXLSX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := xlsxSheetNames(t, buf.Bytes())
+	tail := "…" + strings.Repeat("z", 28) + "@0"
+	want := []string{
+		"Root@0", "root@0~2", "ROOT@0~3",
+		"a_b_c_1__@0", "a_b_c_1__@0~2",
+		tail, tail[:len(tail)-len("@0")] + "~2", tail[:len(tail)-len("@0")] + "~3",
+		"quoted'@0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sheet names:\n got %q\nwant %q", got, want)
+	}
+	// Excel 不区分大小写地比较工作表名称
+	seen := map[string]bool{}
+	for _, name := range got {
+		if utf8.RuneCountInString(name) > xlsxMaxSheetName {
+			t.Errorf("sheet name %q is longer than %d characters", name, xlsxMaxSheetName)
+		}
+		if strings.ContainsAny(name, `\/?*[]:`) || strings.HasPrefix(name, "'") {
+			t.Errorf("sheet name %q contains forbidden characters", name)
+		}
+		if seen[strings.ToLower(name)] {
+			t.Errorf("duplicate sheet name %q", name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+}
+
+func TestExportTablesXLSXContent(t *testing.T) {
+	h := openDocument(t, tablesDocument("T <&>"))
+	var buf bytes.Buffer
+	if err := h.ExportTablesXLSX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`,
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">T &lt;&amp;&gt;</t></is></c>`,
+		// 有前导零的数字按文本写入
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">007</t></is></c>`,
+		`<c r="B3"><v>1.5</v></c>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("worksheet does not contain %s:\n%s", want, data)
+		}
+	}
+
+	buf.Reset()
+	if err := openDocument(t, sampleDocument()).ExportTablesXLSX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := xlsxSheetNames(t, buf.Bytes()); len(got) != 1 {
+		t.Errorf("sheets of a document with one table: %q", got)
+	}
+	// 没有表格时也有一个工作表
+	buf.Reset()
+	if err := openDocument(t, newRawDocument()).ExportTablesXLSX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := xlsxSheetNames(t, buf.Bytes()); !reflect.DeepEqual(got, []string{"Sheet1"}) {
+		t.Errorf("sheets of a document without tables: %q", got)
+	}
+}
+
+func TestXlsxColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumnName(i); got != want {
+			t.Errorf("xlsxColumnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package ctb
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type XmlDocument struct {
 	XMLName   xml.Name      `xml:"node"`
@@ -30,9 +35,116 @@ type XmlRichText struct {
 }
 
 type XmlGrid struct {
-	XMLName xml.Name `xml:"table"`
-	Rows    []struct {
+	XMLName   xml.Name `xml:"table"`
+	ColWidths string   `xml:"col_widths,attr"` // 逗号分隔的列宽，0 表示默认宽度
+	IsLight   string   `xml:"is_light,attr"`
+	Rows      []struct {
 		XMLName xml.Name `xml:"row"`
 		Cells   []string `xml:"cell"`
 	} `xml:"row"`
 }
+
+// parseGrid 解析 grid 表的 txt，返回的 rows 第一行为表头（CherryTree 把表头存放在最后一行）
+func parseGrid(txt string) (rows [][]string, colWidths []int, isLight bool, err error) {
+	var g XmlGrid
+	if err = xml.Unmarshal([]byte(txt), &g); err != nil {
+		return nil, nil, false, err
+	}
+	if n := len(g.Rows); n > 0 {
+		rows = append(rows, g.Rows[n-1].Cells)
+		for _, r := range g.Rows[:n-1] {
+			rows = append(rows, r.Cells)
+		}
+	}
+	if g.ColWidths != "" {
+		for _, w := range strings.Split(g.ColWidths, ",") {
+			i, err := strconv.Atoi(strings.TrimSpace(w))
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("invalid col_widths %q", g.ColWidths)
+			}
+			colWidths = append(colWidths, i)
+		}
+	}
+	return rows, colWidths, g.IsLight == "1" || g.IsLight == "True", nil
+}
+
+// xmlHeader 节点富文本 xml 的声明
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>`
+
+// marshalXmlDocument 将富文本序列化为节点 txt 字段的格式（与 CherryTree 一样，文本中的换行不转义）
+func marshalXmlDocument(doc *XmlDocument) string {
+	var sb strings.Builder
+	sb.WriteString(xmlHeader)
+	if len(doc.RichTexts) == 0 {
+		sb.WriteString("<node/>")
+		return sb.String()
+	}
+	sb.WriteString("<node>")
+	for _, rt := range doc.RichTexts {
+		writeRichText(&sb, rt)
+	}
+	sb.WriteString("</node>")
+	return sb.String()
+}
+
+// writeRichText 输出一个 rich_text 元素，ctb 的节点 txt 与 ctd 中的格式相同
+func writeRichText(sb *strings.Builder, rt XmlRichText) {
+	sb.WriteString("<rich_text")
+	for _, attr := range richTextAttrs(rt) {
+		sb.WriteString(" " + attr[0] + `="` + xmlAttrEscaper.Replace(attr[1]) + `"`)
+	}
+	sb.WriteString(">")
+	sb.WriteString(xmlTextEscaper.Replace(rt.Text))
+	sb.WriteString("</rich_text>")
+}
+
+// richTextAttrs 富文本片段中不为空的属性，顺序固定
+func richTextAttrs(rt XmlRichText) [][2]string {
+	var ret [][2]string
+	for _, attr := range [][2]string{
+		{"foreground", rt.Foreground},
+		{"background", rt.Background},
+		{"weight", rt.Weight},
+		{"style", rt.Style},
+		{"underline", rt.Underline},
+		{"strikethrough", rt.Strikethrough},
+		{"scale", rt.Scale},
+		{"family", rt.Family},
+		{"link", rt.Link},
+		{"justification", rt.Justification},
+	} {
+		if attr[1] != "" {
+			ret = append(ret, attr)
+		}
+	}
+	if rt.Indent != 0 {
+		ret = append(ret, [2]string{"indent", strconv.Itoa(int(rt.Indent))})
+	}
+	return ret
+}
+
+var (
+	// 回车需要转义，否则解析时会和换行合并
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#13;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#10;", "\t", "&#9;", "\r", "&#13;")
+)
+
+// xmlText 去掉 XML 中不允许出现的控制字符并转义，可以用于文本与属性值
+func xmlText(s string) string {
+	return xmlAttrEscaper.Replace(xmlStrip(s))
+}
+
+// xmlCharData 与 xmlText 相同，但不转义换行与制表符，只能用于元素的文本
+func xmlCharData(s string) string {
+	return xmlTextEscaper.Replace(xmlStrip(s))
+}
+
+// xmlStrip 去掉 XML 中不允许出现的控制字符
+func xmlStrip(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0xFFFE || c == 0xFFFF {
+			return -1
+		}
+		return c
+	}, s)
+}
@@ -0,0 +1,320 @@
+// Package server 以只读的 REST/JSON 接口对外提供 CherryTree 文档，可直接挂载到已有的 http.ServeMux 上：
+//
+//	mux.Handle("/notes/", http.StripPrefix("/notes", server.New(handle)))
+//
+// 路由：
+//
+//	GET /tree                               完整的节点树
+//	GET /nodes/{id}                         节点元数据
+//	GET /nodes/{id}/children                子节点（id 为 0 时返回顶层节点）
+//	GET /nodes/{id}/content                 节点内容（图片与附件不内联，通过 attachments 下载）
+//	GET /nodes/{id}/breadcrumbs             从顶层节点到该节点的路径
+//	GET /nodes/{id}/attachments/{offset}    下载图片或附件
+//	GET /search?q=keyword                   搜索节点
+//	GET /changes?since=unixSeconds          最后保存时间不早于 since 的节点
+//	GET /recent?n=20                        最近创建的节点
+//
+// 所有响应都带有基于 ts_lastsave 的 ETag，并支持 If-None-Match。
+// 文件可能被 CherryTree 改写时，使用 NewWatching 让每个请求都使用 ctb.Watcher 当前的句柄。
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+	log "github.com/sirupsen/logrus"
+)
+
+// TreeNode 节点树中的一个节点
+type TreeNode struct {
+	*ctb.CtNode
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// Server 只读的 http.Handler
+type Server struct {
+	current func() *ctb.Handle
+}
+
+func New(handle *ctb.Handle) *Server {
+	return &Server{current: func() *ctb.Handle { return handle }}
+}
+
+// NewWatching 每个请求都使用 watcher 当前的句柄，文件被改写后自动切换
+func NewWatching(watcher *ctb.Watcher) *Server {
+	return &Server{current: watcher.Handle}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	h := s.current()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "tree":
+		s.serveTree(w, r, h)
+	case len(parts) == 1 && parts[0] == "search":
+		s.serveSearch(w, r, h)
+	case len(parts) == 1 && (parts[0] == "changes" || parts[0] == "recent"):
+		s.serveFeed(w, r, h, parts[0])
+	case len(parts) >= 2 && len(parts) <= 4 && parts[0] == "nodes":
+		id, err := strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid node id %q", parts[1]))
+			return
+		}
+		s.serveNode(w, r, h, int32(id), parts[2:])
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveNode(w http.ResponseWriter, r *http.Request, h *ctb.Handle, id int32, sub []string) {
+	if len(sub) == 0 {
+		if checkDocumentETag(w, r, h) {
+			return
+		}
+		n, err := h.GetNodeById(id)
+		writeResult(w, r, h, n, err)
+		return
+	}
+	switch {
+	case len(sub) == 1 && sub[0] == "children":
+		if checkDocumentETag(w, r, h) {
+			return
+		}
+		list, err := h.GetSubNodesById(id)
+		if list == nil {
+			list = []*ctb.CtNode{}
+		}
+		writeResult(w, r, h, list, err)
+	case len(sub) == 1 && sub[0] == "breadcrumbs":
+		if checkDocumentETag(w, r, h) {
+			return
+		}
+		list, err := h.GetNodeListFromRoot(id)
+		writeResult(w, r, h, list, err)
+	case len(sub) == 1 && sub[0] == "content":
+		if checkNodeETag(w, r, h, id) {
+			return
+		}
+		content, err := h.GetNodeContentById(id, nil)
+		if err == nil {
+			stripBinary(content)
+		}
+		writeResult(w, r, h, content, err)
+	case len(sub) == 2 && sub[0] == "attachments":
+		offset, err := strconv.ParseInt(sub[1], 10, 32)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid offset %q", sub[1]))
+			return
+		}
+		s.serveAttachment(w, r, h, id, int32(offset))
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveTree(w http.ResponseWriter, r *http.Request, h *ctb.Handle) {
+	if checkDocumentETag(w, r, h) {
+		return
+	}
+	tree, err := buildTree(h, 0)
+	writeResult(w, r, h, tree, err)
+}
+
+func buildTree(h *ctb.Handle, fatherId int32) ([]*TreeNode, error) {
+	list, err := h.GetSubNodesById(fatherId)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*TreeNode{}
+	for _, n := range list {
+		t := &TreeNode{CtNode: n}
+		if n.HasChildren {
+			t.Children, err = buildTree(h, n.Id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request, h *ctb.Handle) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+	if checkDocumentETag(w, r, h) {
+		return
+	}
+	list, err := h.SearchNodes(q)
+	if list == nil {
+		list = []*ctb.CtNode{}
+	}
+	writeResult(w, r, h, list, err)
+}
+
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request, h *ctb.Handle, kind string) {
+	var (
+		list []*ctb.CtNodeChange
+		err  error
+	)
+	if kind == "changes" {
+		since, perr := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		if perr != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid query parameter since")
+			return
+		}
+		if checkDocumentETag(w, r, h) {
+			return
+		}
+		list, err = h.GetNodesModifiedSince(time.Unix(since, 0))
+	} else {
+		n := 20
+		if v := r.URL.Query().Get("n"); v != "" {
+			n, err = strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, r, http.StatusBadRequest, "invalid query parameter n")
+				return
+			}
+		}
+		if checkDocumentETag(w, r, h) {
+			return
+		}
+		list, err = h.GetRecentlyCreated(n)
+	}
+	if list == nil {
+		list = []*ctb.CtNodeChange{}
+	}
+	writeResult(w, r, h, list, err)
+}
+
+func (s *Server) serveAttachment(w http.ResponseWriter, r *http.Request, h *ctb.Handle, id, offset int32) {
+	if checkNodeETag(w, r, h, id) {
+		return
+	}
+	widget, err := h.GetAttachment(id, offset)
+	if err != nil {
+		writeResult(w, r, h, nil, err)
+		return
+	}
+	var (
+		data        []byte
+		filename    string
+		disposition string
+		contentType string
+	)
+	switch a := widget.(type) {
+	case *ctb.CtPng:
+		data = a.Data
+		filename = fmt.Sprintf("%d_%d.png", id, offset)
+		disposition = "inline"
+		contentType = "image/png"
+	case *ctb.CtEmbFile:
+		data = a.Data
+		filename = path.Base(a.Filename)
+		disposition = "attachment"
+		contentType = mime.TypeByExtension(path.Ext(filename))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// checkDocumentETag 设置文档级 ETag（最近保存时间 + 节点数），客户端缓存仍然有效时返回 true
+func checkDocumentETag(w http.ResponseWriter, r *http.Request, h *ctb.Handle) bool {
+	ts, count, err := h.GetDocumentLastSaveTime()
+	if err != nil {
+		writeResult(w, r, h, nil, err)
+		return true
+	}
+	return checkETag(w, r, fmt.Sprintf(`W/"d%d-%d"`, ts, count))
+}
+
+// checkNodeETag 设置节点级 ETag（节点最后保存时间），客户端缓存仍然有效时返回 true
+func checkNodeETag(w http.ResponseWriter, r *http.Request, h *ctb.Handle, id int32) bool {
+	ts, err := h.GetNodeLastSaveTime(id)
+	if err != nil {
+		writeResult(w, r, h, nil, err)
+		return true
+	}
+	return checkETag(w, r, fmt.Sprintf(`W/"n%d-%d"`, id, ts))
+}
+
+func checkETag(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// stripBinary 去掉内容中内联的图片与附件数据，客户端应通过 attachments 接口下载
+func stripBinary(content *ctb.CtNodeContent) {
+	for _, line := range content.Lines {
+		for _, el := range line {
+			switch e := el.(type) {
+			case *ctb.CtPng:
+				e.Data = nil
+			case *ctb.CtEmbFile:
+				e.Data = nil
+			}
+		}
+	}
+}
+
+func writeResult(w http.ResponseWriter, r *http.Request, h *ctb.Handle, v interface{}, err error) {
+	if err != nil {
+		if ctb.IsNotFound(err) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		log.Errorf("An error occurred while serving %v: %v", h.CtbFilepath, err)
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	writeJSON(w, r, status, map[string]string{"error": msg})
+}
+
+// writeJSON 输出 JSON；HEAD 请求只输出响应头
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
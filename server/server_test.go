@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterzh4ng/cherrytree-api/ctb"
+)
+
+// newTestServer 文档结构：
+//
+//	1 root（富文本：文本、图片@12、附件@13、附件@14、锚@15）
+//	  2 child（代码）
+//	3 other
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 1))); err != nil {
+		t.Fatal(err)
+	}
+	attachment := func(data []byte) ctb.JSONAttachment {
+		return ctb.JSONAttachment{Data: &data}
+	}
+	node := func(id int32, name string, ts int64) *ctb.JSONNode {
+		return &ctb.JSONNode{
+			Id:         id,
+			Name:       name,
+			Syntax:     "plain-text",
+			CreateTime: time.Unix(ts, 0),
+			UpdateTime: time.Unix(ts, 0),
+		}
+	}
+	root := node(1, "root", 1700000100)
+	root.Syntax = ctb.CtNodeSyntaxRichText
+	root.IsRichText = true
+	root.Content = ctb.JSONContent{
+		&ctb.JSONText{Type: ctb.CtDocElementText, XmlRichText: ctb.XmlRichText{Text: "hello world\n"}},
+		&ctb.JSONPng{Type: ctb.CtDocElementPng, JSONAttachment: attachment(img.Bytes())},
+		&ctb.JSONEmbFile{Type: ctb.CtDocElementEmbFile, Filename: "../../notes.txt", JSONAttachment: attachment([]byte("some notes"))},
+		&ctb.JSONEmbFile{Type: ctb.CtDocElementEmbFile, Filename: "报告 1.bin", JSONAttachment: attachment([]byte{0, 1, 2})},
+		&ctb.JSONAnchor{Type: ctb.CtDocElementAnchor, Name: "here"},
+	}
+	child := node(2, "child", 1700000200)
+	child.Syntax = "go"
+	child.Code = "package main\n"
+	root.Children = []*ctb.JSONNode{child}
+	doc := ctb.JSONDocument{
+		Version: ctb.DocumentJSONVersion,
+		Nodes:   []*ctb.JSONNode{root, node(3, "other", 1700000300)},
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "doc.ctb")
+	if err := ctb.ImportJSON(&buf, p, ctb.JSONOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := ctb.OpenFile(p, ctb.OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = h.Close()
+	})
+	return New(h)
+}
+
+func serve(s *Server, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRouting(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		target string
+		status int
+		want   string // 响应体中应包含的内容
+	}{
+		{"/tree", http.StatusOK, `"name":"child"`},
+		{"/nodes/1", http.StatusOK, `"name":"root"`},
+		{"/nodes/1/", http.StatusOK, `"name":"root"`},
+		{"/nodes/0/children", http.StatusOK, `"name":"other"`},
+		{"/nodes/1/children", http.StatusOK, `"name":"child"`},
+		{"/nodes/2/children", http.StatusOK, `[]`},
+		{"/nodes/2/breadcrumbs", http.StatusOK, `"name":"root"`},
+		{"/nodes/1/content", http.StatusOK, `hello world`},
+		{"/nodes/2/content", http.StatusOK, `package main`},
+		{"/search?q=WORLD", http.StatusOK, `"name":"root"`},
+		{"/search?q=nothing", http.StatusOK, `[]`},
+		{"/changes?since=1700000200", http.StatusOK, `"name":"other"`},
+		{"/recent?n=1", http.StatusOK, `"name":"other"`},
+
+		{"/", http.StatusNotFound, `"error"`},
+		{"/unknown", http.StatusNotFound, `"error"`},
+		{"/tree/1", http.StatusNotFound, `"error"`},
+		{"/nodes", http.StatusNotFound, `"error"`},
+		{"/nodes/1/unknown", http.StatusNotFound, `"error"`},
+		{"/nodes/1/attachments/12/x", http.StatusNotFound, `"error"`},
+		{"/nodes/1/content/x/y", http.StatusNotFound, `"error"`},
+	}
+	for _, tt := range tests {
+		rec := serve(s, http.MethodGet, tt.target, nil)
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d: %s", tt.target, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("GET %s: body does not contain %s:\n%s", tt.target, tt.want, rec.Body)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("GET %s: Content-Type %q", tt.target, ct)
+		}
+	}
+	// 内容中不内联图片数据
+	if body := serve(s, http.MethodGet, "/nodes/1/content", nil).Body.String(); strings.Contains(body, `"data"`) {
+		t.Errorf("content contains attachment data:\n%s", body)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		target string
+		status int
+	}{
+		// 请求本身有误
+		{"/nodes/abc", http.StatusBadRequest},
+		{"/nodes/99999999999", http.StatusBadRequest},
+		{"/nodes/abc/content", http.StatusBadRequest},
+		{"/nodes/1/attachments/x", http.StatusBadRequest},
+		{"/search", http.StatusBadRequest},
+		{"/search?q=", http.StatusBadRequest},
+		{"/changes", http.StatusBadRequest},
+		{"/changes?since=yesterday", http.StatusBadRequest},
+		{"/recent?n=0", http.StatusBadRequest},
+		{"/recent?n=x", http.StatusBadRequest},
+		// 请求的东西不存在
+		{"/nodes/99", http.StatusNotFound},
+		{"/nodes/99/content", http.StatusNotFound},
+		{"/nodes/99/breadcrumbs", http.StatusNotFound},
+		{"/nodes/99/attachments/0", http.StatusNotFound},
+		{"/nodes/1/attachments/0", http.StatusNotFound},
+		{"/nodes/1/attachments/15", http.StatusNotFound}, // 锚没有可下载的内容
+		{"/nodes/2/attachments/0", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := serve(s, http.MethodGet, tt.target, nil)
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d: %s", tt.target, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+			t.Errorf("GET %s: no error message: %s", tt.target, rec.Body)
+		}
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		rec := serve(s, method, "/tree", nil)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s /tree: status %d, Allow %q", method, rec.Code, rec.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	s := newTestServer(t)
+	etags := map[string]string{}
+	for _, target := range []string{
+		"/tree", "/nodes/1", "/nodes/1/children", "/nodes/2/breadcrumbs", "/search?q=root",
+		"/changes?since=0", "/recent", "/nodes/1/content", "/nodes/2/content", "/nodes/1/attachments/12",
+	} {
+		rec := serve(s, http.MethodGet, target, nil)
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" {
+			t.Fatalf("GET %s: status %d, ETag %q", target, rec.Code, etag)
+		}
+		etags[target] = etag
+
+		for _, inm := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+			rec := serve(s, http.MethodGet, target, http.Header{"If-None-Match": {inm}})
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("GET %s with If-None-Match %s: status %d", target, inm, rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("GET %s with If-None-Match %s: 304 has a body: %s", target, inm, rec.Body)
+			}
+			if rec.Header().Get("ETag") != etag {
+				t.Errorf("GET %s with If-None-Match %s: ETag %q", target, inm, rec.Header().Get("ETag"))
+			}
+		}
+		if rec := serve(s, http.MethodGet, target, http.Header{"If-None-Match": {`W/"other"`}}); rec.Code != http.StatusOK {
+			t.Errorf("GET %s with a stale ETag: status %d", target, rec.Code)
+		}
+	}
+	// 文档级 ETag 在所有列表接口上相同
+	for _, target := range []string{"/nodes/1", "/nodes/1/children", "/search?q=root", "/recent"} {
+		if etags[target] != etags["/tree"] {
+			t.Errorf("ETag of %s is %s, ETag of /tree is %s", target, etags[target], etags["/tree"])
+		}
+	}
+	// 节点级 ETag 因节点而不同，节点的附件与内容相同
+	if etags["/nodes/1/content"] == etags["/nodes/2/content"] || etags["/nodes/1/content"] == etags["/tree"] {
+		t.Errorf("node ETags are not distinct: %v", etags)
+	}
+	if etags["/nodes/1/attachments/12"] != etags["/nodes/1/content"] {
+		t.Errorf("attachment ETag %s, content ETag %s", etags["/nodes/1/attachments/12"], etags["/nodes/1/content"])
+	}
+	// 其它节点的 ETag 不能让客户端缓存失效的节点得到 304
+	rec := serve(s, http.MethodGet, "/nodes/2/content", http.Header{"If-None-Match": {etags["/nodes/1/content"]}})
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /nodes/2/content with the ETag of node 1: status %d", rec.Code)
+	}
+}
+
+func TestHead(t *testing.T) {
+	s := newTestServer(t)
+	for _, target := range []string{"/tree", "/nodes/1/content", "/nodes/99", "/nodes/abc", "/nodes/1/attachments/13"} {
+		get := serve(s, http.MethodGet, target, nil)
+		head := serve(s, http.MethodHead, target, nil)
+		if head.Code != get.Code {
+			t.Errorf("HEAD %s: status %d, GET status %d", target, head.Code, get.Code)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("HEAD %s has a body: %s", target, head.Body)
+		}
+		for _, k := range []string{"Content-Type", "ETag", "Content-Disposition", "Content-Length"} {
+			if head.Header().Get(k) != get.Header().Get(k) {
+				t.Errorf("HEAD %s: %s %q, GET %q", target, k, head.Header().Get(k), get.Header().Get(k))
+			}
+		}
+	}
+	if cl := serve(s, http.MethodHead, "/nodes/1/attachments/13", nil).Header().Get("Content-Length"); cl != "10" {
+		t.Errorf("HEAD attachment: Content-Length %q", cl)
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		target      string
+		contentType string
+		disposition string
+		body        string
+	}{
+		{"/nodes/1/attachments/12", "image/png", `inline; filename=1_12.png`, "\x89PNG"},
+		// 文件名去掉目录部分
+		{"/nodes/1/attachments/13", "text/plain; charset=utf-8", `attachment; filename=notes.txt`, "some notes"},
+		// 非 ASCII 文件名按 RFC 2231 编码
+		{"/nodes/1/attachments/14", "application/octet-stream", `attachment; filename*=utf-8''%E6%8A%A5%E5%91%8A%201.bin`, "\x00\x01\x02"},
+	}
+	for _, tt := range tests {
+		rec := serve(s, http.MethodGet, tt.target, nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", tt.target, rec.Code, rec.Body)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("GET %s: Content-Type %q, want %q", tt.target, ct, tt.contentType)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); cd != tt.disposition {
+			t.Errorf("GET %s: Content-Disposition %q, want %q", tt.target, cd, tt.disposition)
+		}
+		if !strings.HasPrefix(rec.Body.String(), tt.body) {
+			t.Errorf("GET %s: body %q", tt.target, rec.Body)
+		}
+	}
+}